@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"maucache/internal/config"
+	"maucache/internal/sync"
+)
+
+const approvalsUsage = `用法: maucache [-config 文件] approvals [-server URL] [-token-file 文件] [-comment 说明] <命令>
+
+访问令牌取自 -token-file 指定的文件或环境变量 MAUCACHE_ADMIN_TOKEN，审批人记录为令牌在 admin.tokens_file 中的名称
+
+命令:
+  list                     列出等待审批的版本
+  approve <AppID> <版本号>  批准版本，立即对客户端提供
+  reject <AppID> <版本号>   拒绝版本，继续提供上次批准的版本
+  audit                    查看审批记录
+`
+
+// runApprovals 审批命令：通过运行中服务的管理接口（admin.listen）列出、批准、拒绝待审批版本
+// 审批状态由服务持有，命令行不直接修改状态文件
+func runApprovals(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("approvals", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, approvalsUsage) }
+	server := fs.String("server", serverURL(cfg.Admin.Listen), "maucache 管理接口地址")
+	tokenFile := fs.String("token-file", "", "访问令牌文件（只含令牌本身）")
+	comment := fs.String("comment", "", "审批说明")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	token, err := adminToken(*tokenFile)
+	if err != nil {
+		return fail(err)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	base := strings.TrimRight(*server, "/")
+	call := func(method, url string, body, out interface{}) error {
+		return callAdmin(client, token, method, url, body, out)
+	}
+
+	switch cmd := fs.Arg(0); {
+	case cmd == "list" && fs.NArg() == 1:
+		var out struct {
+			Pending []sync.PendingVersion `json:"pending"`
+		}
+		if err := call(http.MethodGet, base+"/approvals", nil, &out); err != nil {
+			return fail(err)
+		}
+		if len(out.Pending) == 0 {
+			fmt.Println("没有等待审批的版本")
+			return 0
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "APPID\t应用\t版本\t频道\t发现时间")
+		for _, p := range out.Pending {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.AppID, p.AppName, p.Version, strings.Join(p.Channels, ","), p.FirstSeen.Local().Format(time.DateTime))
+		}
+		tw.Flush()
+		return 0
+
+	case (cmd == "approve" || cmd == "reject") && fs.NArg() == 3:
+		body := map[string]string{"version": fs.Arg(2), "comment": *comment}
+		var entry sync.AuditEntry
+		if err := call(http.MethodPost, base+"/apps/"+fs.Arg(1)+"/"+cmd, body, &entry); err != nil {
+			return fail(err)
+		}
+		if cmd == "approve" {
+			fmt.Printf("%s 已批准 %s %s，已发布到频道: %s\n", entry.By, entry.AppID, entry.Version, strings.Join(entry.Published, ","))
+		} else {
+			fmt.Printf("%s 已拒绝 %s %s\n", entry.By, entry.AppID, entry.Version)
+		}
+		return 0
+
+	case cmd == "audit" && fs.NArg() == 1:
+		var entries []sync.AuditEntry
+		if err := call(http.MethodGet, base+"/approvals/audit", nil, &entries); err != nil {
+			return fail(err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "时间\t操作\tAPPID\t版本\t审批人\t说明")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.At.Local().Format(time.DateTime), e.Action, e.AppID, e.Version, e.By, e.Comment)
+		}
+		tw.Flush()
+		return 0
+	}
+	fs.Usage()
+	return 2
+}
+
+// adminToken 读取访问令牌：-token-file 优先，其次环境变量 MAUCACHE_ADMIN_TOKEN
+func adminToken(file string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("读取访问令牌失败: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if token := os.Getenv("MAUCACHE_ADMIN_TOKEN"); token != "" {
+		return token, nil
+	}
+	return "", fmt.Errorf("请用 -token-file 或环境变量 MAUCACHE_ADMIN_TOKEN 提供管理接口的访问令牌")
+}
+
+// callAdmin 带访问令牌调用管理接口，非 2xx 时返回接口给出的错误
+func callAdmin(client *http.Client, token, method, url string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("无法连接 maucache 服务: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotFound && !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return fmt.Errorf("服务未启用审批模式（sync.require_approval）")
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s (HTTP %d)", apiErr.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
+
+// serverURL 由监听地址推导本机访问地址，如 :8090 → http://127.0.0.1:8090
+func serverURL(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "错误:", err)
+	return 1
+}
@@ -23,6 +23,11 @@ func main() {
 	// 加载配置
 	cfg := config.Load(*cfgPath)
 
+	// 子命令：审批待发布版本（通过运行中服务的管理接口）
+	if flag.Arg(0) == "approvals" {
+		os.Exit(runApprovals(cfg, flag.Args()[1:]))
+	}
+
 	// 初始化日志
 	log := logging.New(cfg.Logging.Level, cfg.Logging.Format)
 
@@ -31,27 +36,71 @@ func main() {
 	log.Info("配置加载完成",
 		"config_source", cfgInfo["config_source"],
 		"channel", cfgInfo["channel"],
+		"extra_channels", cfgInfo["extra_channels"],
+		"upstream", cfgInfo["upstream"],
+		"upstreams", cfgInfo["upstreams"],
 		"interval", cfgInfo["interval"],
 		"concurrency", cfgInfo["concurrency"],
 		"retry_max", cfgInfo["retry_max"],
 		"retry_delay", cfgInfo["retry_delay"],
+		"keep_versions", cfgInfo["keep_versions"],
+		"locales", cfgInfo["locales"],
+		"segments", cfgInfo["segments"],
+		"bandwidth", cfgInfo["bandwidth"],
+		"hash_policy", cfgInfo["hash_policy"],
+		"signature_roots", cfgInfo["signature_roots"],
+		"signature_teams", cfgInfo["signature_teams"],
+		"catalog_roots", cfgInfo["catalog_roots"],
+		"require_approval", cfgInfo["require_approval"],
+		"apps_include", cfgInfo["apps_include"],
+		"apps_exclude", cfgInfo["apps_exclude"],
+		"apps_custom", cfgInfo["apps_custom"],
+		"apps_pins", cfgInfo["apps_pins"],
+		"apps_keep_versions", cfgInfo["apps_keep_versions"],
 		"cache_dir", cfgInfo["cache_dir"],
 		"scratch_dir", cfgInfo["scratch_dir"],
+		"state_dir", cfgInfo["state_dir"],
+		"quarantine_dir", cfgInfo["quarantine_dir"],
 		"log_level", cfgInfo["log_level"],
 		"log_format", cfgInfo["log_format"],
 		"health_listen", cfgInfo["health_listen"],
+		"rollout_listen", cfgInfo["rollout_listen"],
+		"rollout_rings", cfgInfo["rollout_rings"],
+		"admin_listen", cfgInfo["admin_listen"],
+		"admin_tokens_file", cfgInfo["admin_tokens_file"],
+		"http_proxy", cfgInfo["http_proxy"],
+		"ca_files", cfgInfo["ca_files"],
+		"client_cert", cfgInfo["client_cert"],
 	)
 
 	// 优雅退出
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	// 启动 health API（后台 goroutine）
+	// 创建同步引擎，启动前校验配置（未知频道等在此处直接失败）
 	statusTracker := health.NewTracker()
-	go health.Serve(ctx, cfg.Health.Listen, statusTracker, log)
+	engine, err := sync.NewEngine(cfg, log, statusTracker)
+	if err != nil {
+		log.Error("初始化同步引擎失败", "error", err)
+		os.Exit(1)
+	}
+	if err := engine.Validate(); err != nil {
+		log.Error("配置无效", "error", err)
+		os.Exit(1)
+	}
+	if err := engine.ValidateApps(ctx); err != nil {
+		log.Error("应用配置无效", "error", err)
+		os.Exit(1)
+	}
 
-	// 创建同步引擎
-	engine := sync.NewEngine(cfg, log, statusTracker)
+	// 启动 health API（后台 goroutine）
+	go health.Serve(ctx, cfg.Health.Listen, statusTracker, log)
+	// 管理接口（固定版本等，需要访问令牌）
+	go engine.ServeAdmin(ctx)
+	// 分批发布的编录服务（可选）
+	if cfg.Rollout.Listen != "" {
+		go engine.ServeRollout(ctx)
+	}
 
 	if *once {
 		// 单次模式：跑一次就退出
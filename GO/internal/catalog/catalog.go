@@ -0,0 +1,249 @@
+// Package catalog 解析和校验 MAU 编录签名文件（.cat）
+//
+// .cat 是 PKCS#7 SignedData，内容为 Microsoft 证书信任列表（CTL，与 Windows 编录文件格式相同）：
+// 每个成员带有文件名（CAT_NAMEVALUE "File" 属性）和文件摘要（SPC_INDIRECT_DATA）。
+// 客户端用它确认 {AppID}.xml / {AppID}-chk.xml 未被篡改，缓存发布前做同样的检查
+package catalog
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+var (
+	oidCTL            = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 1}
+	oidCatNameValue   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 12, 2, 1}
+	oidSpcIndirectDat = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+)
+
+// ErrNotListed 编录中没有该文件
+var ErrNotListed = errors.New("catalog: 编录中没有该文件")
+
+// FormatError 编录结构无效
+type FormatError struct {
+	Msg string
+}
+
+func (e *FormatError) Error() string {
+	return "catalog: " + e.Msg
+}
+
+func formatErrorf(format string, args ...interface{}) error {
+	return &FormatError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// SignatureError 签名无效或签名者不受信任
+type SignatureError struct {
+	Msg string
+}
+
+func (e *SignatureError) Error() string {
+	return "catalog: 签名校验失败: " + e.Msg
+}
+
+func signatureErrorf(format string, args ...interface{}) error {
+	return &SignatureError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// MismatchError 文件摘要与编录中的条目不一致
+type MismatchError struct {
+	Name string
+	Want []byte
+	Got  []byte
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("catalog: %s 的摘要与编录不一致: 期望 %x，实际 %x", e.Name, e.Want, e.Got)
+}
+
+// Entry 编录中的一个成员
+type Entry struct {
+	Name   string // 文件名，没有 File 属性的成员为空
+	Digest []byte // SHA-1（20 字节）或 SHA-256（32 字节）
+}
+
+// Catalog 签名已通过校验的编录
+type Catalog struct {
+	Entries      []Entry
+	Signer       *x509.Certificate
+	Certificates []*x509.Certificate // SignedData 中附带的全部证书
+}
+
+// Parse 解析 .cat 并校验签名（签名与内嵌的签名者证书一致）
+// 签名者是否可信另由 VerifyChain 判断
+func Parse(data []byte) (*Catalog, error) {
+	sc, err := parseSignedData(data)
+	if err != nil {
+		return nil, err
+	}
+	if !sc.contentType.Equal(oidCTL) {
+		return nil, formatErrorf("不支持的编录内容类型 %v", sc.contentType)
+	}
+	entries, err := parseCTL(sc.content)
+	if err != nil {
+		return nil, err
+	}
+	return &Catalog{Entries: entries, Signer: sc.signer, Certificates: sc.certificates}, nil
+}
+
+// VerifyChain 校验签名者证书能追溯到 roots；at 为零值时使用当前时间
+func (c *Catalog) VerifyChain(roots *x509.CertPool, at time.Time) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range c.Certificates {
+		if cert != c.Signer {
+			intermediates.AddCert(cert)
+		}
+	}
+	_, err := c.Signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return signatureErrorf("签名者 %q 不受信任: %v", c.Signer.Subject.CommonName, err)
+	}
+	return nil
+}
+
+// Check 核对文件内容与编录条目
+// 编录中有同名条目时摘要必须一致；没有同名条目时，任一条目的摘要与内容一致也视为通过
+// （带版本号的编录副本与原文件内容相同但文件名不同）；都不满足时返回 ErrNotListed
+func (c *Catalog) Check(name string, data []byte) error {
+	s1 := sha1.Sum(data)
+	s256 := sha256.Sum256(data)
+	digestOf := func(e Entry) []byte {
+		if len(e.Digest) == sha1.Size {
+			return s1[:]
+		}
+		return s256[:]
+	}
+	for _, e := range c.Entries {
+		if strings.EqualFold(e.Name, name) {
+			if got := digestOf(e); !bytes.Equal(got, e.Digest) {
+				return &MismatchError{Name: name, Want: e.Digest, Got: got}
+			}
+			return nil
+		}
+	}
+	for _, e := range c.Entries {
+		if bytes.Equal(digestOf(e), e.Digest) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotListed, name)
+}
+
+// CTL 中的成员及其属性
+type trustedSubject struct {
+	ID    []byte
+	Attrs []attribute `asn1:"optional,set"`
+}
+
+type catNameValue struct {
+	Tag   string
+	Flags int
+	Value []byte
+}
+
+type spcIndirectData struct {
+	Data   asn1.RawValue
+	Digest struct {
+		Algorithm asn1.RawValue
+		Digest    []byte
+	}
+}
+
+// parseCTL 解析 CertificateTrustList 的内容字节，提取成员
+// CTL 开头的 version / listIdentifier / sequenceNumber / 时间都是可选或非 SEQUENCE 字段，
+// 按顺序第 1、2、3 个 SEQUENCE 分别是 subjectUsage、subjectAlgorithm、trustedSubjects
+func parseCTL(content []byte) ([]Entry, error) {
+	var seqs []asn1.RawValue
+	for rest := content; len(rest) > 0; {
+		var rv asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &rv); err != nil {
+			return nil, formatErrorf("CTL 解析失败: %v", err)
+		}
+		if rv.Class == asn1.ClassUniversal && rv.Tag == asn1.TagSequence {
+			seqs = append(seqs, rv)
+		}
+	}
+	if len(seqs) < 2 {
+		return nil, formatErrorf("CTL 结构不完整")
+	}
+	if len(seqs) < 3 {
+		return nil, nil
+	}
+
+	var entries []Entry
+	for rest := seqs[2].Bytes; len(rest) > 0; {
+		var ts trustedSubject
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &ts); err != nil {
+			return nil, formatErrorf("CTL 成员解析失败: %v", err)
+		}
+		e, err := parseSubject(ts)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseSubject 从成员属性中取文件名和摘要；没有 SPC_INDIRECT_DATA 时成员标识本身就是摘要
+// （原始字节，或 UTF-16 编码的十六进制字符串）
+func parseSubject(ts trustedSubject) (Entry, error) {
+	var e Entry
+	for _, a := range ts.Attrs {
+		if len(a.Values) == 0 {
+			continue
+		}
+		switch {
+		case a.Type.Equal(oidCatNameValue):
+			var nv catNameValue
+			if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &nv); err != nil {
+				return e, formatErrorf("CTL 成员名称解析失败: %v", err)
+			}
+			if strings.EqualFold(nv.Tag, "File") {
+				e.Name = decodeUTF16(nv.Value)
+			}
+		case a.Type.Equal(oidSpcIndirectDat):
+			var spc spcIndirectData
+			if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &spc); err != nil {
+				return e, formatErrorf("CTL 成员摘要解析失败: %v", err)
+			}
+			e.Digest = spc.Digest.Digest
+		}
+	}
+	if e.Digest == nil {
+		if d, err := hex.DecodeString(decodeUTF16(ts.ID)); err == nil && len(d) > 0 {
+			e.Digest = d
+		} else {
+			e.Digest = ts.ID
+		}
+	}
+	if len(e.Digest) != sha1.Size && len(e.Digest) != sha256.Size {
+		return e, formatErrorf("CTL 成员 %q 的摘要长度 %d 无效", e.Name, len(e.Digest))
+	}
+	return e, nil
+}
+
+// decodeUTF16 解码 UTF-16LE 字符串，去掉结尾的 NUL
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])|uint16(b[i+1])<<8)
+	}
+	return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+}
@@ -0,0 +1,312 @@
+package catalog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// signer is a catalog signing key with its certificate, issued by a test root.
+type signer struct {
+	key   crypto.Signer
+	cert  *x509.Certificate
+	roots *x509.CertPool
+}
+
+func newSigner(t *testing.T, useRSA bool) signer {
+	t.Helper()
+	now := time.Now()
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Microsoft Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, _ := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	root, _ := x509.ParseCertificate(rootDER)
+
+	var key crypto.Signer
+	if useRSA {
+		key, _ = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(77),
+		Subject:      pkix.Name{CommonName: "Test Microsoft Corporation"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, leafTmpl, root, key.Public(), rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return signer{key: key, cert: cert, roots: roots}
+}
+
+// member is one catalog entry; a nil name produces a hash-only entry.
+type member struct {
+	name *string
+	data []byte
+}
+
+func named(name, data string) member { return member{name: &name, data: []byte(data)} }
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// wrap encodes body under the given class/tag as a constructed element.
+func wrap(t *testing.T, class, tag int, body []byte) []byte {
+	return mustMarshal(t, asn1.RawValue{Class: class, Tag: tag, IsCompound: true, Bytes: body})
+}
+
+func utf16LE(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func bmpString(s string) asn1.RawValue {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return asn1.RawValue{Tag: asn1.TagBMPString, Bytes: b}
+}
+
+// buildCatalog produces a Windows-style catalog: a SignedData wrapping a CTL,
+// signed over authenticated attributes.
+func buildCatalog(t *testing.T, s signer, hash crypto.Hash, members []member) []byte {
+	t.Helper()
+	algOID := map[crypto.Hash]asn1.ObjectIdentifier{crypto.SHA1: oidSHA1, crypto.SHA256: oidSHA256}[hash]
+	algID := pkix.AlgorithmIdentifier{Algorithm: algOID, Parameters: asn1.NullRawValue}
+
+	var subjects []byte
+	for _, m := range members {
+		h := hash.New()
+		h.Write(m.data)
+		sum := h.Sum(nil)
+		type nameValue struct {
+			Tag   asn1.RawValue
+			Flags int
+			Value []byte
+		}
+		type indirect struct {
+			Data   []asn1.ObjectIdentifier
+			Digest struct {
+				Algorithm pkix.AlgorithmIdentifier
+				Digest    []byte
+			}
+		}
+		var spc indirect
+		spc.Data = []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 311, 2, 1, 25}}
+		spc.Digest.Algorithm, spc.Digest.Digest = algID, sum
+		attrs := []attribute{{Type: oidSpcIndirectDat, Values: []asn1.RawValue{{FullBytes: mustMarshal(t, spc)}}}}
+		id := utf16LE(strings.ToUpper(hex.EncodeToString(sum)))
+		if m.name != nil {
+			nv := nameValue{Tag: bmpString("File"), Flags: 0x10010001, Value: utf16LE(*m.name)}
+			attrs = append(attrs, attribute{Type: oidCatNameValue, Values: []asn1.RawValue{{FullBytes: mustMarshal(t, nv)}}})
+		} else {
+			attrs = nil // hash-only: the identifier is the digest
+		}
+		subjects = append(subjects, mustMarshal(t, struct {
+			ID    []byte
+			Attrs []attribute `asn1:"optional,set"`
+		}{id, attrs})...)
+	}
+
+	ctl := mustMarshal(t, struct {
+		SubjectUsage     []asn1.ObjectIdentifier
+		ListIdentifier   []byte
+		ThisUpdate       time.Time `asn1:"utc"`
+		SubjectAlgorithm pkix.AlgorithmIdentifier
+		Subjects         asn1.RawValue
+	}{
+		SubjectUsage:     []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 311, 12, 1, 1}},
+		ListIdentifier:   []byte{1, 2, 3, 4},
+		ThisUpdate:       time.Now().UTC().Truncate(time.Second),
+		SubjectAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 12, 1, 2}, Parameters: asn1.NullRawValue},
+		Subjects:         asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: subjects},
+	})
+	var ctlRaw asn1.RawValue
+	asn1.Unmarshal(ctl, &ctlRaw)
+
+	h := hash.New()
+	h.Write(ctlRaw.Bytes)
+	attrBody := append(
+		mustMarshal(t, attribute{Type: oidContentType, Values: []asn1.RawValue{{FullBytes: mustMarshal(t, oidCTL)}}}),
+		mustMarshal(t, attribute{Type: oidMessageDigest, Values: []asn1.RawValue{{FullBytes: mustMarshal(t, h.Sum(nil))}}})...)
+	signedSet := mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrBody})
+	h = hash.New()
+	h.Write(signedSet)
+	sig, err := s.key.Sign(rand.Reader, h.Sum(nil), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	si := signerInfo{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: mustMarshal(t, issuerAndSerial{Issuer: asn1.RawValue{FullBytes: s.cert.RawIssuer}, Serial: s.cert.SerialNumber})},
+		DigestAlgorithm:    algID,
+		SignedAttrs:        asn1.RawValue{FullBytes: wrap(t, asn1.ClassContextSpecific, 0, attrBody)},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}},
+		Signature:          sig,
+	}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{FullBytes: wrap(t, asn1.ClassUniversal, asn1.TagSet, mustMarshal(t, algID))},
+		EncapContentInfo: contentInfo{ContentType: oidCTL, Content: asn1.RawValue{FullBytes: wrap(t, asn1.ClassContextSpecific, 0, ctl)}},
+		Certificates:     asn1.RawValue{FullBytes: wrap(t, asn1.ClassContextSpecific, 0, s.cert.Raw)},
+		SignerInfos:      []signerInfo{si},
+	}
+	return mustMarshal(t, contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{FullBytes: wrap(t, asn1.ClassContextSpecific, 0, mustMarshal(t, sd))},
+	})
+}
+
+const (
+	appXML = `<?xml version="1.0"?><plist><array><dict><key>Title</key><string>Word</string></dict></array></plist>`
+	chkXML = `<?xml version="1.0"?><plist><dict><key>Update Version</key><string>16.93</string></dict></plist>`
+)
+
+func TestParseAndCheck(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		useRSA bool
+		hash   crypto.Hash
+	}{
+		{"ecdsa-sha256", false, crypto.SHA256},
+		{"rsa-sha1", true, crypto.SHA1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSigner(t, tt.useRSA)
+			data := buildCatalog(t, s, tt.hash, []member{
+				named("0409MSWD2019.xml", appXML),
+				named("0409MSWD2019-chk.xml", chkXML),
+			})
+			cat, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(cat.Entries) != 2 || cat.Entries[0].Name != "0409MSWD2019.xml" {
+				t.Fatalf("Entries = %+v", cat.Entries)
+			}
+			if cat.Signer.Subject.CommonName != "Test Microsoft Corporation" {
+				t.Errorf("Signer = %q", cat.Signer.Subject.CommonName)
+			}
+			if err := cat.VerifyChain(s.roots, time.Time{}); err != nil {
+				t.Errorf("VerifyChain: %v", err)
+			}
+
+			if err := cat.Check("0409MSWD2019.xml", []byte(appXML)); err != nil {
+				t.Errorf("Check(app xml): %v", err)
+			}
+			if err := cat.Check("0409MSWD2019-CHK.XML", []byte(chkXML)); err != nil {
+				t.Errorf("Check is case-insensitive on names: %v", err)
+			}
+			// A versioned copy has a different name but identical content.
+			if err := cat.Check("0409MSWD2019_16.93.xml", []byte(appXML)); err != nil {
+				t.Errorf("Check(versioned copy): %v", err)
+			}
+
+			var me *MismatchError
+			if err := cat.Check("0409MSWD2019.xml", []byte(appXML+" ")); !errors.As(err, &me) {
+				t.Errorf("tampered xml: err = %v, want MismatchError", err)
+			}
+			if err := cat.Check("other.xml", []byte("unrelated")); !errors.Is(err, ErrNotListed) {
+				t.Errorf("unknown file: err = %v, want ErrNotListed", err)
+			}
+		})
+	}
+}
+
+func TestParseHashOnlyEntries(t *testing.T) {
+	s := newSigner(t, false)
+	cat, err := Parse(buildCatalog(t, s, crypto.SHA1, []member{{data: []byte(appXML)}}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := sha1.Sum([]byte(appXML))
+	if len(cat.Entries) != 1 || cat.Entries[0].Name != "" || !bytes.Equal(cat.Entries[0].Digest, want[:]) {
+		t.Fatalf("Entries = %+v", cat.Entries)
+	}
+	if err := cat.Check("0409MSWD2019.xml", []byte(appXML)); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+}
+
+func TestParseRejectsTamperedCatalog(t *testing.T) {
+	s := newSigner(t, false)
+	data := buildCatalog(t, s, crypto.SHA256, []member{named("a.xml", appXML)})
+
+	// Swap the listed digest for that of different content: the CTL no longer
+	// matches the signed messageDigest.
+	old := sha256.Sum256([]byte(appXML))
+	forged := sha256.Sum256([]byte("forged"))
+	tampered := bytes.Replace(data, old[:], forged[:], 1)
+	if bytes.Equal(tampered, data) {
+		t.Fatal("digest not found in catalog")
+	}
+	var se *SignatureError
+	if _, err := Parse(tampered); !errors.As(err, &se) {
+		t.Errorf("tampered content: err = %v, want SignatureError", err)
+	}
+
+	// Corrupting the signature itself.
+	sigTampered := bytes.Clone(data)
+	sigTampered[len(sigTampered)-3] ^= 0xff
+	if _, err := Parse(sigTampered); err == nil {
+		t.Error("corrupted signature should fail")
+	}
+
+	var fe *FormatError
+	if _, err := Parse([]byte("<html>not a catalog</html>")); !errors.As(err, &fe) {
+		t.Errorf("garbage: err = %v, want FormatError", err)
+	}
+}
+
+func TestVerifyChainRejectsUnknownRoot(t *testing.T) {
+	s := newSigner(t, false)
+	cat, err := Parse(buildCatalog(t, s, crypto.SHA256, []member{named("a.xml", appXML)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newSigner(t, false)
+	var se *SignatureError
+	if err := cat.VerifyChain(other.roots, time.Time{}); !errors.As(err, &se) {
+		t.Errorf("err = %v, want SignatureError", err)
+	}
+}
@@ -0,0 +1,241 @@
+package catalog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// PKCS#7 / CMS SignedData（RFC 2315 / RFC 5652），只实现校验编录签名所需的部分
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// contentInfo 的 content 是 [0] EXPLICIT；RawValue 不会剥掉外层标签，取 Bytes 即内层元素
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// signedContent 通过签名校验的 SignedData
+type signedContent struct {
+	contentType  asn1.ObjectIdentifier
+	content      []byte // eContent 的内容字节（不含外层 tag / length）
+	signer       *x509.Certificate
+	certificates []*x509.Certificate
+}
+
+// parseSignedData 解析 SignedData 并用内嵌的签名者证书校验签名
+// 只校验签名本身；证书链是否可信由调用方决定
+func parseSignedData(der []byte) (*signedContent, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, formatErrorf("ContentInfo 解析失败: %v", err)
+	} else if len(rest) > 0 {
+		return nil, formatErrorf("ContentInfo 之后有 %d 字节多余数据", len(rest))
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, formatErrorf("不是 SignedData（内容类型 %v）", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, formatErrorf("SignedData 解析失败: %v", err)
+	}
+	if len(sd.EncapContentInfo.Content.Bytes) == 0 {
+		return nil, formatErrorf("SignedData 没有内容（分离签名）")
+	}
+	// eContent 的内容字节：摘要按 DER 编码的内容字节计算，不含标签和长度
+	var eContent asn1.RawValue
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.Content.Bytes, &eContent); err != nil {
+		return nil, formatErrorf("签名内容解析失败: %v", err)
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, formatErrorf("证书解析失败: %v", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, formatErrorf("签名者数量为 %d，应为 1", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+
+	sc := &signedContent{
+		contentType:  sd.EncapContentInfo.ContentType,
+		content:      eContent.Bytes,
+		certificates: certs,
+	}
+	if sc.signer, err = findSigner(si.SID, certs); err != nil {
+		return nil, err
+	}
+	if err := sc.verify(si); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// findSigner 按 SignerIdentifier（IssuerAndSerialNumber 或 [0] SubjectKeyIdentifier）查找签名者证书
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, signatureErrorf("找不到 SubjectKeyIdentifier 为 %x 的签名者证书", sid.Bytes)
+	}
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, formatErrorf("SignerIdentifier 解析失败: %v", err)
+	}
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.Serial) == 0 {
+			return c, nil
+		}
+	}
+	return nil, signatureErrorf("找不到序列号为 %s 的签名者证书", ias.Serial)
+}
+
+// verify 校验签名：有签名属性时先核对 messageDigest / contentType，签名覆盖属性的 DER（SET 标签）；
+// 没有签名属性时签名直接覆盖内容
+func (sc *signedContent) verify(si signerInfo) error {
+	hash, err := digestHash(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	algo, err := signatureAlgorithm(sc.signer, hash)
+	if err != nil {
+		return err
+	}
+
+	signed := sc.content
+	if len(si.SignedAttrs.FullBytes) > 0 {
+		attrs, err := parseAttributes(si.SignedAttrs.Bytes)
+		if err != nil {
+			return err
+		}
+		var digest []byte
+		if v, ok := attrs[oidMessageDigest.String()]; !ok {
+			return signatureErrorf("签名属性缺少 messageDigest")
+		} else if _, err := asn1.Unmarshal(v.FullBytes, &digest); err != nil {
+			return formatErrorf("messageDigest 解析失败: %v", err)
+		}
+		h := hash.New()
+		h.Write(sc.content)
+		if !bytes.Equal(h.Sum(nil), digest) {
+			return signatureErrorf("内容摘要与签名属性不符")
+		}
+		if v, ok := attrs[oidContentType.String()]; ok {
+			var ct asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(v.FullBytes, &ct); err != nil || !ct.Equal(sc.contentType) {
+				return signatureErrorf("签名属性中的内容类型与实际内容不符")
+			}
+		}
+		// 签名计算时属性使用 SET OF 的通用标签，而不是 [0] IMPLICIT
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	}
+	if err := sc.signer.CheckSignature(algo, signed, si.Signature); err != nil {
+		return signatureErrorf("签名无效: %v", err)
+	}
+	return nil
+}
+
+// parseAttributes 解析属性集合，返回 OID → 第一个值
+func parseAttributes(der []byte) (map[string]asn1.RawValue, error) {
+	attrs := make(map[string]asn1.RawValue)
+	for rest := der; len(rest) > 0; {
+		var a attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &a); err != nil {
+			return nil, formatErrorf("属性解析失败: %v", err)
+		}
+		if len(a.Values) > 0 {
+			attrs[a.Type.String()] = a.Values[0]
+		}
+	}
+	return attrs, nil
+}
+
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, formatErrorf("不支持的摘要算法 %v", oid)
+}
+
+// signatureAlgorithm 按签名者公钥类型和摘要算法确定签名算法
+func signatureAlgorithm(cert *x509.Certificate, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		switch hash {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("catalog: 不支持的签名者公钥 %T", cert.PublicKey)
+}
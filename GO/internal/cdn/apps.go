@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log/slog"
 	"net/url"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	gosync "sync"
 )
@@ -15,7 +18,7 @@ type AppDef struct {
 	AppName string
 }
 
-// TargetApps 完整的 20 个应用列表
+// TargetApps 完整的 20 个应用列表，未配置 apps 时同步这些应用
 // 对应 Get-MAUApps.ps1 第 24-46 行
 var TargetApps = []AppDef{
 	{AppID: "0409MSau04", AppName: "MAU 4.x"},
@@ -40,6 +43,93 @@ var TargetApps = []AppDef{
 	{AppID: "0409OLIC02", AppName: "Office Licensing Helper"},
 }
 
+// AppFilter 应用列表的筛选和扩展（对应配置中的 apps 段）
+type AppFilter struct {
+	Include []string // 只保留 AppID 或名称匹配的应用（* ? 通配，不区分大小写），为空表示全部
+	Exclude []string // 去掉 AppID 或名称匹配的应用，优先于 Include
+	Custom  []AppDef // 追加的应用定义，AppID 与已有应用相同时只覆盖名称
+	Locales []string // 语言（LCID），每个应用按每个 LCID 展开；为空时保持原 AppID
+}
+
+// SelectApps 按 AppFilter 从 base 生成要同步的应用列表
+// 先合并自定义应用、按语言展开，再筛选：Include / Exclude 对展开后的 AppID（如 0407*）同样有效；
+// 筛选后为空时返回错误
+func SelectApps(base []AppDef, f AppFilter) ([]AppDef, error) {
+	apps := make([]AppDef, len(base), len(base)+len(f.Custom))
+	copy(apps, base)
+	for _, def := range f.Custom {
+		if def.AppName == "" {
+			def.AppName = def.AppID
+		}
+		if i := slices.IndexFunc(apps, func(a AppDef) bool { return strings.EqualFold(a.AppID, def.AppID) }); i >= 0 {
+			apps[i].AppName = def.AppName
+			continue
+		}
+		apps = append(apps, def)
+	}
+	if len(f.Locales) > 0 {
+		apps = ExpandLocales(apps, f.Locales)
+	}
+
+	var out []AppDef
+	for _, def := range apps {
+		if (len(f.Include) == 0 || matchApp(def, f.Include)) && !matchApp(def, f.Exclude) {
+			out = append(out, def)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("应用筛选后列表为空（include: %v，exclude: %v）", f.Include, f.Exclude)
+	}
+	return out, nil
+}
+
+// defaultLCID 内置应用列表使用的语言（en-US）
+const defaultLCID = "0409"
+
+// ExpandLocales 把每个应用按每个 LCID 展开：AppID 的前 4 位替换为 LCID，非 0409 的名称附上 LCID
+// MAU 按客户端语言请求 {LCID}{应用代码}.xml，不同语言的清单常引用同一个安装包，由下载计划去重
+func ExpandLocales(apps []AppDef, locales []string) []AppDef {
+	seen := make(map[string]bool)
+	out := make([]AppDef, 0, len(apps)*len(locales))
+	for _, lcid := range locales {
+		lcid = strings.ToUpper(lcid)
+		for _, def := range apps {
+			if len(def.AppID) <= 4 {
+				continue
+			}
+			id := lcid + def.AppID[4:]
+			if seen[strings.ToUpper(id)] {
+				continue
+			}
+			seen[strings.ToUpper(id)] = true
+			name := def.AppName
+			if lcid != defaultLCID {
+				name = fmt.Sprintf("%s (%s)", name, lcid)
+			}
+			out = append(out, AppDef{AppID: id, AppName: name})
+		}
+	}
+	return out
+}
+
+// matchApp AppID 或名称是否匹配任一模式
+func matchApp(def AppDef, patterns []string) bool {
+	for _, p := range patterns {
+		re := globPattern(p)
+		if re.MatchString(def.AppID) || re.MatchString(def.AppName) {
+			return true
+		}
+	}
+	return false
+}
+
+// globPattern 把 * ? 通配模式转为不区分大小写的正则
+// 不用 path.Match：应用名称中有 "Word 365/2021/2019" 这样的写法，* 需要能匹配 /
+func globPattern(p string) *regexp.Regexp {
+	re := strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(p))
+	return regexp.MustCompile("(?i)^" + re + "$")
+}
+
 // AppInfo 对应 PowerShell Get-MAUApp.ps1 返回的 PSCustomObject
 type AppInfo struct {
 	AppID   string
@@ -49,13 +139,13 @@ type AppInfo struct {
 	// 编录文件 URI
 	CollateralURIs CollateralURIs
 
-	// 从 AppID.xml 解析出的所有包的下载 URL
-	PackageURIs []string
+	// 从 AppID.xml 解析出的所有包（含清单中的大小、哈希、类型等元数据）
+	Packages []Package
 
 	// 从 AppID-history.xml 解析出的历史版本号
 	HistoricVersions []string
-	// 历史版本对应的包 URI（key=版本号）
-	HistoricPackageURIs map[string][]string
+	// 历史版本对应的包（key=版本号）
+	HistoricPackages map[string][]Package
 }
 
 // CollateralURIs 对应 PowerShell Get-MAUApp.ps1 中的 CollateralURIs 对象
@@ -66,25 +156,88 @@ type CollateralURIs struct {
 	HistoryXML string // {AppID}-history.xml
 }
 
+// AppFetchError 部分应用的清单获取失败（重试后仍失败）
+// FetchAllApps 返回该错误时，成功获取的应用仍然有效，调用方应继续处理并报告失败的应用
+type AppFetchError struct {
+	Failed map[string]error // key=AppID
+}
+
+func (e *AppFetchError) Error() string {
+	ids := e.AppIDs()
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, fmt.Sprintf("%s: %v", id, e.Failed[id]))
+	}
+	return fmt.Sprintf("%d 个应用获取失败: %s", len(ids), strings.Join(parts, "; "))
+}
+
+// AppIDs 返回失败的应用 ID（已排序）
+func (e *AppFetchError) AppIDs() []string {
+	ids := make([]string, 0, len(e.Failed))
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Apps 返回要同步的应用列表
+func (c *Client) Apps() []AppDef {
+	return c.apps
+}
+
+// CheckApps 确认应用在频道中存在（{AppID}-chk.xml 可以取到），启动时校验自定义应用用
+// 上游明确返回 404 / 400 的应用以 *UnknownAppError 报告；网络错误等原样返回，调用方可以只记录警告
+func (c *Client) CheckApps(ctx context.Context, channel string, apps []AppDef) error {
+	if err := c.ValidateChannel(channel); err != nil {
+		return err
+	}
+	baseURL := c.ChannelBaseURL(channel)
+	var unknown []string
+	for _, def := range apps {
+		body, err := c.GetStringOptional(ctx, baseURL+def.AppID+"-chk.xml")
+		if err != nil {
+			return fmt.Errorf("检查应用 %s 失败: %w", def.AppID, err)
+		}
+		if body == "" {
+			unknown = append(unknown, def.AppID)
+		}
+	}
+	if len(unknown) > 0 {
+		return &UnknownAppError{Channel: channel, AppIDs: unknown}
+	}
+	return nil
+}
+
+// UnknownAppError 上游频道中不存在的应用
+type UnknownAppError struct {
+	Channel string
+	AppIDs  []string
+}
+
+func (e *UnknownAppError) Error() string {
+	return fmt.Sprintf("频道 %s 中不存在应用: %s", e.Channel, strings.Join(e.AppIDs, ", "))
+}
+
 // FetchAllApps 获取所有应用信息
 // 对应 PowerShell: Get-MAUApps.ps1，但改为并发获取（原版是串行 ForEach-Object）
+// 部分应用失败时返回成功的应用和 *AppFetchError，不再只记一条日志就把应用静默丢掉
 func (c *Client) FetchAllApps(ctx context.Context, channel string, log *slog.Logger) ([]AppInfo, error) {
-	basePath, ok := channelPaths[channel]
-	if !ok {
-		return nil, fmt.Errorf("未知频道: %s", channel)
+	if err := c.ValidateChannel(channel); err != nil {
+		return nil, err
 	}
-	baseURL := cdnBase + basePath
+	baseURL := c.ChannelBaseURL(channel)
 
 	var (
 		mu      gosync.Mutex
 		results []AppInfo
 		wg      gosync.WaitGroup
-		errs    []error
+		failed  = make(map[string]error)
 	)
 
 	// 并发获取每个应用的清单（PowerShell 原版是串行）
 	sem := make(chan struct{}, 4) // 限制并发数
-	for _, app := range TargetApps {
+	for _, app := range c.apps {
 		wg.Add(1)
 		go func(def AppDef) {
 			defer wg.Done()
@@ -95,7 +248,7 @@ func (c *Client) FetchAllApps(ctx context.Context, channel string, log *slog.Log
 			mu.Lock()
 			defer mu.Unlock()
 			if err != nil {
-				errs = append(errs, fmt.Errorf("%s: %w", def.AppName, err))
+				failed[def.AppID] = fmt.Errorf("%s: %w", def.AppName, err)
 				return
 			}
 			results = append(results, *info)
@@ -103,10 +256,11 @@ func (c *Client) FetchAllApps(ctx context.Context, channel string, log *slog.Log
 	}
 	wg.Wait()
 
-	if len(errs) > 0 {
-		for _, e := range errs {
-			log.Warn("获取应用信息失败", "error", e)
+	if len(failed) > 0 {
+		for id, e := range failed {
+			log.Error("获取应用信息失败", "appID", id, "error", e)
 		}
+		return results, &AppFetchError{Failed: failed}
 	}
 
 	return results, nil
@@ -126,7 +280,7 @@ func (c *Client) fetchOneApp(ctx context.Context, def AppDef, baseURL string, lo
 			ChkXml:     baseURL + def.AppID + "-chk.xml",
 			HistoryXML: baseURL + def.AppID + "-history.xml",
 		},
-		HistoricPackageURIs: make(map[string][]string),
+		HistoricPackages: make(map[string][]Package),
 	}
 
 	// 1. 获取 AppID.xml → 解析包列表
@@ -139,7 +293,7 @@ func (c *Client) fetchOneApp(ctx context.Context, def AppDef, baseURL string, lo
 	if err != nil {
 		return nil, fmt.Errorf("解析 %s.xml 失败: %w", def.AppID, err)
 	}
-	info.PackageURIs = packages.AllURIs()
+	info.Packages = packages
 
 	// 2. 获取 AppID-chk.xml → 解析版本号
 	// 对应 Get-MAUApp.ps1 第 46-52 行
@@ -151,8 +305,13 @@ func (c *Client) fetchOneApp(ctx context.Context, def AppDef, baseURL string, lo
 
 	// 修复 version=99999 的情况
 	// 对应 Get-MAUApp.ps1 第 55-59 行
-	if info.Version == "99999" && len(packages.Versions) > 0 {
-		info.Version = packages.Versions[0]
+	if info.Version == "99999" {
+		for _, p := range packages {
+			if p.UpdateVersion != "" {
+				info.Version = p.UpdateVersion
+				break
+			}
+		}
 	}
 	if info.Version == "99999" {
 		info.Version = "Legacy"
@@ -160,9 +319,11 @@ func (c *Client) fetchOneApp(ctx context.Context, def AppDef, baseURL string, lo
 
 	// 3. 获取 AppID-history.xml（可选，404 正常）
 	// 对应 Get-MAUApp.ps1 第 62-74 行
+	// 历史清单取不到（重试后仍失败）不影响当前版本，记录后按无历史版本处理
 	histBody, err := c.GetStringOptional(ctx, info.CollateralURIs.HistoryXML)
 	if err != nil {
-		return nil, err
+		log.Warn("获取历史版本列表失败", "appID", def.AppID, "error", err)
+		histBody = ""
 	}
 	if histBody != "" {
 		versions := ParsePlistStringArray(histBody)
@@ -177,21 +338,18 @@ func (c *Client) fetchOneApp(ctx context.Context, def AppDef, baseURL string, lo
 				log.Warn("获取历史版本失败", "appID", def.AppID, "version", ver, "error", err)
 				continue
 			}
-			histPkgs, _ := ParsePlistPackages(histXML)
-			if histPkgs != nil {
-				info.HistoricPackageURIs[ver] = histPkgs.AllURIs()
+			histPkgs, err := ParsePlistPackages(histXML)
+			if err != nil {
+				log.Warn("解析历史版本清单失败", "appID", def.AppID, "version", ver, "error", err)
+				continue
 			}
+			info.HistoricPackages[ver] = histPkgs
 		}
 	}
 
 	return info, nil
 }
 
-// ChannelBaseURL 返回频道的 CDN 基础 URL
-func ChannelBaseURL(channel string) string {
-	return cdnBase + channelPaths[channel]
-}
-
 // BuildVersionedURI 构建带版本号的编录 URI
 // 对应 Save-MAUCollaterals.ps1 第 47-54 行的字符串操作
 // 使用 url.Parse 替代手动字符串切割（修复 P9 URI 拼接问题）
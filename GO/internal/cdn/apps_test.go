@@ -1,9 +1,28 @@
 package cdn
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
 	"testing"
+	"time"
 )
 
+func mustNewClient(t *testing.T, opts Options) *Client {
+	t.Helper()
+	c, err := NewClient(opts)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return c
+}
+
 func TestTargetAppsCount(t *testing.T) {
 	if len(TargetApps) != 20 {
 		t.Errorf("TargetApps has %d entries, want 20", len(TargetApps))
@@ -123,9 +142,10 @@ func TestChannelBaseURL(t *testing.T) {
 		{"Preview", "https://officecdnmac.microsoft.com/pr/1ac37578-5a24-40fb-892e-b89d85b6dfaa/MacAutoupdate/"},
 		{"Beta", "https://officecdnmac.microsoft.com/pr/4B2D7701-0A4F-49C8-B4CB-0C2D4043F51F/MacAutoupdate/"},
 	}
+	c := mustNewClient(t, Options{})
 	for _, tt := range tests {
 		t.Run(tt.channel, func(t *testing.T) {
-			got := ChannelBaseURL(tt.channel)
+			got := c.ChannelBaseURL(tt.channel)
 			if got != tt.want {
 				t.Errorf("ChannelBaseURL(%q) = %q, want %q", tt.channel, got, tt.want)
 			}
@@ -134,9 +154,253 @@ func TestChannelBaseURL(t *testing.T) {
 }
 
 func TestChannelBaseURLUnknown(t *testing.T) {
-	got := ChannelBaseURL("Unknown")
+	got := mustNewClient(t, Options{}).ChannelBaseURL("Unknown")
 	// Unknown channel returns cdnBase with empty path
 	if got != cdnBase {
 		t.Errorf("ChannelBaseURL(Unknown) = %q, want %q", got, cdnBase)
 	}
 }
+
+func TestChannelBaseURLCustomUpstream(t *testing.T) {
+	c := mustNewClient(t, Options{
+		Upstream: "http://mirror.internal:8080/",
+		Channels: map[string]string{
+			"Insider":  "AAAA-BBBB",
+			"Internal": "mirror/internal",
+		},
+	})
+
+	tests := []struct {
+		channel string
+		want    string
+	}{
+		{"Production", "http://mirror.internal:8080/pr/C1297A47-86C4-4C1F-97FA-950631F94777/MacAutoupdate/"},
+		{"Insider", "http://mirror.internal:8080/pr/AAAA-BBBB/MacAutoupdate/"},
+		{"Internal", "http://mirror.internal:8080/mirror/internal/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			if got := c.ChannelBaseURL(tt.channel); got != tt.want {
+				t.Errorf("ChannelBaseURL(%q) = %q, want %q", tt.channel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateChannel(t *testing.T) {
+	c := mustNewClient(t, Options{Channels: map[string]string{"Insider": "AAAA-BBBB"}})
+
+	for _, ch := range []string{"Production", "Preview", "Beta", "Insider"} {
+		if err := c.ValidateChannel(ch); err != nil {
+			t.Errorf("ValidateChannel(%q) = %v, want nil", ch, err)
+		}
+	}
+	if err := c.ValidateChannel("Prodution"); err == nil {
+		t.Error("ValidateChannel(Prodution) should fail for unknown channel")
+	}
+}
+
+func TestFetchAllAppsReportsFailedApps(t *testing.T) {
+	const brokenApp = "0409OPIM2019"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		switch {
+		case name == brokenApp+"-chk.xml":
+			w.WriteHeader(http.StatusInternalServerError)
+		case strings.HasSuffix(name, "-history.xml"):
+			http.NotFound(w, r)
+		case strings.HasSuffix(name, "-chk.xml"):
+			fmt.Fprint(w, `<plist><dict><key>Update Version</key><string>16.93</string></dict></plist>`)
+		default:
+			fmt.Fprint(w, `<plist><array><dict><key>Location</key><string>https://cdn/a.pkg</string></dict></array></plist>`)
+		}
+	}))
+	defer srv.Close()
+
+	c := mustNewClient(t, Options{Upstream: srv.URL, Retry: RetryPolicy{Max: 2, Delay: time.Millisecond}})
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	apps, err := c.FetchAllApps(context.Background(), "Production", log)
+	var fetchErr *AppFetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("err = %v, want *AppFetchError", err)
+	}
+	if ids := fetchErr.AppIDs(); len(ids) != 1 || ids[0] != brokenApp {
+		t.Errorf("failed apps = %v, want [%s]", ids, brokenApp)
+	}
+	if len(apps) != len(TargetApps)-1 {
+		t.Errorf("got %d apps, want %d", len(apps), len(TargetApps)-1)
+	}
+}
+
+func TestSelectApps(t *testing.T) {
+	appIDs := func(apps []AppDef) string {
+		ids := make([]string, len(apps))
+		for i, a := range apps {
+			ids[i] = a.AppID
+		}
+		return strings.Join(ids, ",")
+	}
+
+	all, err := SelectApps(TargetApps, AppFilter{})
+	if err != nil || len(all) != len(TargetApps) {
+		t.Fatalf("empty filter: got %d apps, %v; want all %d", len(all), err, len(TargetApps))
+	}
+
+	got, err := SelectApps(TargetApps, AppFilter{
+		Include: []string{"*2019", "edge"},
+		Exclude: []string{"Outlook*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0409MSWD2019,0409XCEL2019,0409PPT32019,0409ONMC2019,0409EDGE01"; appIDs(got) != want {
+		t.Errorf("include/exclude = %s, want %s", appIDs(got), want)
+	}
+
+	got, err = SelectApps(TargetApps, AppFilter{
+		Exclude: []string{"0409MSFB16", "Teams 1.0*"},
+		Custom: []AppDef{
+			{AppID: "0409WINAPP01", AppName: "Windows App"},
+			{AppID: "0409edge01", AppName: "Microsoft Edge"},
+			{AppID: "0409TEST01"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(TargetApps)-2+2 {
+		t.Errorf("got %d apps, want %d", len(got), len(TargetApps))
+	}
+	for _, a := range got {
+		switch a.AppID {
+		case "0409MSFB16", "0409TEAMS10":
+			t.Errorf("excluded app %s still selected", a.AppID)
+		case "0409EDGE01":
+			if a.AppName != "Microsoft Edge" {
+				t.Errorf("custom definition should rename Edge, got %q", a.AppName)
+			}
+		case "0409TEST01":
+			if a.AppName != "0409TEST01" {
+				t.Errorf("custom app without a name should use its ID, got %q", a.AppName)
+			}
+		}
+	}
+
+	if _, err := SelectApps(TargetApps, AppFilter{Include: []string{"nothing*"}}); err == nil {
+		t.Error("filter selecting no apps should be an error")
+	}
+	if got, _ := SelectApps(TargetApps, AppFilter{Include: []string{"[0409MSWD2019]"}}); len(got) != 0 {
+		t.Errorf("brackets are literal, got %s", appIDs(got))
+	}
+}
+
+func TestCheckAppsReportsUnknownApps(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path.Base(r.URL.Path) == "0409TYPO01-chk.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<plist><dict><key>Update Version</key><string>1.0</string></dict></plist>`)
+	}))
+	defer srv.Close()
+
+	c := mustNewClient(t, Options{Upstream: srv.URL})
+	apps := []AppDef{{AppID: "0409WINAPP01"}, {AppID: "0409TYPO01"}}
+	err := c.CheckApps(context.Background(), "Production", apps)
+	var unknown *UnknownAppError
+	if !errors.As(err, &unknown) || len(unknown.AppIDs) != 1 || unknown.AppIDs[0] != "0409TYPO01" {
+		t.Fatalf("err = %v, want UnknownAppError for 0409TYPO01", err)
+	}
+	if err := c.CheckApps(context.Background(), "Production", apps[:1]); err != nil {
+		t.Errorf("existing app: %v", err)
+	}
+}
+
+func TestFetchAllAppsUsesConfiguredApps(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		switch {
+		case strings.HasSuffix(name, "-history.xml"):
+			http.NotFound(w, r)
+		case strings.HasSuffix(name, "-chk.xml"):
+			fmt.Fprint(w, `<plist><dict><key>Update Version</key><string>1.0</string></dict></plist>`)
+		default:
+			fmt.Fprint(w, `<plist><array></array></plist>`)
+		}
+	}))
+	defer srv.Close()
+
+	c := mustNewClient(t, Options{Upstream: srv.URL, Apps: []AppDef{{AppID: "0409WINAPP01", AppName: "Windows App"}}})
+	apps, err := c.FetchAllApps(context.Background(), "Production", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 1 || apps[0].AppID != "0409WINAPP01" || apps[0].AppName != "Windows App" {
+		t.Errorf("apps = %+v", apps)
+	}
+}
+
+func TestSelectAppsExpandsLocales(t *testing.T) {
+	base := []AppDef{{AppID: "0409MSWD2019", AppName: "Word"}, {AppID: "0409EDGE01", AppName: "Edge"}}
+	got, err := SelectApps(base, AppFilter{
+		Locales: []string{"0409", "040c"},
+		Custom:  []AppDef{{AppID: "0409WINAPP01", AppName: "Windows App"}},
+		Exclude: []string{"040CEDGE01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AppDef{
+		{AppID: "0409MSWD2019", AppName: "Word"},
+		{AppID: "0409EDGE01", AppName: "Edge"},
+		{AppID: "0409WINAPP01", AppName: "Windows App"},
+		{AppID: "040CMSWD2019", AppName: "Word (040C)"},
+		{AppID: "040CWINAPP01", AppName: "Windows App (040C)"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("app[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got := ExpandLocales(base, []string{"0409", "0409"}); len(got) != len(base) {
+		t.Errorf("duplicate locales should not duplicate apps: %+v", got)
+	}
+}
+
+func TestFetchChannelBuilds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "C1297A47") && path.Base(r.URL.Path) == "builds.txt" {
+			fmt.Fprint(w, "16.92.24120731\r\n\r\n16.93.25011212\r\n")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	c := mustNewClient(t, Options{Upstream: srv.URL})
+	builds, err := c.FetchChannelBuilds(context.Background(), "Production")
+	if err != nil || len(builds) != 2 || builds[1] != "16.93.25011212" {
+		t.Errorf("Production builds = %q, %v", builds, err)
+	}
+	if _, err := c.FetchChannelBuilds(context.Background(), "Preview"); !errors.Is(err, ErrNoBuilds) {
+		t.Errorf("Preview err = %v, want ErrNoBuilds", err)
+	}
+}
+
+func TestHistoricBuilds(t *testing.T) {
+	apps := []AppInfo{
+		{HistoricVersions: []string{"16.92.24120731", "16.91.24111020"}},
+		{HistoricVersions: []string{"16.92.24120731", " 16.90.24101525 "}},
+		{},
+	}
+	got := HistoricBuilds(apps)
+	want := []string{"16.90.24101525", "16.91.24111020", "16.92.24120731"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("HistoricBuilds = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	gosync "sync"
+	"time"
+)
+
+// Breaker 按主机的熔断器，同一个 Client 的所有请求共用
+// 上游返回 429 / 503 时按 Retry-After（没有则按冷却时间）暂停该主机的所有请求；
+// 连续失败达到阈值时同样暂停，避免所有 worker 一起对着已经过载的上游重试
+type Breaker struct {
+	mu        gosync.Mutex
+	hosts     map[string]*hostState
+	threshold int           // 连续失败多少次后熔断
+	cooldown  time.Duration // 熔断持续时间（无 Retry-After 时）
+	maxPause  time.Duration // 单次暂停上限，防止异常的 Retry-After 卡死同步
+}
+
+// hostState 单个主机的熔断状态
+type hostState struct {
+	failures  int
+	openUntil time.Time
+	trips     int // 累计熔断次数
+	lastError string
+}
+
+// BreakerHostStatus 单个主机的熔断状态快照，用于 /sync/status
+type BreakerHostStatus struct {
+	Open      bool      `json:"open"`
+	OpenUntil time.Time `json:"open_until,omitempty"`
+	Failures  int       `json:"consecutive_failures"`
+	Trips     int       `json:"trips"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// NewBreaker 创建熔断器；threshold<=0 时默认 5，cooldown<=0 时默认 30s
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return &Breaker{
+		hosts:     make(map[string]*hostState),
+		threshold: threshold,
+		cooldown:  cooldown,
+		maxPause:  10 * time.Minute,
+	}
+}
+
+// Wait 主机处于熔断状态时阻塞到恢复为止
+func (b *Breaker) Wait(ctx context.Context, host string) error {
+	for {
+		b.mu.Lock()
+		var until time.Time
+		if st := b.hosts[host]; st != nil {
+			until = st.openUntil
+		}
+		b.mu.Unlock()
+
+		d := time.Until(until)
+		if d <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// IsOpen 判断主机当前是否处于熔断状态
+func (b *Breaker) IsOpen(host string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.hosts[host]
+	return st != nil && time.Now().Before(st.openUntil)
+}
+
+// Record 记录一次请求结果
+// 成功清零失败计数；限流立即熔断；其他可重试的失败累计到阈值后熔断；
+// 404 等不可重试的错误说明上游是健康的，不计入失败
+func (b *Breaker) Record(host string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.hosts[host]
+	if st == nil {
+		st = &hostState{}
+		b.hosts[host] = st
+	}
+
+	if err == nil {
+		st.failures = 0
+		return
+	}
+	if errors.Is(err, context.Canceled) || !IsRetryable(err) {
+		return
+	}
+
+	st.failures++
+	st.lastError = err.Error()
+
+	var he *HTTPError
+	if errors.As(err, &he) && he.Throttled() {
+		pause := he.RetryAfter
+		if pause <= 0 {
+			pause = b.cooldown
+		}
+		b.open(st, pause)
+		return
+	}
+	if st.failures >= b.threshold {
+		b.open(st, b.cooldown)
+	}
+}
+
+// open 熔断主机 d 时长，调用方需持有锁
+func (b *Breaker) open(st *hostState, d time.Duration) {
+	if d > b.maxPause {
+		d = b.maxPause
+	}
+	until := time.Now().Add(d)
+	if until.After(st.openUntil) {
+		st.openUntil = until
+		st.trips++
+	}
+	st.failures = 0
+}
+
+// Status 返回所有主机的熔断状态
+func (b *Breaker) Status() map[string]BreakerHostStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	out := make(map[string]BreakerHostStatus, len(b.hosts))
+	for host, st := range b.hosts {
+		s := BreakerHostStatus{
+			Failures:  st.failures,
+			Trips:     st.trips,
+			LastError: st.lastError,
+		}
+		if st.openUntil.After(now) {
+			s.Open = true
+			s.OpenUntil = st.openUntil
+		}
+		out[host] = s
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensOnThrottle(t *testing.T) {
+	b := NewBreaker(5, time.Minute)
+	b.Record("cdn", &HTTPError{StatusCode: 429, RetryAfter: 200 * time.Millisecond})
+
+	st := b.Status()["cdn"]
+	if !st.Open || st.Trips != 1 {
+		t.Fatalf("status = %+v, want open after 429", st)
+	}
+
+	start := time.Now()
+	if err := b.Wait(context.Background(), "cdn"); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 150*time.Millisecond {
+		t.Errorf("Wait returned after %v, want about 200ms", waited)
+	}
+	if err := b.Wait(context.Background(), "other-host"); err != nil {
+		t.Errorf("other hosts should not be paused: %v", err)
+	}
+}
+
+func TestBreakerThreshold(t *testing.T) {
+	b := NewBreaker(3, time.Minute)
+	for i := 0; i < 2; i++ {
+		b.Record("cdn", &HTTPError{StatusCode: 502})
+	}
+	if b.Status()["cdn"].Open {
+		t.Fatal("breaker should stay closed below the threshold")
+	}
+
+	// Success resets the counter
+	b.Record("cdn", nil)
+	b.Record("cdn", &HTTPError{StatusCode: 502})
+	b.Record("cdn", &HTTPError{StatusCode: 502})
+	if b.Status()["cdn"].Open {
+		t.Fatal("success should reset consecutive failures")
+	}
+
+	b.Record("cdn", errors.New("connection reset by peer"))
+	if !b.Status()["cdn"].Open {
+		t.Error("breaker should open at the threshold")
+	}
+}
+
+func TestBreakerIgnoresNonRetryable(t *testing.T) {
+	b := NewBreaker(1, time.Minute)
+	b.Record("cdn", &HTTPError{StatusCode: 404})
+	b.Record("cdn", context.Canceled)
+	if st := b.Status()["cdn"]; st.Open || st.Failures != 0 {
+		t.Errorf("status = %+v, 404 and cancellation must not count as failures", st)
+	}
+}
+
+func TestBreakerWaitHonoursContext(t *testing.T) {
+	b := NewBreaker(1, time.Minute)
+	b.Record("cdn", &HTTPError{StatusCode: 503})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx, "cdn"); err == nil {
+		t.Error("Wait should return the context error")
+	}
+}
+
+func TestClientPausesAfterRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := mustNewClient(t, Options{})
+	ctx := context.Background()
+
+	_, err := c.GetString(ctx, srv.URL+"/builds.txt")
+	var he *HTTPError
+	if !errors.As(err, &he) || he.StatusCode != 429 || he.RetryAfter != time.Second {
+		t.Fatalf("err = %v, want HTTP 429 with Retry-After 1s", err)
+	}
+
+	start := time.Now()
+	if _, err := c.GetString(ctx, srv.URL+"/builds.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 900*time.Millisecond {
+		t.Errorf("second request went out after %v, want the host paused for ~1s", waited)
+	}
+}
+
+func TestHeadReturnsHTTPErrorFor404(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := mustNewClient(t, Options{}).Head(context.Background(), srv.URL+"/missing.pkg")
+	var he *HTTPError
+	if !errors.As(err, &he) || he.StatusCode != 404 {
+		t.Errorf("err = %v, want HTTP 404", err)
+	}
+	if IsRetryable(err) {
+		t.Error("404 should not be retryable")
+	}
+}
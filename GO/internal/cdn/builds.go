@@ -2,6 +2,9 @@ package cdn
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -13,25 +16,113 @@ var channelPaths = map[string]string{
 	"Beta":       "/pr/4B2D7701-0A4F-49C8-B4CB-0C2D4043F51F/MacAutoupdate/",
 }
 
+// cdnBase 默认上游地址，未配置 sync.upstream 时使用
 const cdnBase = "https://officecdnmac.microsoft.com"
 
-// FetchBuilds 获取 builds.txt 并解析为版本号切片
+// NormalizeChannelPath 规范化频道路径
+// 只给出 GUID 时展开为 /pr/{GUID}/MacAutoupdate/，否则补齐首尾的 /
+func NormalizeChannelPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return ""
+	}
+	if !strings.Contains(path, "/") {
+		return "/pr/" + path + "/MacAutoupdate/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return path
+}
+
+// Upstream 返回当前使用的上游基础地址
+func (c *Client) Upstream() string {
+	return c.base
+}
+
+// Channels 返回所有可用的频道名（已排序）
+func (c *Client) Channels() []string {
+	names := make([]string, 0, len(c.channels))
+	for name := range c.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateChannel 检查频道是否已定义
+// 启动时调用，让拼错的频道名在启动阶段就失败，而不是同步到一半才报错
+func (c *Client) ValidateChannel(channel string) error {
+	if path, ok := c.channels[channel]; !ok || path == "" {
+		return fmt.Errorf("未知频道: %s（可用频道: %s）", channel, strings.Join(c.Channels(), ", "))
+	}
+	return nil
+}
+
+// ChannelBaseURL 返回频道的基础 URL
+// 未知频道返回上游基础地址本身
+func (c *Client) ChannelBaseURL(channel string) string {
+	return c.base + c.channels[channel]
+}
+
+// ErrNoBuilds 频道没有 builds.txt（目前只有 Production 频道有）
+var ErrNoBuilds = errors.New("频道没有 builds.txt")
+
+// FetchBuilds 获取 Production 频道的 builds.txt 并解析为版本号切片
 // 对应 PowerShell: Get-MAUProductionBuilds.ps1
-// 注意: 目前只有 Production 频道有 builds.txt
 func (c *Client) FetchBuilds(ctx context.Context) ([]string, error) {
-	url := cdnBase + channelPaths["Production"] + "builds.txt"
-	body, err := c.GetString(ctx, url)
+	body, err := c.GetString(ctx, c.ChannelBaseURL("Production")+"builds.txt")
 	if err != nil {
 		return nil, err
 	}
+	return parseBuilds(body), nil
+}
+
+// FetchChannelBuilds 获取指定频道自己的 builds.txt
+// 频道没有 builds.txt（404 / 400 或内容为空）时返回 ErrNoBuilds，由调用方决定回退方式
+func (c *Client) FetchChannelBuilds(ctx context.Context, channel string) ([]string, error) {
+	if err := c.ValidateChannel(channel); err != nil {
+		return nil, err
+	}
+	body, err := c.GetStringOptional(ctx, c.ChannelBaseURL(channel)+"builds.txt")
+	if err != nil {
+		return nil, err
+	}
+	builds := parseBuilds(body)
+	if len(builds) == 0 {
+		return nil, ErrNoBuilds
+	}
+	return builds, nil
+}
+
+// HistoricBuilds 从应用的历史清单推断构建列表：所有应用 history.xml 中版本号的并集（已排序）
+// 频道没有 builds.txt 时，这些就是该频道客户端可能停留的版本，即增量包有意义的起始版本
+func HistoricBuilds(apps []AppInfo) []string {
+	seen := make(map[string]bool)
+	var builds []string
+	for _, app := range apps {
+		for _, v := range app.HistoricVersions {
+			if v = strings.TrimSpace(v); v != "" && !seen[v] {
+				seen[v] = true
+				builds = append(builds, v)
+			}
+		}
+	}
+	sort.Strings(builds)
+	return builds
+}
 
-	// 按行分割，过滤空行
-	// 对应 PowerShell: .Split([System.Environment]::NewLine) + FixLineBreaks 过滤器
+// parseBuilds 按行分割，过滤空行
+// 对应 PowerShell: .Split([System.Environment]::NewLine) + FixLineBreaks 过滤器
+func parseBuilds(body string) []string {
 	var builds []string
 	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
 		if s := strings.TrimSpace(line); s != "" {
 			builds = append(builds, s)
 		}
 	}
-	return builds, nil
+	return builds
 }
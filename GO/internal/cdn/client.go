@@ -2,9 +2,14 @@ package cdn
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,110 +17,418 @@ import (
 // 修复 PowerShell P5 问题：全局复用一个实例，不再每次创建新 HttpClient
 // 对应 PowerShell: Get-HttpClientHandler.ps1 + Set-MAUCacheAdminHttpClientHandler.ps1
 type Client struct {
-	http *http.Client
+	http        *http.Client
+	base        string            // 上游基础地址，如 https://officecdnmac.microsoft.com
+	channels    map[string]string // 频道名 → GUID 路径（内置频道 + 配置中的自定义频道）
+	rootChannel string            // 平铺镜像根目录对应的频道
+	apps        []AppDef          // 要同步的应用
+
+	validators *ValidatorCache // 条件 GET 校验器缓存，nil 表示不启用
+	limiter    *RateLimiter    // 全局限速器，nil 表示不限速
+	breaker    *Breaker        // 按主机的熔断器
+	retry      RetryPolicy     // 元数据请求（GetString / GetStringOptional / Head）的重试策略
+
+	metadataTimeout time.Duration // 元数据请求的整体超时
+	readTimeout     time.Duration // 下载时单次读取响应体的超时
+
+	upstreams      []*upstream   // 按顺序尝试的上游镜像，最后一个总是规范上游
+	mirrorCooldown time.Duration // 上游故障后被跳过的时长
+}
+
+// Options 创建 Client 时的可选参数
+// 零值即为默认行为：直连 Microsoft CDN，只认识内置的三个频道
+type Options struct {
+	// Upstream 上游基础地址，可指向内部镜像、上级缓存或本地测试服务器
+	Upstream string
+	// Channels 自定义频道（频道名 → GUID 路径），与内置频道合并，同名覆盖内置
+	Channels map[string]string
+	// Apps 要同步的应用，为空时使用 TargetApps
+	Apps []AppDef
+	// Transport 代理、CA、客户端证书、TLS 版本，作用于 Client 发出的所有请求
+	Transport TransportOptions
+	// ValidatorDir 条件 GET 校验器缓存目录，为空则不启用
+	ValidatorDir string
+	// Limiter 全局限速器，所有下载和编录请求共用；nil 表示不限速
+	Limiter *RateLimiter
+	// Retry 元数据请求的重试策略，零值表示不重试
+	Retry RetryPolicy
+	// Mirrors 按顺序尝试的上游镜像（如区域上级缓存），Upstream 总是作为最后的回退
+	Mirrors []Mirror
+	// RootChannel 平铺镜像根目录对应的频道（上级 maucache 的 sync.channel），为空默认 Production；
+	// 其他频道的文件从平铺镜像的 /{频道名}/ 下获取
+	RootChannel string
+	// MetadataTimeout 元数据请求（Fetch / Head，即清单、编录、builds.txt）的整体超时，<=0 默认 2m；
+	// 安装包下载没有整体超时
+	MetadataTimeout time.Duration
+	// ReadTimeout 下载时单次读取响应体的超时，超过时视为连接停滞并取消请求（可重试、可续传），<=0 默认 2m；
+	// 只计等待网络的时间，不计限速器的等待
+	ReadTimeout time.Duration
+	// MirrorCooldown 镜像故障后被跳过的时长，<=0 默认 5m
+	MirrorCooldown time.Duration
+	// BreakerThreshold 连续失败多少次后暂停该主机的所有请求，<=0 默认 5
+	BreakerThreshold int
+	// BreakerCooldown 熔断持续时间（上游未给出 Retry-After 时），<=0 默认 30s
+	BreakerCooldown time.Duration
 }
 
 // NewClient 创建 CDN HTTP 客户端
-func NewClient() *Client {
-	return &Client{
-		http: &http.Client{
-			Timeout: 30 * time.Minute, // 大文件下载需要足够长的超时
-			Transport: &http.Transport{
-				MaxIdleConns:        20,
-				MaxIdleConnsPerHost: 20,
-				IdleConnTimeout:     90 * time.Second,
-			},
-		},
+// 代理、CA 或客户端证书配置有误时返回错误
+func NewClient(opts Options) (*Client, error) {
+	base := strings.TrimRight(strings.TrimSpace(opts.Upstream), "/")
+	if base == "" {
+		base = cdnBase
+	}
+	channels := make(map[string]string, len(channelPaths)+len(opts.Channels))
+	for name, path := range channelPaths {
+		channels[name] = path
+	}
+	for name, path := range opts.Channels {
+		channels[name] = NormalizeChannelPath(path)
 	}
-}
 
-// GetString 获取文本内容（用于 builds.txt 和 Plist XML）
-// 对应 PowerShell: $httpClient.GetStringAsync($URI).GetAwaiter().GetResult()
-func (c *Client) GetString(ctx context.Context, url string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+	apps := opts.Apps
+	if len(apps) == 0 {
+		apps = TargetApps
 	}
-	resp, err := c.http.Do(req)
+
+	transport, err := newTransport(opts.Transport)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
+	c := &Client{
+		base:     base,
+		channels: channels,
+		apps:     apps,
+		limiter:  opts.Limiter,
+		breaker:  NewBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+		retry:    opts.Retry,
+		// 不设 http.Client.Timeout：它覆盖整个响应体的读取，限速下的大文件会被中途掐断；
+		// 元数据请求的整体超时和下载的单次读取超时见 metadataTimeout / readTimeout
+		http:            &http.Client{Transport: transport},
+		metadataTimeout: opts.MetadataTimeout,
+		readTimeout:     opts.ReadTimeout,
+		upstreams:       newUpstreams(base, opts.Mirrors),
+		mirrorCooldown:  opts.MirrorCooldown,
+		rootChannel:     opts.RootChannel,
+	}
+	if c.rootChannel == "" {
+		c.rootChannel = "Production"
 	}
+	if c.metadataTimeout <= 0 {
+		c.metadataTimeout = 2 * time.Minute
+	}
+	if c.readTimeout <= 0 {
+		c.readTimeout = 2 * time.Minute
+	}
+	if c.mirrorCooldown <= 0 {
+		c.mirrorCooldown = 5 * time.Minute
+	}
+	if opts.ValidatorDir != "" {
+		if c.validators, err = NewValidatorCache(opts.ValidatorDir); err != nil {
+			return nil, fmt.Errorf("创建校验器缓存目录失败: %w", err)
+		}
+	}
+	return c, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// GetString 获取文本内容（用于 builds.txt 和 Plist XML）
+// 对应 PowerShell: $httpClient.GetStringAsync($URI).GetAwaiter().GetResult()
+// 启用校验器缓存时发送条件请求，304 时返回上次保存的内容；可重试的错误按重试策略重试
+func (c *Client) GetString(ctx context.Context, url string) (string, error) {
+	body, _, err := c.Fetch(ctx, url)
 	return string(body), err
 }
 
-// GetStringOptional 获取可选资源，404/400 返回 ""，不报错
+// GetStringOptional 获取可选资源，资源不存在（404/400）返回 ""，不报错
 // 对应 PowerShell: Get-PlistObjectFromURI -Optional
 // CDN 对不存在的 history.xml 有时返回 400 而不是 404
+// 网络错误和 5xx 重试后仍失败时返回错误，调用方据此区分"不存在"和"取不到"
 func (c *Client) GetStringOptional(ctx context.Context, url string) (string, error) {
+	body, _, err := c.Fetch(ctx, url)
+	var he *HTTPError
+	if errors.As(err, &he) && (he.StatusCode == http.StatusNotFound || he.StatusCode == http.StatusBadRequest) {
+		if c.validators != nil {
+			c.validators.forget(url)
+		}
+		return "", nil
+	}
+	return string(body), err
+}
+
+// Fetch 获取小文件的完整内容（编录、清单）
+// 启用校验器缓存时发送 If-None-Match / If-Modified-Since，304 时复用上次保存的内容；
+// 可重试的错误按重试策略重试
+func (c *Client) Fetch(ctx context.Context, url string) (body []byte, lastMod time.Time, err error) {
+	err = c.retry.Do(ctx, func() error {
+		body, lastMod, err = c.fetchOnce(ctx, url)
+		return err
+	})
+	return body, lastMod, err
+}
+
+// fetchOnce 发送一次条件 GET
+func (c *Client) fetchOnce(ctx context.Context, url string) ([]byte, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.metadataTimeout)
+	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", nil
+		return nil, time.Time{}, fmt.Errorf("create request: %w", err)
 	}
-	resp, err := c.http.Do(req)
+	resp, err := c.doConditional(req)
 	if err != nil {
-		// 网络错误当作资源不存在（可选资源允许静默失败）
-		// 但记录日志便于排查连接问题
-		return "", nil
+		return nil, time.Time{}, err
 	}
 	defer resp.Body.Close()
+	return c.readConditional(url, resp)
+}
 
-	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
-		return "", nil
+// doConditional 发送请求，有缓存的校验器时附带条件请求头
+func (c *Client) doConditional(req *http.Request) (*http.Response, error) {
+	if c.validators != nil {
+		c.validators.apply(req)
+	}
+	return c.do(req)
+}
+
+// readConditional 处理条件请求的响应：304 读缓存，200 读响应体并更新缓存
+func (c *Client) readConditional(url string, resp *http.Response) ([]byte, time.Time, error) {
+	if resp.StatusCode == http.StatusNotModified && c.validators != nil {
+		body, entry, err := c.validators.body(url)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("HTTP 304 但本地缓存不可用 %s: %w", url, err)
+		}
+		return body, entry.LastMod, nil
 	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
+		return nil, time.Time{}, newHTTPError(resp)
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	return string(body), err
+	body, err := io.ReadAll(c.body(resp))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if c.validators != nil {
+		// 缓存写入失败不影响本次结果，下次退化为普通 GET
+		_ = c.validators.store(url, resp, body)
+	}
+	return body, lastModTime(resp), nil
 }
 
-// Head 发送 HEAD 请求获取文件元信息（大小和最后修改时间）
+// RemoteFile HEAD 请求得到的远端文件元信息
+type RemoteFile struct {
+	Size    int64
+	LastMod time.Time
+	ETag    string
+}
+
+// Head 发送 HEAD 请求获取文件元信息（大小、最后修改时间、ETag）
 // 对应 PowerShell: $httpClient.SendAsync($headRequest) 在 Get-MAUCacheDownloadJobs.ps1 中
-func (c *Client) Head(ctx context.Context, url string) (size int64, lastMod time.Time, err error) {
+// 可重试的错误按重试策略重试
+func (c *Client) Head(ctx context.Context, url string) (RemoteFile, error) {
+	var rf RemoteFile
+	err := c.retry.Do(ctx, func() error {
+		var err error
+		rf, err = c.headOnce(ctx, url)
+		return err
+	})
+	return rf, err
+}
+
+// headOnce 发送一次 HEAD 请求
+func (c *Client) headOnce(ctx context.Context, url string) (RemoteFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.metadataTimeout)
+	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
 	if err != nil {
-		return 0, time.Time{}, fmt.Errorf("create request: %w", err)
+		return RemoteFile{}, fmt.Errorf("create request: %w", err)
 	}
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return 0, time.Time{}, err
+		return RemoteFile{}, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return RemoteFile{}, newHTTPError(resp)
+	}
 
-	return resp.ContentLength, lastModTime(resp), nil
+	return RemoteFile{
+		Size:    resp.ContentLength,
+		LastMod: lastModTime(resp),
+		ETag:    resp.Header.Get("ETag"),
+	}, nil
 }
 
-// Download 流式下载文件到 io.Writer
-// 对应 PowerShell: Invoke-HttpClientDownload.ps1 的核心下载循环
-// 使用 256KB 缓冲区，与 PowerShell 版一致
-func (c *Client) Download(ctx context.Context, url string, w io.Writer) (lastMod time.Time, err error) {
+// ResumeResult DownloadResume 的结果
+type ResumeResult struct {
+	LastMod time.Time
+	Resumed bool    // true=服务器返回 206，从 offset 处追加；false=整文件重新下载
+	Digests Digests // 整个文件（含续传前已有部分）的摘要
+}
+
+// DownloadResume 从 offset 处续传下载到文件
+// 对应 PowerShell: Invoke-HttpClientDownload.ps1 的核心下载循环（增加了断点续传）
+// offset>0 时发送 Range + If-Range；服务器忽略 Range（返回 200）或
+// 校验器不匹配时截断文件改为整文件下载，返回 416 时同样回退为整文件下载
+// ifRange 应为强 ETag 或 HTTP 日期，为空时不发送 If-Range
+// 续传时先对已有部分计算摘要，再边下载边累加，结果覆盖整个文件
+// 没有整体超时；单次读取超过 readTimeout 没有数据时返回 ErrReadTimeout，已写入的部分可以续传
+func (c *Client) DownloadResume(ctx context.Context, url string, f *os.File, offset int64, ifRange string) (ResumeResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("create request: %w", err)
+		return ResumeResult{}, fmt.Errorf("create request: %w", err)
 	}
-	resp, err := c.http.Do(req)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if ifRange != "" {
+			req.Header.Set("If-Range", ifRange)
+		}
+	}
+	resp, err := c.do(req)
 	if err != nil {
-		return time.Time{}, err
+		return ResumeResult{}, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return time.Time{}, fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return ResumeResult{}, err
+		}
+		if start != offset {
+			return ResumeResult{}, fmt.Errorf("Content-Range 起点 %d 与请求的 %d 不一致: %s", start, offset, url)
+		}
+		if err := f.Truncate(offset); err != nil {
+			return ResumeResult{}, err
+		}
+		h := NewHasher()
+		if _, err := io.Copy(h, io.NewSectionReader(f, 0, offset)); err != nil {
+			return ResumeResult{}, err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return ResumeResult{}, err
+		}
+		err = copyBody(io.MultiWriter(f, h), c.downloadBody(resp, cancel))
+		return ResumeResult{LastMod: lastModTime(resp), Resumed: true, Digests: h.Sum()}, err
+
+	case resp.StatusCode == http.StatusOK:
+		// 服务器不支持 Range 或文件已变化：从头写
+		if err := f.Truncate(0); err != nil {
+			return ResumeResult{}, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return ResumeResult{}, err
+		}
+		h := NewHasher()
+		err = copyBody(io.MultiWriter(f, h), c.downloadBody(resp, cancel))
+		return ResumeResult{LastMod: lastModTime(resp), Digests: h.Sum()}, err
+
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// 本地部分文件比远端还长，说明远端已变化，整文件重下
+		resp.Body.Close()
+		return c.DownloadResume(ctx, url, f, 0, "")
 	}
 
-	// 256KB 缓冲区，与 PowerShell 的 `New-Object byte[] 256KB` 一致
-	buf := make([]byte, 256*1024)
-	_, err = io.CopyBuffer(w, resp.Body, buf)
+	return ResumeResult{}, newHTTPError(resp)
+}
 
-	return lastModTime(resp), err
+// contentRangeStart 解析 Content-Range: bytes start-end/total 中的 start
+func contentRangeStart(h string) (int64, error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(h), "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("无法解析 Content-Range: %q", h)
+	}
+	startStr, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, fmt.Errorf("无法解析 Content-Range: %q", h)
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无法解析 Content-Range: %q", h)
+	}
+	return start, nil
+}
+
+// send 向单个主机发送请求：先等待目标主机的熔断恢复，再把结果记入熔断器
+// 所有对上游的请求最终都经过这里，限流时所有 worker 一起暂停
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if err := c.breaker.Wait(req.Context(), host); err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.breaker.Record(host, err)
+		return nil, err
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout {
+		c.breaker.Record(host, newHTTPError(resp))
+	} else {
+		c.breaker.Record(host, nil)
+	}
+	return resp, nil
+}
+
+// Breaker 返回按主机的熔断器
+func (c *Client) Breaker() *Breaker {
+	return c.breaker
+}
+
+// body 返回经过全局限速的响应体读取器
+func (c *Client) body(resp *http.Response) io.Reader {
+	return c.limiter.Reader(resp.Request.Context(), resp.Body)
+}
+
+// ErrReadTimeout 下载时响应体长时间没有数据（连接停滞）
+var ErrReadTimeout = errors.New("读取响应体超时")
+
+// downloadBody 返回下载用的响应体读取器：经过全局限速，单次读取超过 readTimeout 时调用 cancel 取消请求
+// 计时只包住对响应体的 Read，限速器的等待不计入
+func (c *Client) downloadBody(resp *http.Response, cancel context.CancelFunc) io.Reader {
+	return c.limiter.Reader(resp.Request.Context(), &stallReader{r: resp.Body, timeout: c.readTimeout, cancel: cancel})
+}
+
+// stallReader 单次读取超时的读取器：超时后取消请求，把随之而来的错误换成 ErrReadTimeout
+type stallReader struct {
+	r       io.Reader
+	timeout time.Duration
+	cancel  context.CancelFunc
+
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.timeout, func() {
+			s.stalled.Store(true)
+			s.cancel()
+		})
+	} else {
+		s.timer.Reset(s.timeout)
+	}
+	n, err := s.r.Read(p)
+	s.timer.Stop()
+	if err != nil && s.stalled.Load() {
+		err = fmt.Errorf("%w（%s 内没有收到数据）", ErrReadTimeout, s.timeout)
+	}
+	return n, err
+}
+
+// Limiter 返回全局限速器，未配置时为 nil
+func (c *Client) Limiter() *RateLimiter {
+	return c.limiter
+}
+
+// copyBody 把响应体写入 w
+// 256KB 缓冲区，与 PowerShell 的 `New-Object byte[] 256KB` 一致
+func copyBody(w io.Writer, body io.Reader) error {
+	buf := make([]byte, 256*1024)
+	_, err := io.CopyBuffer(w, body, buf)
+	return err
 }
 
 // lastModTime 从 HTTP 响应中解析 Last-Modified 头
@@ -0,0 +1,211 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPayload = bytes.Repeat([]byte("0123456789abcdef"), 4096) // 64KB
+
+var testModTime = time.Date(2025, 1, 12, 8, 0, 0, 0, time.UTC)
+
+// rangeServer serves testPayload with Range/If-Range support via http.ServeContent
+func rangeServer(etag string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		http.ServeContent(w, r, "pkg", testModTime, bytes.NewReader(testPayload))
+	}))
+}
+
+func writePartial(t *testing.T, n int) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "partial.pkg")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(testPayload[:n]); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func fileContent(t *testing.T, f *os.File) []byte {
+	t.Helper()
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestHeadReturnsETag(t *testing.T) {
+	srv := rangeServer(`"abc123"`)
+	defer srv.Close()
+
+	c := mustNewClient(t, Options{})
+	remote, err := c.Head(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.Size != int64(len(testPayload)) {
+		t.Errorf("Size = %d, want %d", remote.Size, len(testPayload))
+	}
+	if remote.ETag != `"abc123"` {
+		t.Errorf("ETag = %q", remote.ETag)
+	}
+	if !remote.LastMod.Equal(testModTime) {
+		t.Errorf("LastMod = %v, want %v", remote.LastMod, testModTime)
+	}
+}
+
+func TestDownloadResumeAppendsPartialContent(t *testing.T) {
+	srv := rangeServer(`"abc123"`)
+	defer srv.Close()
+
+	f := writePartial(t, 10000)
+	c := mustNewClient(t, Options{})
+	res, err := c.DownloadResume(context.Background(), srv.URL, f, 10000, `"abc123"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Resumed {
+		t.Error("Resumed = false, want true")
+	}
+	if !bytes.Equal(fileContent(t, f), testPayload) {
+		t.Error("resumed file content does not match payload")
+	}
+}
+
+func TestDownloadResumeValidatorMismatchRestarts(t *testing.T) {
+	srv := rangeServer(`"new-etag"`)
+	defer srv.Close()
+
+	// Partial data from an older version of the file
+	f := writePartial(t, 10000)
+	if _, err := f.WriteAt([]byte(strings.Repeat("X", 10000)), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	c := mustNewClient(t, Options{})
+	res, err := c.DownloadResume(context.Background(), srv.URL, f, 10000, `"old-etag"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Resumed {
+		t.Error("Resumed = true, want full download after If-Range mismatch")
+	}
+	if !bytes.Equal(fileContent(t, f), testPayload) {
+		t.Error("file content does not match payload after full download")
+	}
+}
+
+func TestDownloadResumeServerIgnoresRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testPayload)
+	}))
+	defer srv.Close()
+
+	f := writePartial(t, 10000)
+	c := mustNewClient(t, Options{})
+	res, err := c.DownloadResume(context.Background(), srv.URL, f, 10000, `"abc123"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Resumed {
+		t.Error("Resumed = true, want false when server ignores Range")
+	}
+	if !bytes.Equal(fileContent(t, f), testPayload) {
+		t.Error("file content does not match payload")
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"bytes 100-199/200", 100, false},
+		{"bytes 0-0/1", 0, false},
+		{"items 1-2/3", 0, true},
+		{"bytes */200", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := contentRangeStart(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("contentRangeStart(%q) = %d, %v; want %d, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// trickleServer sends testPayload in 8KB chunks with a pause between them
+func trickleServer(pause time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(testPayload)))
+		for chunk := range slices.Chunk(testPayload, 8192) {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(pause):
+			}
+		}
+	}))
+}
+
+func TestDownloadHasNoOverallTimeout(t *testing.T) {
+	srv := trickleServer(20 * time.Millisecond) // ~160ms in total
+	defer srv.Close()
+	c := mustNewClient(t, Options{MetadataTimeout: 50 * time.Millisecond, ReadTimeout: time.Second})
+
+	f := writePartial(t, 0)
+	if _, err := c.DownloadResume(context.Background(), srv.URL, f, 0, ""); err != nil {
+		t.Fatalf("slow download should not hit the metadata timeout: %v", err)
+	}
+	if !bytes.Equal(fileContent(t, f), testPayload) {
+		t.Error("file content does not match payload")
+	}
+
+	// Metadata requests keep an overall timeout.
+	if _, _, err := c.Fetch(context.Background(), srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Fetch error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestDownloadResumeStalledBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(testPayload)))
+		w.Write(testPayload[:10000])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	c := mustNewClient(t, Options{ReadTimeout: 50 * time.Millisecond})
+
+	f := writePartial(t, 0)
+	_, err := c.DownloadResume(context.Background(), srv.URL, f, 0, "")
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("DownloadResume error = %v, want ErrReadTimeout", err)
+	}
+	if !IsRetryable(err) {
+		t.Error("a stalled download should be retryable")
+	}
+	if got := fileContent(t, f); !bytes.Equal(got, testPayload[:10000]) {
+		t.Errorf("kept %d bytes, want the 10000 received before the stall", len(got))
+	}
+}
@@ -0,0 +1,88 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPError 上游返回非预期状态码
+// 携带状态码和 Retry-After，供重试逻辑和熔断器判断如何处理
+type HTTPError struct {
+	StatusCode int
+	URL        string
+	RetryAfter time.Duration // 服务器要求的等待时间，没有 Retry-After 头时为 0
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP %d for %s", e.StatusCode, e.URL)
+}
+
+// Throttled 是否是上游限流（429 / 503）
+func (e *HTTPError) Throttled() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+}
+
+// newHTTPError 从响应构建 HTTPError
+func newHTTPError(resp *http.Response) *HTTPError {
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		URL:        resp.Request.URL.String(),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter 解析 Retry-After：秒数或 HTTP 日期
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// IsRetryable 判断错误是否值得重试
+// 404 / 403 等客户端错误重试也不会成功；5xx、429、408、超时和连接错误可以重试；
+// 上下文取消不重试
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var he *HTTPError
+	if errors.As(err, &he) {
+		switch he.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+			return true
+		}
+		return he.StatusCode >= 500
+	}
+	// 网络错误、超时、响应体中断等
+	return true
+}
+
+// RetryAfterOf 返回错误中携带的 Retry-After，没有时返回 0
+func RetryAfterOf(err error) time.Duration {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"404", &HTTPError{StatusCode: 404}, false},
+		{"403", &HTTPError{StatusCode: 403}, false},
+		{"400", &HTTPError{StatusCode: 400}, false},
+		{"408", &HTTPError{StatusCode: 408}, true},
+		{"429", &HTTPError{StatusCode: 429}, true},
+		{"500", &HTTPError{StatusCode: 500}, true},
+		{"503 wrapped", fmt.Errorf("bytes 0-1: %w", &HTTPError{StatusCode: 503}), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 12, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPErrorMessageAndRetryAfter(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &HTTPError{StatusCode: 429, URL: "https://cdn/a.pkg", RetryAfter: 7 * time.Second})
+	if RetryAfterOf(err) != 7*time.Second {
+		t.Errorf("RetryAfterOf = %v, want 7s", RetryAfterOf(err))
+	}
+	var he *HTTPError
+	if !errors.As(err, &he) || he.Error() != "HTTP 429 for https://cdn/a.pkg" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	if RetryAfterOf(io.EOF) != 0 {
+		t.Error("RetryAfterOf(non-HTTP error) should be 0")
+	}
+}
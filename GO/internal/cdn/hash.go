@@ -0,0 +1,106 @@
+package cdn
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// ErrNoManifestHash 清单没有给出可用于校验的哈希
+var ErrNoManifestHash = errors.New("清单未提供哈希")
+
+// Digests 下载内容的摘要
+// SHA-256 总是计算；SHA-1 是 MAU 清单 Hash 字段常用的算法，一并计算以便直接比对
+type Digests struct {
+	SHA1   []byte
+	SHA256 []byte
+}
+
+// Hasher 边下载边计算摘要，作为 io.Writer 与目标文件一起写入
+type Hasher struct {
+	sha1   hash.Hash
+	sha256 hash.Hash
+}
+
+// NewHasher 创建摘要计算器
+func NewHasher() *Hasher {
+	return &Hasher{sha1: sha1.New(), sha256: sha256.New()}
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.sha1.Write(p)
+	h.sha256.Write(p)
+	return len(p), nil
+}
+
+// Sum 返回当前的摘要
+func (h *Hasher) Sum() Digests {
+	return Digests{SHA1: h.sha1.Sum(nil), SHA256: h.sha256.Sum(nil)}
+}
+
+// HashFile 计算文件的摘要（分段下载的各段乱序到达，只能在完成后整体计算）
+func HashFile(path string) (Digests, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Digests{}, err
+	}
+	defer f.Close()
+	h := NewHasher()
+	if _, err := io.Copy(h, f); err != nil {
+		return Digests{}, err
+	}
+	return h.Sum(), nil
+}
+
+// HashMismatchError 下载内容与清单中的哈希不一致
+type HashMismatchError struct {
+	File      string
+	Algorithm string // SHA-1 / SHA-256
+	Want      []byte
+	Got       []byte
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("%s 的 %s 与清单不一致: 期望 %s，实际 %s",
+		e.File, e.Algorithm, hex.EncodeToString(e.Want), hex.EncodeToString(e.Got))
+}
+
+// VerifyDigests 用清单中的哈希校验下载内容
+// 显式的 SHA256 字段优先；Hash 字段按长度判断算法（20 字节 SHA-1，32 字节 SHA-256），
+// 其他长度视为未知算法。清单没有可用的哈希时返回 ErrNoManifestHash
+func (p Package) VerifyDigests(d Digests) error {
+	checked := false
+	check := func(algo string, want, got []byte) error {
+		checked = true
+		if !bytes.Equal(want, got) {
+			return &HashMismatchError{File: p.FileName, Algorithm: algo, Want: want, Got: got}
+		}
+		return nil
+	}
+
+	if len(p.SHA256) == sha256.Size {
+		if err := check("SHA-256", p.SHA256, d.SHA256); err != nil {
+			return err
+		}
+	}
+	switch len(p.Hash) {
+	case sha1.Size:
+		if err := check("SHA-1", p.Hash, d.SHA1); err != nil {
+			return err
+		}
+	case sha256.Size:
+		if err := check("SHA-256", p.Hash, d.SHA256); err != nil {
+			return err
+		}
+	}
+	if !checked {
+		return ErrNoManifestHash
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestVerifyDigests(t *testing.T) {
+	data := []byte("package body")
+	s1, s256 := sha1.Sum(data), sha256.Sum256(data)
+	h := NewHasher()
+	h.Write(data)
+	sums := h.Sum()
+
+	tests := []struct {
+		name    string
+		pkg     Package
+		wantErr error
+	}{
+		{"sha1 hash", Package{Hash: s1[:]}, nil},
+		{"sha256 hash", Package{Hash: s256[:]}, nil},
+		{"explicit sha256", Package{SHA256: s256[:]}, nil},
+		{"no hash", Package{}, ErrNoManifestHash},
+		{"unknown hash length", Package{Hash: []byte{1, 2, 3}}, ErrNoManifestHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.pkg.VerifyDigests(sums); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyDigests = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	bad := s256
+	bad[0] ^= 0xff
+	// A matching SHA-1 does not hide a mismatching explicit SHA-256.
+	err := Package{FileName: "a.pkg", Hash: s1[:], SHA256: bad[:]}.VerifyDigests(sums)
+	var mismatch *HashMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Algorithm != "SHA-256" {
+		t.Errorf("VerifyDigests = %v, want SHA-256 mismatch", err)
+	}
+}
+
+func TestDownloadResumeDigestsCoverWholeFile(t *testing.T) {
+	srv := rangeServer(`"abc123"`)
+	defer srv.Close()
+	want := sha256.Sum256(testPayload)
+	c := mustNewClient(t, Options{})
+
+	// Resumed: the digest includes the bytes already on disk.
+	f := writePartial(t, 10000)
+	res, err := c.DownloadResume(context.Background(), srv.URL, f, 10000, `"abc123"`)
+	if err != nil || !res.Resumed {
+		t.Fatalf("DownloadResume = %+v, %v", res, err)
+	}
+	if !bytes.Equal(res.Digests.SHA256, want[:]) {
+		t.Error("resumed download digest does not cover the whole file")
+	}
+
+	// Restarted after an If-Range mismatch: the old prefix must not leak into the digest.
+	f = writePartial(t, 10000)
+	res, err = c.DownloadResume(context.Background(), srv.URL, f, 10000, `"old-etag"`)
+	if err != nil || res.Resumed {
+		t.Fatalf("DownloadResume = %+v, %v", res, err)
+	}
+	if !bytes.Equal(res.Digests.SHA256, want[:]) {
+		t.Error("restarted download digest is wrong")
+	}
+}
@@ -0,0 +1,56 @@
+package cdn
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CompareVersions 按点分的数字段比较版本号（16.9 < 16.10），返回 -1 / 0 / 1
+// 非数字段按字符串比较，段数不同时缺少的段视为 0
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, errX := strconv.ParseUint(x, 10, 64)
+		yn, errY := strconv.ParseUint(y, 10, 64)
+		switch {
+		case errX == nil && errY == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case (errX != nil || errY != nil) && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// RecentHistory 返回除当前版本外最新的 n 个历史版本（从新到旧）
+// 只包含取到了清单的版本（HistoricPackages 中有记录），n <= 0 时返回 nil
+func (a *AppInfo) RecentHistory(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	var versions []string
+	for v := range a.HistoricPackages {
+		if v != a.Version {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return CompareVersions(versions[i], versions[j]) > 0 })
+	if len(versions) > n {
+		versions = versions[:n]
+	}
+	return versions
+}
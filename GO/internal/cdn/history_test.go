@@ -0,0 +1,53 @@
+package cdn
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"16.93.25011212", "16.93.25011212", 0},
+		{"16.9.1", "16.10.1", -1},
+		{"16.93.25011212", "16.92.24120731", 1},
+		{"16.93", "16.93.0", 0},
+		{"16.93.1", "16.93", 1},
+		{"Legacy", "16.93", 1},
+	}
+	for _, c := range cases {
+		if got := CompareVersions(c.a, c.b); got != c.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestRecentHistory(t *testing.T) {
+	app := AppInfo{
+		Version: "16.93.25011212",
+		HistoricVersions: []string{
+			"16.89.24091630", "16.90.24101329", "16.91.24111020", "16.92.24120731", "16.93.25011212", "16.88.24081116",
+		},
+		HistoricPackages: map[string][]Package{
+			"16.88.24081116": nil,
+			"16.89.24091630": nil,
+			// 16.90 manifest could not be fetched
+			"16.91.24111020": nil,
+			"16.92.24120731": nil,
+			"16.93.25011212": nil,
+		},
+	}
+	got := app.RecentHistory(3)
+	want := []string{"16.92.24120731", "16.91.24111020", "16.89.24091630"}
+	if !slices.Equal(got, want) {
+		t.Errorf("RecentHistory(3) = %v, want %v", got, want)
+	}
+	if got := app.RecentHistory(0); got != nil {
+		t.Errorf("RecentHistory(0) = %v, want nil", got)
+	}
+	if got := app.RecentHistory(10); len(got) != 4 {
+		t.Errorf("RecentHistory(10) = %v, want all 4 other versions", got)
+	}
+}
@@ -0,0 +1,169 @@
+package cdn
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PackageKind 包的类型
+type PackageKind string
+
+const (
+	PackageFull   PackageKind = "full"   // 完整安装包（Location 非 delta，或 FullUpdaterLocation）
+	PackageDelta  PackageKind = "delta"  // 增量包，只能从 FromVersion 升级
+	PackageBinary PackageKind = "binary" // 二进制差分更新器（BinaryUpdaterLocation）
+)
+
+// DeltaPattern delta 包文件名中的版本对：xxx_16.90.24121212_to_16.93.25011212_xxx.pkg
+// 对应 Get-MAUCacheDownloadJobs.ps1 第 52 行: $pattern = '.*?([\d.]+)_to_([\d.]+).*'
+var DeltaPattern = regexp.MustCompile(`([\d.]+)_to_([\d.]+)`)
+
+// Package 清单（AppID.xml / AppID_版本.xml）中一个可下载的包
+// 一个清单 dict 可以同时给出 Location、FullUpdaterLocation、BinaryUpdaterLocation，
+// 每个 URL 各对应一个 Package，共享 dict 中的版本、标题、触发条件等信息
+type Package struct {
+	Kind     PackageKind
+	Location string // 下载 URL
+	FileName string // URL 的文件名，即缓存目录中的文件名
+
+	UpdateVersion   string    // Update Version
+	ShortVersion    string    // Short Version String
+	BaselineVersion string    // Baseline Version
+	FromVersion     string    // 增量包的起始版本，取自文件名中的版本对（xxx_{起始}_to_{目标}），空表示不限起始版本
+	Title           string    // Title
+	Date            time.Time // Date
+	MinimumOS       string    // Minimum OS
+
+	// Size 清单给出的文件大小，0 表示未知
+	// Location 取 Size（或 File Size）/ FullUpdaterLocation 取 FullUpdaterSize / BinaryUpdaterLocation 取 BinaryUpdaterSize
+	Size int64
+	// Hash 清单中的哈希（解码后的字节，按长度区分 SHA-1 / SHA-256），SHA256 为显式的 SHA-256
+	Hash   []byte
+	SHA256 []byte
+
+	// 触发条件原样保留，供报告使用
+	TriggerCondition []interface{}          // Trigger Condition
+	Triggers         map[string]interface{} // Triggers
+}
+
+// packageLocations 清单 dict 中的下载 URL 字段，以及对应大小 / 哈希字段的前缀
+var packageLocations = []struct {
+	key    string
+	prefix string
+	kind   PackageKind
+}{
+	{"Location", "", ""}, // 类型由文件名判断
+	{"BinaryUpdaterLocation", "BinaryUpdater", PackageBinary},
+	{"FullUpdaterLocation", "FullUpdater", PackageFull},
+}
+
+// packagesFromDict 把清单中的一个 dict 转成 Package 列表
+// 字段类型按容错方式读取：数字可能写成 string，哈希可能是 data / base64 / hex
+func packagesFromDict(m map[string]interface{}) []Package {
+	base := Package{
+		UpdateVersion:   dictString(m, "Update Version"),
+		ShortVersion:    dictString(m, "Short Version String"),
+		BaselineVersion: dictString(m, "Baseline Version"),
+		Title:           dictString(m, "Title"),
+		MinimumOS:       dictString(m, "Minimum OS"),
+	}
+	if t, ok := m["Date"].(time.Time); ok {
+		base.Date = t
+	}
+	base.TriggerCondition, _ = m["Trigger Condition"].([]interface{})
+	base.Triggers, _ = m["Triggers"].(map[string]interface{})
+
+	var out []Package
+	for _, loc := range packageLocations {
+		uri := dictString(m, loc.key)
+		if uri == "" {
+			continue
+		}
+		p := base
+		p.Location = uri
+		p.FileName = path.Base(uri)
+		p.Kind = loc.kind
+		p.Size = dictInt(m, loc.prefix+"Size")
+		if p.Size == 0 && loc.prefix == "" {
+			p.Size = dictInt(m, "File Size")
+		}
+		p.Hash = dictHash(m, loc.prefix+"Hash")
+		p.SHA256 = dictHash(m, loc.prefix+"SHA256")
+
+		if match := DeltaPattern.FindStringSubmatch(p.FileName); match != nil {
+			// 二进制更新器也可能只适用于某个起始版本，保留类型但记录起始版本
+			p.FromVersion = match[1]
+			if p.Kind != PackageBinary {
+				p.Kind = PackageDelta
+			}
+		} else if p.Kind == "" {
+			p.Kind = PackageFull
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// PackageURIs 返回去重后的下载 URL，保持清单顺序
+func PackageURIs(pkgs []Package) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, p := range pkgs {
+		if p.Location != "" && !seen[p.Location] {
+			seen[p.Location] = true
+			result = append(result, p.Location)
+		}
+	}
+	return result
+}
+
+// dictString 读取字符串字段，数字按十进制转成字符串
+func dictString(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	}
+	return ""
+}
+
+// dictInt 读取整数字段，兼容写成 string 的数字；缺失或无效时返回 0
+func dictInt(m map[string]interface{}, key string) int64 {
+	switch v := m[key].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n
+	}
+	return 0
+}
+
+// dictHash 读取哈希字段：data 直接使用，string 先按十六进制（40 / 64 位）再按 base64 解码
+func dictHash(m map[string]interface{}, key string) []byte {
+	switch v := m[key].(type) {
+	case []byte:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		if len(s) == 40 || len(s) == 64 {
+			if b, err := hex.DecodeString(s); err == nil {
+				return b
+			}
+		}
+		if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) > 0 {
+			return b
+		}
+	}
+	return nil
+}
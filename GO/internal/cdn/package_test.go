@@ -0,0 +1,74 @@
+package cdn
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPackagesFromDict(t *testing.T) {
+	sha1 := bytes.Repeat([]byte{0xab}, 20)
+	m := map[string]interface{}{
+		"Location":              "https://cdn/pr/x/Microsoft_Word_16.93.25011212_Updater.pkg",
+		"FullUpdaterLocation":   "https://cdn/pr/x/Microsoft_Word_16.93.25011212_Installer.pkg",
+		"BinaryUpdaterLocation": "https://cdn/pr/x/Word_16.92.1_to_16.93.25011212_Binary.pkg",
+		"Update Version":        "16.93.25011212",
+		"Title":                 "Word",
+		"Minimum OS":            "12.0",
+		"Date":                  time.Date(2025, 1, 12, 0, 0, 0, 0, time.UTC),
+		"Size":                  int64(100),
+		"FullUpdaterSize":       "200",
+		"Hash":                  "q6urq6urq6urq6urq6urq6urq6s=", // base64
+		"FullUpdaterSHA256":     "0000000000000000000000000000000000000000000000000000000000000001",
+		"BinaryUpdaterHash":     sha1,
+		"Trigger Condition":     []interface{}{"and", "x"},
+		"Triggers":              map[string]interface{}{"Registered File": map[string]interface{}{}},
+	}
+	pkgs := packagesFromDict(m)
+	if len(pkgs) != 3 {
+		t.Fatalf("got %d packages, want 3", len(pkgs))
+	}
+	loc, binary, full := pkgs[0], pkgs[1], pkgs[2]
+
+	if loc.Kind != PackageFull || loc.Size != 100 || !bytes.Equal(loc.Hash, sha1) {
+		t.Errorf("Location package = %+v", loc)
+	}
+	if loc.FileName != "Microsoft_Word_16.93.25011212_Updater.pkg" || loc.Title != "Word" || loc.MinimumOS != "12.0" {
+		t.Errorf("Location metadata = %+v", loc)
+	}
+	if loc.Date.IsZero() || len(loc.TriggerCondition) != 2 || loc.Triggers == nil {
+		t.Errorf("Location date / triggers = %+v", loc)
+	}
+	if full.Kind != PackageFull || full.Size != 200 || len(full.SHA256) != 32 || full.Hash != nil {
+		t.Errorf("FullUpdater package = %+v", full)
+	}
+	if binary.Kind != PackageBinary || binary.FromVersion != "16.92.1" || !bytes.Equal(binary.Hash, sha1) {
+		t.Errorf("BinaryUpdater package = %+v", binary)
+	}
+}
+
+func TestDeltaFromVersionPrefersFileName(t *testing.T) {
+	pkgs := packagesFromDict(map[string]interface{}{
+		"Location":         "https://cdn/pr/x/Word_16.92_to_16.93_Delta.pkg",
+		"Baseline Version": "16.90",
+	})
+	if len(pkgs) != 1 || pkgs[0].Kind != PackageDelta || pkgs[0].FromVersion != "16.92" {
+		t.Errorf("file name should win: %+v", pkgs)
+	}
+
+	// Baseline Version alone does not turn a full package into a delta.
+	pkgs = packagesFromDict(map[string]interface{}{
+		"Location":         "https://cdn/pr/x/Word_Updater.pkg",
+		"Baseline Version": "16.90",
+	})
+	if pkgs[0].Kind != PackageFull || pkgs[0].FromVersion != "" {
+		t.Errorf("full package should not get a start version: %+v", pkgs[0])
+	}
+}
+
+func TestPackageURIsDeduplicates(t *testing.T) {
+	got := PackageURIs([]Package{{Location: "a"}, {Location: "b"}, {Location: "a"}, {}})
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("PackageURIs = %v", got)
+	}
+}
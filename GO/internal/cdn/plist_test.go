@@ -1,7 +1,10 @@
 package cdn
 
 import (
+	"strings"
 	"testing"
+
+	"maucache/internal/plist"
 )
 
 func TestParsePlistPackages(t *testing.T) {
@@ -33,16 +36,27 @@ func TestParsePlistPackages(t *testing.T) {
 		t.Fatalf("ParsePlistPackages failed: %v", err)
 	}
 
-	uris := pkgs.AllURIs()
+	uris := PackageURIs(pkgs)
 	if len(uris) != 3 {
 		t.Errorf("expected 3 unique URIs, got %d: %v", len(uris), uris)
 	}
 
-	if len(pkgs.Versions) != 2 {
-		t.Errorf("expected 2 versions, got %d", len(pkgs.Versions))
+	for _, p := range pkgs {
+		if p.UpdateVersion != "16.93.25011212" {
+			t.Errorf("expected version 16.93.25011212, got %s", p.UpdateVersion)
+		}
+	}
+	if pkgs[0].Size != 1048576000 {
+		t.Errorf("expected size 1048576000 from File Size, got %d", pkgs[0].Size)
+	}
+	kinds := []PackageKind{PackageFull, PackageDelta, PackageBinary}
+	for i, k := range kinds {
+		if pkgs[i].Kind != k {
+			t.Errorf("pkgs[%d].Kind = %s, want %s", i, pkgs[i].Kind, k)
+		}
 	}
-	if pkgs.Versions[0] != "16.93.25011212" {
-		t.Errorf("expected version 16.93.25011212, got %s", pkgs.Versions[0])
+	if pkgs[1].FromVersion != "16.92" {
+		t.Errorf("delta FromVersion = %q, want 16.92", pkgs[1].FromVersion)
 	}
 }
 
@@ -156,3 +170,52 @@ func TestParsePlistEmptyInput(t *testing.T) {
 		t.Errorf("expected unknown for empty input, got %s", version)
 	}
 }
+
+func TestParsePlistPackagesReportsErrors(t *testing.T) {
+	// Root must be an array of dicts; a dict root is no longer guessed at.
+	if _, err := ParsePlistPackages(`<plist><dict><key>Location</key><string>x</string></dict></plist>`); err == nil {
+		t.Error("expected error for dict root")
+	}
+	_, err := ParsePlistPackages("<plist>\n<array>\n<dict>\n<key>Location</key>\n</dict>\n</array>\n</plist>")
+	if err == nil || !strings.Contains(err.Error(), "第 5 行") {
+		t.Errorf("expected syntax error with line number, got %v", err)
+	}
+}
+
+func TestParsePlistPackagesIgnoresRichValues(t *testing.T) {
+	xmlStr := `<plist version="1.0"><array><dict>
+<key>Location</key><string>https://officecdnmac.microsoft.com/pr/xxx/a.pkg</string>
+<key>Date</key><date>2025-01-12T00:00:00Z</date>
+<key>Triggers</key><dict><key>Registered File</key><dict><key>VersionString</key><string>16.0</string></dict></dict>
+<key>Hash</key><data>AAEC</data>
+<key>Update Version</key><string>16.93.25011212</string>
+</dict></array></plist>`
+	pkgs, err := ParsePlistPackages(xmlStr)
+	if err != nil {
+		t.Fatalf("ParsePlistPackages failed: %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].UpdateVersion != "16.93.25011212" {
+		t.Errorf("got %+v", pkgs)
+	}
+}
+
+func TestParsePlistAcceptsBinary(t *testing.T) {
+	bin, err := plist.MarshalFormat([]map[string]string{
+		{"Location": "https://officecdnmac.microsoft.com/pr/xxx/a.pkg", "Update Version": "16.93.25011212"},
+	}, plist.BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := ParsePlistPackages(string(bin))
+	if err != nil {
+		t.Fatalf("ParsePlistPackages(binary) failed: %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].UpdateVersion != "16.93.25011212" {
+		t.Errorf("got %+v", pkgs)
+	}
+
+	hist, _ := plist.MarshalFormat([]string{"16.91", "16.92"}, plist.BinaryFormat)
+	if v := ParsePlistStringArray(string(hist)); len(v) != 2 {
+		t.Errorf("ParsePlistStringArray(binary) = %v", v)
+	}
+}
@@ -0,0 +1,169 @@
+package cdn
+
+import (
+	"context"
+	"io"
+	gosync "sync"
+	"time"
+)
+
+// RateLimiter 全局令牌桶限速器，所有下载 worker 和编录请求共用一个实例
+// 速率可在运行中调整（时段调度），0 表示不限速
+type RateLimiter struct {
+	mu     gosync.Mutex
+	rate   int64   // 字节/秒，<=0 不限速
+	tokens float64 // 当前令牌数，可为负（表示已预支，需要等待）
+	last   time.Time
+
+	meter rateMeter
+}
+
+// NewRateLimiter 创建限速器，bytesPerSec<=0 表示不限速
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	l := &RateLimiter{last: time.Now()}
+	l.SetRate(bytesPerSec)
+	return l
+}
+
+// SetRate 调整限速值，立即对所有正在进行的下载生效
+func (l *RateLimiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate = bytesPerSec
+	if l.tokens > l.burst() {
+		l.tokens = l.burst()
+	}
+}
+
+// Limit 返回当前限速值（字节/秒），0 表示不限速
+func (l *RateLimiter) Limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate < 0 {
+		return 0
+	}
+	return l.rate
+}
+
+// CurrentRate 返回最近几秒实际的聚合吞吐（字节/秒）
+func (l *RateLimiter) CurrentRate() int64 {
+	return l.meter.rate(time.Now())
+}
+
+// Wait 消耗 n 字节的令牌，令牌不足时阻塞到足够为止
+// 采用预支方式：先扣减，再按欠额休眠，多个 worker 并发调用时总速率仍受控
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	now := time.Now()
+	l.meter.add(now, n)
+
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.refill(now)
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// refill 按流逝时间补充令牌，调用方需持有锁
+func (l *RateLimiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if l.tokens > l.burst() {
+			l.tokens = l.burst()
+		}
+	}
+	l.last = now
+}
+
+// burst 令牌桶容量：1 秒的流量
+func (l *RateLimiter) burst() float64 {
+	return float64(l.rate)
+}
+
+// Reader 包装 r，每次读取后按读到的字节数消耗令牌
+// l 为 nil 时原样返回 r
+func (l *RateLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, l: l}
+}
+
+// limitedReader 限速读取器
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *RateLimiter
+}
+
+// limitedReadChunk 单次读取上限，避免一次读取 256KB 后长时间休眠造成速率抖动
+const limitedReadChunk = 32 * 1024
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limitedReadChunk {
+		p = p[:limitedReadChunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := lr.l.Wait(lr.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// rateMeterWindow 吞吐统计窗口（秒）
+const rateMeterWindow = 5
+
+// rateMeter 按秒分桶统计最近几秒的字节数
+type rateMeter struct {
+	mu      gosync.Mutex
+	buckets [rateMeterWindow + 1]int64
+	seconds [rateMeterWindow + 1]int64
+}
+
+// add 记录 n 字节
+func (m *rateMeter) add(now time.Time, n int) {
+	sec := now.Unix()
+	i := sec % int64(len(m.buckets))
+	m.mu.Lock()
+	if m.seconds[i] != sec {
+		m.seconds[i] = sec
+		m.buckets[i] = 0
+	}
+	m.buckets[i] += int64(n)
+	m.mu.Unlock()
+}
+
+// rate 返回最近 rateMeterWindow 个完整秒的平均速率（不含当前未结束的一秒）
+func (m *rateMeter) rate(now time.Time) int64 {
+	cur := now.Unix()
+	var total int64
+	m.mu.Lock()
+	for i := range m.buckets {
+		if sec := m.seconds[i]; sec < cur && sec >= cur-rateMeterWindow {
+			total += m.buckets[i]
+		}
+	}
+	m.mu.Unlock()
+	return total / rateMeterWindow
+}
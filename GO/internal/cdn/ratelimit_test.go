@@ -0,0 +1,96 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := NewRateLimiter(0)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := l.Wait(context.Background(), 1<<20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("unlimited limiter should not block")
+	}
+	if l.Limit() != 0 {
+		t.Errorf("Limit() = %d, want 0", l.Limit())
+	}
+}
+
+func TestRateLimiterThrottlesReader(t *testing.T) {
+	// 64KB/s with a 64KB burst: reading 192KB takes roughly 2 seconds
+	l := NewRateLimiter(64 * 1024)
+	data := bytes.Repeat([]byte("x"), 192*1024)
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, l.Reader(context.Background(), bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if n != int64(len(data)) {
+		t.Fatalf("copied %d bytes, want %d", n, len(data))
+	}
+	if elapsed < 1500*time.Millisecond || elapsed > 4*time.Second {
+		t.Errorf("elapsed = %v, want about 2s", elapsed)
+	}
+}
+
+func TestRateLimiterWaitHonoursContext(t *testing.T) {
+	l := NewRateLimiter(1024)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_ = l.Wait(ctx, 1024) // drains the burst
+	if err := l.Wait(ctx, 1<<20); err == nil {
+		t.Error("Wait should return the context error")
+	}
+}
+
+func TestRateLimiterSetRate(t *testing.T) {
+	l := NewRateLimiter(1024)
+	l.SetRate(0)
+	start := time.Now()
+	if err := l.Wait(context.Background(), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Error("Wait should not block after SetRate(0)")
+	}
+	l.SetRate(2048)
+	if l.Limit() != 2048 {
+		t.Errorf("Limit() = %d, want 2048", l.Limit())
+	}
+}
+
+func TestRateMeter(t *testing.T) {
+	var m rateMeter
+	base := time.Unix(1_700_000_000, 0)
+	for i := 0; i < rateMeterWindow; i++ {
+		m.add(base.Add(time.Duration(i)*time.Second), 1000)
+	}
+	// In-progress second is excluded
+	m.add(base.Add(rateMeterWindow*time.Second), 99999)
+
+	if got := m.rate(base.Add(rateMeterWindow * time.Second)); got != 1000 {
+		t.Errorf("rate = %d, want 1000", got)
+	}
+	if got := m.rate(base.Add(time.Hour)); got != 0 {
+		t.Errorf("rate after idle = %d, want 0", got)
+	}
+}
+
+func TestNilRateLimiterReader(t *testing.T) {
+	var l *RateLimiter
+	r := bytes.NewReader([]byte("abc"))
+	if l.Reader(context.Background(), r) != io.Reader(r) {
+		t.Error("nil limiter should return the original reader")
+	}
+}
@@ -0,0 +1,51 @@
+package cdn
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// RetryPolicy 重试策略：最多尝试 Max 次，第 n 次重试前等待 2^n × Delay
+// 与包下载（sync.downloadOneFile）使用同一套退避规则；上游给出 Retry-After 时至少等待该时长
+type RetryPolicy struct {
+	Max   int           // 最多尝试次数（含第一次），<=0 按 1 处理
+	Delay time.Duration // 退避基数
+}
+
+// attempts 返回最多尝试次数
+func (p RetryPolicy) attempts() int {
+	if p.Max <= 0 {
+		return 1
+	}
+	return p.Max
+}
+
+// Backoff 返回第 attempt 次重试（从 1 开始）前应等待的时长
+func (p RetryPolicy) Backoff(attempt int, lastErr error) time.Duration {
+	backoff := time.Duration(math.Pow(2, float64(attempt))) * p.Delay
+	if ra := RetryAfterOf(lastErr); ra > backoff {
+		backoff = ra
+	}
+	return backoff
+}
+
+// Do 按策略执行 fn，直到成功、遇到不可重试的错误或次数用尽
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < p.attempts(); attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(p.Backoff(attempt, err))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if err = fn(); err == nil || !IsRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
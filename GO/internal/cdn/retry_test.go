@@ -0,0 +1,100 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Max: 3, Delay: time.Second}
+	if got := p.Backoff(1, nil); got != 2*time.Second {
+		t.Errorf("Backoff(1) = %v, want 2s", got)
+	}
+	if got := p.Backoff(2, nil); got != 4*time.Second {
+		t.Errorf("Backoff(2) = %v, want 4s", got)
+	}
+	ra := &HTTPError{StatusCode: 429, RetryAfter: time.Minute}
+	if got := p.Backoff(1, ra); got != time.Minute {
+		t.Errorf("Backoff with Retry-After = %v, want 1m", got)
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := RetryPolicy{Max: 3, Delay: time.Millisecond}
+	ctx := context.Background()
+
+	calls := 0
+	err := p.Do(ctx, func() error {
+		calls++
+		return &HTTPError{StatusCode: 404}
+	})
+	if calls != 1 || err == nil {
+		t.Errorf("404: calls = %d, err = %v; want 1 call and an error", calls, err)
+	}
+
+	calls = 0
+	err = p.Do(ctx, func() error {
+		calls++
+		if calls < 3 {
+			return &HTTPError{StatusCode: 503}
+		}
+		return nil
+	})
+	if calls != 3 || err != nil {
+		t.Errorf("503: calls = %d, err = %v; want success on third call", calls, err)
+	}
+
+	calls = 0
+	_ = RetryPolicy{}.Do(ctx, func() error {
+		calls++
+		return errors.New("boom")
+	})
+	if calls != 1 {
+		t.Errorf("zero policy made %d calls, want 1", calls)
+	}
+}
+
+func TestGetStringRetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("16.93.25011212\n"))
+	}))
+	defer srv.Close()
+
+	c := mustNewClient(t, Options{Retry: RetryPolicy{Max: 3, Delay: time.Millisecond}})
+	body, err := c.GetString(context.Background(), srv.URL+"/builds.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(body, "16.93") || calls.Load() != 2 {
+		t.Errorf("body = %q, calls = %d", body, calls.Load())
+	}
+}
+
+func TestGetStringOptionalDistinguishesAbsentFromFailure(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	c := mustNewClient(t, Options{Retry: RetryPolicy{Max: 2, Delay: time.Millisecond}})
+	ctx := context.Background()
+
+	body, err := c.GetStringOptional(ctx, srv.URL+"/0409MSWD2019-history.xml")
+	if err != nil || body != "" {
+		t.Errorf("404: body = %q, err = %v; want empty and nil", body, err)
+	}
+
+	// Connection refused is a failure, not an absent resource
+	url := srv.URL + "/0409MSWD2019-history.xml"
+	srv.Close()
+	if _, err := c.GetStringOptional(ctx, url); err == nil {
+		t.Error("connection failure should be reported as an error")
+	}
+}
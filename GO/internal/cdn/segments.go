@@ -0,0 +1,109 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrRangeNotSupported 服务器不支持 Range，或 If-Range 校验失败（远端文件已变化）
+// 调用方应回退为单连接整文件下载
+var ErrRangeNotSupported = errors.New("服务器不支持分段下载")
+
+// Segment 分段下载中的一个字节区间 [Start, End]，两端都包含
+type Segment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Len 返回区间字节数
+func (s Segment) Len() int64 {
+	return s.End - s.Start + 1
+}
+
+// SplitSegments 把 size 字节的文件均分为 n 段，最后一段包含余数
+func SplitSegments(size int64, n int) []Segment {
+	if size <= 0 || n <= 0 {
+		return nil
+	}
+	if int64(n) > size {
+		n = int(size)
+	}
+	step := size / int64(n)
+	segs := make([]Segment, n)
+	for i := range segs {
+		segs[i].Start = int64(i) * step
+		segs[i].End = segs[i].Start + step - 1
+	}
+	segs[n-1].End = size - 1
+	return segs
+}
+
+// DownloadSegments 并发下载多个区间，按偏移量直接写入 w
+// 每段完成后调用 done(i)（i 为 segs 下标），调用方据此记录进度以便续传；
+// done 可能被并发调用。任意一段返回 200 而不是 206 时返回 ErrRangeNotSupported
+func (c *Client) DownloadSegments(ctx context.Context, url string, w io.WriterAt, segs []Segment, ifRange string, done func(i int)) error {
+	g, gCtx := errgroup.WithContext(ctx)
+	for i, seg := range segs {
+		g.Go(func() error {
+			if err := c.downloadSegment(gCtx, url, w, seg, ifRange); err != nil {
+				return err
+			}
+			if done != nil {
+				done(i)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// downloadSegment 下载单个区间
+func (c *Client) downloadSegment(ctx context.Context, url string, w io.WriterAt, seg Segment, ifRange string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.Start, seg.End))
+	if ifRange != "" {
+		req.Header.Set("If-Range", ifRange)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return ErrRangeNotSupported
+	default:
+		return fmt.Errorf("bytes %d-%d: %w", seg.Start, seg.End, newHTTPError(resp))
+	}
+
+	start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return err
+	}
+	if start != seg.Start {
+		return fmt.Errorf("Content-Range 起点 %d 与请求的 %d 不一致: %s", start, seg.Start, url)
+	}
+
+	ow := io.NewOffsetWriter(w, seg.Start)
+	buf := make([]byte, 256*1024)
+	n, err := io.CopyBuffer(ow, io.LimitReader(c.downloadBody(resp, cancel), seg.Len()), buf)
+	if err != nil {
+		return err
+	}
+	if n != seg.Len() {
+		return fmt.Errorf("分段数据不完整 (bytes %d-%d): 收到 %d 字节: %w", seg.Start, seg.End, n, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
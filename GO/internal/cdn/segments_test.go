@@ -0,0 +1,97 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestSplitSegments(t *testing.T) {
+	tests := []struct {
+		size int64
+		n    int
+		want []Segment
+	}{
+		{100, 4, []Segment{{0, 24}, {25, 49}, {50, 74}, {75, 99}}},
+		{10, 3, []Segment{{0, 2}, {3, 5}, {6, 9}}},
+		{2, 4, []Segment{{0, 0}, {1, 1}}},
+		{0, 4, nil},
+	}
+	for _, tt := range tests {
+		got := SplitSegments(tt.size, tt.n)
+		if len(got) != len(tt.want) {
+			t.Errorf("SplitSegments(%d, %d) = %v, want %v", tt.size, tt.n, got, tt.want)
+			continue
+		}
+		var total int64
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("SplitSegments(%d, %d)[%d] = %v, want %v", tt.size, tt.n, i, got[i], tt.want[i])
+			}
+			total += got[i].Len()
+		}
+		if total != tt.size {
+			t.Errorf("SplitSegments(%d, %d) covers %d bytes", tt.size, tt.n, total)
+		}
+	}
+}
+
+func TestDownloadSegmentsReassemblesFile(t *testing.T) {
+	srv := rangeServer(`"abc123"`)
+	defer srv.Close()
+
+	f, err := os.CreateTemp(t.TempDir(), "seg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(int64(len(testPayload))); err != nil {
+		t.Fatal(err)
+	}
+
+	segs := SplitSegments(int64(len(testPayload)), 5)
+	var (
+		mu   sync.Mutex
+		done []int
+	)
+	c := mustNewClient(t, Options{})
+	err = c.DownloadSegments(context.Background(), srv.URL, f, segs, `"abc123"`, func(i int) {
+		// done may be called concurrently
+		mu.Lock()
+		done = append(done, i)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(segs) {
+		t.Errorf("done called %d times, want %d", len(done), len(segs))
+	}
+	if !bytes.Equal(fileContent(t, f), testPayload) {
+		t.Error("reassembled file does not match payload")
+	}
+}
+
+func TestDownloadSegmentsRangeNotSupported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testPayload)
+	}))
+	defer srv.Close()
+
+	f, err := os.CreateTemp(t.TempDir(), "seg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	c := mustNewClient(t, Options{})
+	err = c.DownloadSegments(context.Background(), srv.URL, f, SplitSegments(int64(len(testPayload)), 2), "", nil)
+	if !errors.Is(err, ErrRangeNotSupported) {
+		t.Errorf("err = %v, want ErrRangeNotSupported", err)
+	}
+}
@@ -0,0 +1,154 @@
+package cdn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TransportOptions 出站连接配置：代理、额外信任的 CA、客户端证书、TLS 最低版本
+// 对应 PowerShell: Set-MAUCacheAdminHttpClientHandler.ps1 中对 HttpClientHandler 的设置
+type TransportOptions struct {
+	ProxyURL      string   // 代理地址，如 http://proxy.corp:3128
+	ProxyUser     string   // 代理用户名（可选）
+	ProxyPassword string   // 代理密码（由调用方从文件或环境变量读出）
+	NoProxy       []string // 不走代理的主机：精确主机名、.后缀、IP、CIDR 或 *
+	CAFiles       []string // 额外信任的 CA PEM 文件（TLS 拦截代理的根证书）
+	ClientCert    string   // 客户端证书 PEM 路径（可选）
+	ClientKey     string   // 客户端私钥 PEM 路径（可选）
+	TLSMinVersion string   // TLS 最低版本：1.0 / 1.1 / 1.2 / 1.3，默认 1.2
+}
+
+// newTransport 按配置构建 http.Transport
+func newTransport(opts TransportOptions) (*http.Transport, error) {
+	tlsCfg, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := newProxyFunc(opts)
+	if err != nil {
+		return nil, err
+	}
+	// 只限制建连、握手和等待响应头；响应体的读取由 Client 按单次读取计时，
+	// 限速下的大文件可以传输任意长的时间
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsCfg,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          20,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       90 * time.Second,
+	}, nil
+}
+
+// newTLSConfig 构建 TLS 配置：系统根证书 + 额外 CA + 可选客户端证书
+func newTLSConfig(opts TransportOptions) (*tls.Config, error) {
+	minVer, err := parseTLSVersion(opts.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{MinVersion: minVer}
+
+	if len(opts.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range opts.CAFiles {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("读取 CA 文件失败: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("CA 文件中没有有效的 PEM 证书: %s", path)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, fmt.Errorf("客户端证书和私钥必须同时配置")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// parseTLSVersion 解析 TLS 版本字符串，空值默认 1.2
+func parseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(v)), "tls") {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("不支持的 TLS 版本: %q", v)
+}
+
+// newProxyFunc 构建代理选择函数
+// 未配置代理时沿用标准环境变量（HTTPS_PROXY / NO_PROXY），与原先行为一致
+func newProxyFunc(opts TransportOptions) (func(*http.Request) (*url.URL, error), error) {
+	if opts.ProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(opts.ProxyURL)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("代理地址无效: %q", opts.ProxyURL)
+	}
+	if opts.ProxyUser != "" {
+		proxyURL.User = url.UserPassword(opts.ProxyUser, opts.ProxyPassword)
+	}
+
+	noProxy := opts.NoProxy
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Hostname(), noProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// bypassProxy 判断主机是否命中 no-proxy 列表
+// 支持：* 全部直连、精确主机名、.example.com / example.com 后缀、IP、CIDR
+func bypassProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "/"):
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && ip != nil && cidr.Contains(ip) {
+				return true
+			}
+		case host == strings.TrimPrefix(entry, "."):
+			return true
+		case strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package cdn
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBypassProxy(t *testing.T) {
+	noProxy := []string{"localhost", ".corp.local", "mirror.example.com", "10.0.0.0/8"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"cache.corp.local", true},
+		{"corp.local", true},
+		{"mirror.example.com", true},
+		{"sub.mirror.example.com", true},
+		{"10.1.2.3", true},
+		{"officecdnmac.microsoft.com", false},
+		{"192.168.1.1", false},
+		{"notcorp.local", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := bypassProxy(tt.host, noProxy); got != tt.want {
+				t.Errorf("bypassProxy(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+
+	if !bypassProxy("anything", []string{"*"}) {
+		t.Error("* should bypass every host")
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint16
+		wantErr bool
+	}{
+		{"", tls.VersionTLS12, false},
+		{"1.2", tls.VersionTLS12, false},
+		{"TLS1.3", tls.VersionTLS13, false},
+		{"1.0", tls.VersionTLS10, false},
+		{"2.0", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseTLSVersion(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTLSVersion(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseTLSVersion(%q) = %x, want %x", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientRejectsBadTransportOptions(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts TransportOptions
+	}{
+		{"missing CA file", TransportOptions{CAFiles: []string{filepath.Join(dir, "missing.pem")}}},
+		{"CA file without PEM", TransportOptions{CAFiles: []string{notPEM}}},
+		{"cert without key", TransportOptions{ClientCert: notPEM}},
+		{"bad TLS version", TransportOptions{TLSMinVersion: "9"}},
+		{"bad proxy URL", TransportOptions{ProxyURL: "://"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(Options{Transport: tt.opts}); err == nil {
+				t.Error("NewClient should fail")
+			}
+		})
+	}
+}
+
+func TestClientTrustsConfiguredCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "16.93.25011212")
+	}))
+	defer srv.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caPath, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the CA the self-signed server must be rejected
+	plain := mustNewClient(t, Options{})
+	if _, err := plain.GetString(context.Background(), srv.URL); err == nil {
+		t.Fatal("expected TLS verification failure without custom CA")
+	}
+
+	c := mustNewClient(t, Options{Transport: TransportOptions{CAFiles: []string{caPath}}})
+	body, err := c.GetString(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("GetString with custom CA: %v", err)
+	}
+	if body != "16.93.25011212" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestClientUsesAuthenticatingProxy(t *testing.T) {
+	var gotAuth, gotURL string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Proxy-Authorization")
+		gotURL = r.URL.String()
+		fmt.Fprint(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	c := mustNewClient(t, Options{Transport: TransportOptions{
+		ProxyURL:      proxy.URL,
+		ProxyUser:     "svc-maucache",
+		ProxyPassword: "s3cret",
+	}})
+
+	body, err := c.GetString(context.Background(), "http://officecdnmac.example/builds.txt")
+	if err != nil {
+		t.Fatalf("GetString via proxy: %v", err)
+	}
+	if body != "via proxy" {
+		t.Errorf("body = %q", body)
+	}
+	if gotURL != "http://officecdnmac.example/builds.txt" {
+		t.Errorf("proxy saw URL %q", gotURL)
+	}
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("svc-maucache:s3cret"))
+	if gotAuth != wantAuth {
+		t.Errorf("Proxy-Authorization = %q, want %q", gotAuth, wantAuth)
+	}
+}
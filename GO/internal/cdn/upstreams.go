@@ -0,0 +1,252 @@
+package cdn
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+// Mirror 一个上游镜像
+type Mirror struct {
+	// URL 镜像基础地址，如 http://parent-cache.corp 或 https://officecdnmac.microsoft.com
+	URL string
+	// Flat 镜像按文件名平铺提供所有文件（上级 maucache 的 nginx 目录），
+	// 请求时只保留原 URL 的文件名，非根频道的文件在 /{频道名}/ 下；否则保留原 URL 的完整路径，只替换协议和主机
+	Flat bool
+}
+
+// upstream 镜像及其健康状态
+type upstream struct {
+	Mirror
+	base string // 规范化后的基础地址（去掉末尾 /）
+
+	mu             gosync.Mutex
+	successes      int64
+	failures       int64
+	notFound       int64
+	unhealthyUntil time.Time
+	lastError      string
+}
+
+// UpstreamStatus 单个上游的统计快照，用于 /sync/status
+type UpstreamStatus struct {
+	URL            string    `json:"url"`
+	Flat           bool      `json:"flat,omitempty"`
+	Healthy        bool      `json:"healthy"`
+	UnhealthyUntil time.Time `json:"unhealthy_until,omitempty"`
+	Successes      int64     `json:"successes"`
+	Failures       int64     `json:"failures"`
+	NotFound       int64     `json:"not_found"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// newUpstreams 构建上游列表；列表为空时只有规范上游，
+// 列表中不含规范上游时追加到末尾作为最后的回退
+func newUpstreams(canonical string, mirrors []Mirror) []*upstream {
+	var ups []*upstream
+	seen := make(map[string]bool)
+	for _, m := range append(mirrors, Mirror{URL: canonical}) {
+		base := strings.TrimRight(strings.TrimSpace(m.URL), "/")
+		if base == "" || seen[base] {
+			continue
+		}
+		seen[base] = true
+		ups = append(ups, &upstream{Mirror: m, base: base})
+	}
+	return ups
+}
+
+// healthy 判断上游当前是否可用
+func (u *upstream) healthy(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !now.Before(u.unhealthyUntil)
+}
+
+// record 记录一次请求结果；故障时标记为不健康 cooldown 时长
+func (u *upstream) record(err error, notFound bool, cooldown time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch {
+	case notFound:
+		u.notFound++
+	case err == nil:
+		u.successes++
+	default:
+		u.failures++
+		u.lastError = err.Error()
+		u.unhealthyUntil = time.Now().Add(cooldown)
+	}
+}
+
+// status 返回统计快照
+func (u *upstream) status(now time.Time) UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s := UpstreamStatus{
+		URL:       u.base,
+		Flat:      u.Flat,
+		Healthy:   !now.Before(u.unhealthyUntil),
+		Successes: u.successes,
+		Failures:  u.failures,
+		NotFound:  u.notFound,
+		LastError: u.lastError,
+	}
+	if !s.Healthy {
+		s.UnhealthyUntil = u.unhealthyUntil
+	}
+	return s
+}
+
+// rewrite 把原始 URL 改写为指向该上游的 URL
+// rel 为原始 URL 去掉已知基础地址后的路径（以 / 开头）；dir 为平铺镜像上的频道子目录，根频道为空
+func (u *upstream) rewrite(rel, dir, rawQuery string) string {
+	target := u.base
+	if u.Flat {
+		if dir != "" {
+			target += "/" + url.PathEscape(dir)
+		}
+		target += "/" + path.Base(rel)
+	} else {
+		target += rel
+	}
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+	return target
+}
+
+// manifestHosts 清单 Location 中出现过的 Microsoft CDN 主机（http 和 https 都有）
+var manifestHosts = []string{"officecdnmac.microsoft.com", "officecdn.microsoft.com"}
+
+// relativePath 如果 URL 属于某个已知上游（含规范上游、非平铺镜像和清单 Location 中的 CDN 主机），
+// 返回去掉该上游基础地址后的路径；不属于任何已知上游时返回 false，按原 URL 直接请求
+// 按主机匹配、忽略协议，清单里 http:// 的 Location 也会被改写到选中的镜像
+func (c *Client) relativePath(u *url.URL) (string, bool) {
+	p := u.EscapedPath()
+	for _, h := range manifestHosts {
+		if strings.EqualFold(u.Host, h) {
+			return p, true
+		}
+	}
+	bases := []string{c.base}
+	for _, up := range c.upstreams {
+		if !up.Flat {
+			bases = append(bases, up.base)
+		}
+	}
+	for _, b := range bases {
+		bu, err := url.Parse(b)
+		if err != nil || !strings.EqualFold(u.Host, bu.Host) {
+			continue
+		}
+		if rel, ok := strings.CutPrefix(p, bu.EscapedPath()); ok && (rel == "" || rel[0] == '/') {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+// flatDir 返回路径在平铺镜像上所属的频道子目录
+// 上级 maucache 把根频道（sync.channel）放在根目录，sync.extra_channels 中的频道放在 /{频道名}/ 下，
+// 这里按路径前缀（GUID 不区分大小写）找到频道：根频道或不属于任何频道的路径返回 ""
+func (c *Client) flatDir(rel string) string {
+	lower := strings.ToLower(rel)
+	if root := c.channels[c.rootChannel]; root != "" && strings.HasPrefix(lower, strings.ToLower(root)) {
+		return ""
+	}
+	names := make([]string, 0, len(c.channels))
+	for name := range c.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if p := c.channels[name]; p != "" && strings.HasPrefix(lower, strings.ToLower(p)) {
+			return name
+		}
+	}
+	return ""
+}
+
+// do 发送请求；URL 属于已知上游时按顺序在健康的上游镜像之间尝试
+// 网络错误 / 5xx / 限流：标记该上游不健康一段时间，换下一个；
+// 404：上游健康但缺这个文件（父级缓存尚未同步到），换下一个但不标记；
+// 最后一个候选的结果原样返回
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	rel, ok := c.relativePath(req.URL)
+	if !ok || len(c.upstreams) <= 1 {
+		return c.send(req)
+	}
+
+	now := time.Now()
+	var candidates []*upstream
+	for _, up := range c.upstreams {
+		if up.healthy(now) && !c.breaker.IsOpen(hostOf(up.base)) {
+			candidates = append(candidates, up)
+		}
+	}
+	if len(candidates) == 0 {
+		// 全部不健康时仍按顺序尝试，不让同步直接失败
+		candidates = c.upstreams
+	}
+
+	dir := c.flatDir(rel)
+	for i, up := range candidates {
+		last := i == len(candidates)-1
+		target, err := url.Parse(up.rewrite(rel, dir, req.URL.RawQuery))
+		if err != nil {
+			continue
+		}
+		r := req.Clone(req.Context())
+		r.URL = target
+		r.Host = ""
+
+		resp, err := c.send(r)
+		switch {
+		case err != nil:
+			up.record(err, false, c.mirrorCooldown)
+			if last || req.Context().Err() != nil {
+				return nil, err
+			}
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			up.record(newHTTPError(resp), false, c.mirrorCooldown)
+			if last {
+				return resp, nil
+			}
+			resp.Body.Close()
+		case resp.StatusCode == http.StatusNotFound:
+			up.record(nil, true, 0)
+			if last {
+				return resp, nil
+			}
+			resp.Body.Close()
+		default:
+			up.record(nil, false, 0)
+			return resp, nil
+		}
+	}
+	// 所有候选都因 URL 无效被跳过
+	return c.send(req)
+}
+
+// hostOf 返回基础地址中的主机部分（熔断器按主机记录）
+func hostOf(base string) string {
+	if u, err := url.Parse(base); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+// UpstreamStatus 返回每个上游的统计，按配置顺序
+func (c *Client) UpstreamStatus() []UpstreamStatus {
+	now := time.Now()
+	out := make([]UpstreamStatus, 0, len(c.upstreams))
+	for _, up := range c.upstreams {
+		out = append(out, up.status(now))
+	}
+	return out
+}
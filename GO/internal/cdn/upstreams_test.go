@@ -0,0 +1,194 @@
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpstreamRewrite(t *testing.T) {
+	nested := &upstream{Mirror: Mirror{URL: "http://mirror"}, base: "http://mirror"}
+	flat := &upstream{Mirror: Mirror{URL: "http://parent", Flat: true}, base: "http://parent"}
+	rel := "/pr/C1297A47/MacAutoupdate/Microsoft_Word.pkg"
+
+	if got := nested.rewrite(rel, "Preview", ""); got != "http://mirror"+rel {
+		t.Errorf("nested rewrite = %q", got)
+	}
+	if got := flat.rewrite(rel, "", "a=1"); got != "http://parent/Microsoft_Word.pkg?a=1" {
+		t.Errorf("flat rewrite = %q", got)
+	}
+	if got := flat.rewrite(rel, "Preview", ""); got != "http://parent/Preview/Microsoft_Word.pkg" {
+		t.Errorf("flat rewrite for Preview = %q", got)
+	}
+}
+
+func TestFlatMirrorKeepsChannelDirectory(t *testing.T) {
+	var paths []string
+	parent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer parent.Close()
+	canonical := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("canonical upstream should not be asked for %s", r.URL.Path)
+	}))
+	defer canonical.Close()
+
+	c := mustNewClient(t, Options{
+		Upstream: canonical.URL,
+		Mirrors:  []Mirror{{URL: parent.URL, Flat: true}},
+	})
+	ctx := context.Background()
+	for _, channel := range []string{"Production", "Preview", "Beta"} {
+		if _, err := c.GetString(ctx, c.ChannelBaseURL(channel)+"builds.txt"); err != nil {
+			t.Fatalf("%s: %v", channel, err)
+		}
+	}
+	// Locations in manifests may use lower-case GUIDs.
+	if _, err := c.GetString(ctx, canonical.URL+"/pr/4b2d7701-0a4f-49c8-b4cb-0c2d4043f51f/MacAutoupdate/x.pkg"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/builds.txt", "/Preview/builds.txt", "/Beta/builds.txt", "/Beta/x.pkg"}
+	if fmt.Sprint(paths) != fmt.Sprint(want) {
+		t.Errorf("flat mirror paths = %q, want %q", paths, want)
+	}
+
+	// A parent whose root is Preview serves Production from its subdirectory.
+	paths = nil
+	c = mustNewClient(t, Options{
+		Upstream:    canonical.URL,
+		Mirrors:     []Mirror{{URL: parent.URL, Flat: true}},
+		RootChannel: "Preview",
+	})
+	for _, channel := range []string{"Production", "Preview"} {
+		if _, err := c.GetString(ctx, c.ChannelBaseURL(channel)+"builds.txt"); err != nil {
+			t.Fatalf("%s: %v", channel, err)
+		}
+	}
+	if want := []string{"/Production/builds.txt", "/builds.txt"}; fmt.Sprint(paths) != fmt.Sprint(want) {
+		t.Errorf("flat mirror paths = %q, want %q", paths, want)
+	}
+}
+
+func TestNewUpstreamsAppendsCanonical(t *testing.T) {
+	ups := newUpstreams("https://cdn", []Mirror{{URL: "http://a/"}, {URL: "https://cdn"}})
+	if len(ups) != 2 || ups[0].base != "http://a" || ups[1].base != "https://cdn" {
+		t.Fatalf("listed canonical should not be duplicated: %+v", ups)
+	}
+	ups = newUpstreams("https://cdn", []Mirror{{URL: "http://a"}})
+	if len(ups) != 2 || ups[1].base != "https://cdn" {
+		t.Fatalf("canonical should be appended last: %+v", ups)
+	}
+}
+
+func TestFailoverToNextMirror(t *testing.T) {
+	var brokenHits atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenHits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	// Flat mirror only knows file names, not CDN paths.
+	flat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("from-flat"))
+	}))
+	defer flat.Close()
+	canonical := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("from-canonical"))
+	}))
+	defer canonical.Close()
+
+	c := mustNewClient(t, Options{
+		Upstream:       canonical.URL,
+		Mirrors:        []Mirror{{URL: broken.URL}, {URL: flat.URL, Flat: true}},
+		MirrorCooldown: time.Minute,
+	})
+	ctx := context.Background()
+
+	body, err := c.GetString(ctx, canonical.URL+"/pr/x/file.xml")
+	if err != nil || body != "from-flat" {
+		t.Fatalf("GetString = %q, %v; want from-flat", body, err)
+	}
+	// The broken mirror is skipped during its cooldown.
+	if _, err := c.GetString(ctx, canonical.URL+"/pr/x/file.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if n := brokenHits.Load(); n != 1 {
+		t.Errorf("broken mirror hit %d times, want 1", n)
+	}
+
+	// A file missing from the flat mirror falls through to the canonical upstream.
+	body, err = c.GetString(ctx, canonical.URL+"/pr/x/other.xml")
+	if err != nil || body != "from-canonical" {
+		t.Fatalf("GetString = %q, %v; want from-canonical", body, err)
+	}
+
+	st := c.UpstreamStatus()
+	if len(st) != 3 {
+		t.Fatalf("UpstreamStatus = %+v", st)
+	}
+	if st[0].Healthy || st[0].Failures != 1 {
+		t.Errorf("broken status = %+v, want unhealthy with 1 failure", st[0])
+	}
+	if !st[1].Healthy || st[1].Successes != 2 || st[1].NotFound != 1 {
+		t.Errorf("flat status = %+v, want 2 successes and 1 not found", st[1])
+	}
+	if st[2].Successes != 1 {
+		t.Errorf("canonical status = %+v, want 1 success", st[2])
+	}
+}
+
+func TestFailoverLeavesUnknownHostsAlone(t *testing.T) {
+	var mirrorHits atomic.Int32
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorHits.Add(1)
+	}))
+	defer mirror.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("other"))
+	}))
+	defer other.Close()
+
+	c := mustNewClient(t, Options{Upstream: "https://cdn.invalid", Mirrors: []Mirror{{URL: mirror.URL}}})
+	body, err := c.GetString(context.Background(), other.URL+"/x.xml")
+	if err != nil || body != "other" {
+		t.Fatalf("GetString = %q, %v", body, err)
+	}
+	if mirrorHits.Load() != 0 {
+		t.Error("requests to unrelated hosts should not go through mirrors")
+	}
+}
+
+func TestRelativePathMatchesManifestHosts(t *testing.T) {
+	c := mustNewClient(t, Options{
+		Upstream: "http://parent.local/maucache",
+		Mirrors:  []Mirror{{URL: "http://flat.local", Flat: true}},
+	})
+	cases := []struct {
+		raw  string
+		rel  string
+		want bool
+	}{
+		{"http://officecdnmac.microsoft.com/pr/x/a.pkg", "/pr/x/a.pkg", true},
+		{"https://officecdn.microsoft.com/pr/x/a.pkg", "/pr/x/a.pkg", true},
+		{"http://parent.local/maucache/pr/x/a.pkg", "/pr/x/a.pkg", true},
+		{"http://parent.local/other/a.pkg", "", false},
+		{"http://flat.local/a.pkg", "", false},
+	}
+	for _, tc := range cases {
+		u, _ := url.Parse(tc.raw)
+		rel, ok := c.relativePath(u)
+		if ok != tc.want || rel != tc.rel {
+			t.Errorf("relativePath(%q) = %q, %v; want %q, %v", tc.raw, rel, ok, tc.rel, tc.want)
+		}
+	}
+}
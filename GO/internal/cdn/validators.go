@@ -0,0 +1,131 @@
+package cdn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+)
+
+// ValidatorCache 按 URL 持久化 ETag / Last-Modified 和响应体
+// 用于编录和清单的条件 GET：服务器返回 304 时直接复用上次保存的响应体，
+// 内容不变的一次同步只需要一批很小的请求
+type ValidatorCache struct {
+	dir string
+	mu  gosync.Mutex
+}
+
+// validatorEntry 单个 URL 的校验器，与响应体分开存放
+type validatorEntry struct {
+	URL     string    `json:"url"`
+	ETag    string    `json:"etag,omitempty"`
+	LastMod time.Time `json:"last_modified,omitempty"`
+}
+
+// NewValidatorCache 创建校验器缓存，dir 不存在时自动创建
+func NewValidatorCache(dir string) (*ValidatorCache, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &ValidatorCache{dir: dir}, nil
+}
+
+// paths 返回 URL 对应的元数据文件和响应体文件路径
+func (v *ValidatorCache) paths(url string) (meta, body string) {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(v.dir, key+".json"), filepath.Join(v.dir, key+".body")
+}
+
+// apply 为请求加上 If-None-Match / If-Modified-Since，返回是否有可用缓存
+func (v *ValidatorCache) apply(req *http.Request) bool {
+	entry, ok := v.load(req.URL.String())
+	if !ok {
+		return false
+	}
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if !entry.LastMod.IsZero() {
+		req.Header.Set("If-Modified-Since", entry.LastMod.UTC().Format(http.TimeFormat))
+	}
+	return entry.ETag != "" || !entry.LastMod.IsZero()
+}
+
+// load 读取 URL 的校验器，响应体文件缺失时视为无缓存
+func (v *ValidatorCache) load(url string) (validatorEntry, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	metaPath, bodyPath := v.paths(url)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return validatorEntry{}, false
+	}
+	var entry validatorEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != url {
+		return validatorEntry{}, false
+	}
+	if _, err := os.Stat(bodyPath); err != nil {
+		return validatorEntry{}, false
+	}
+	return entry, true
+}
+
+// body 读取上次保存的响应体（收到 304 时使用）
+func (v *ValidatorCache) body(url string) ([]byte, validatorEntry, error) {
+	entry, ok := v.load(url)
+	if !ok {
+		return nil, validatorEntry{}, os.ErrNotExist
+	}
+	_, bodyPath := v.paths(url)
+	data, err := os.ReadFile(bodyPath)
+	return data, entry, err
+}
+
+// store 保存响应的校验器和响应体；响应没有任何校验器时删除旧缓存
+func (v *ValidatorCache) store(url string, resp *http.Response, body []byte) error {
+	entry := validatorEntry{
+		URL:     url,
+		ETag:    resp.Header.Get("ETag"),
+		LastMod: lastModTime(resp),
+	}
+	if entry.ETag == "" && entry.LastMod.IsZero() {
+		v.forget(url)
+		return nil
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	metaPath, bodyPath := v.paths(url)
+	// 先写响应体再写元数据：中途失败时元数据缺失，下次按无缓存处理
+	if err := writeFileAtomic(bodyPath, body); err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath, meta)
+}
+
+// forget 删除 URL 的缓存（资源已不存在时调用）
+func (v *ValidatorCache) forget(url string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	metaPath, bodyPath := v.paths(url)
+	os.Remove(metaPath)
+	os.Remove(bodyPath)
+}
+
+// writeFileAtomic 先写临时文件再 rename，避免留下半截文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
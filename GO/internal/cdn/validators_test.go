@@ -0,0 +1,116 @@
+package cdn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// conditionalServer serves body with an ETag and counts full (200) vs 304 responses
+func conditionalServer(body *string, etag *string, full, notModified *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", *etag)
+		if r.Header.Get("If-None-Match") == *etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		http.ServeContent(w, r, "", testModTime, strings.NewReader(*body))
+	}))
+}
+
+func TestGetStringReusesBodyOn304(t *testing.T) {
+	body, etag := "<plist>v1</plist>", `"v1"`
+	var full, notModified atomic.Int32
+	srv := conditionalServer(&body, &etag, &full, &notModified)
+	defer srv.Close()
+
+	c := mustNewClient(t, Options{ValidatorDir: t.TempDir()})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		got, err := c.GetString(ctx, srv.URL+"/0409MSWD2019.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "<plist>v1</plist>" {
+			t.Fatalf("GetString = %q", got)
+		}
+	}
+	if full.Load() != 1 || notModified.Load() != 2 {
+		t.Errorf("full=%d notModified=%d, want 1 and 2", full.Load(), notModified.Load())
+	}
+
+	// A changed resource is fetched in full again
+	body, etag = "<plist>v2</plist>", `"v2"`
+	got, err := c.GetString(ctx, srv.URL+"/0409MSWD2019.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "<plist>v2</plist>" {
+		t.Errorf("GetString after change = %q", got)
+	}
+	if full.Load() != 2 {
+		t.Errorf("full = %d, want 2", full.Load())
+	}
+}
+
+func TestFetchPersistsValidatorsAcrossClients(t *testing.T) {
+	body, etag := "catalog", `"cat1"`
+	var full, notModified atomic.Int32
+	srv := conditionalServer(&body, &etag, &full, &notModified)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	if _, _, err := mustNewClient(t, Options{ValidatorDir: dir}).Fetch(ctx, srv.URL+"/a.cat"); err != nil {
+		t.Fatal(err)
+	}
+	// A new client (process restart) reuses the validators on disk
+	got, lastMod, err := mustNewClient(t, Options{ValidatorDir: dir}).Fetch(ctx, srv.URL+"/a.cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "catalog" {
+		t.Errorf("Fetch = %q", got)
+	}
+	if !lastMod.Equal(testModTime) {
+		t.Errorf("lastMod = %v, want %v", lastMod, testModTime)
+	}
+	if notModified.Load() != 1 {
+		t.Errorf("notModified = %d, want 1", notModified.Load())
+	}
+}
+
+func TestGetStringOptionalForgetsMissingResource(t *testing.T) {
+	present := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !present {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"h1"`)
+		http.ServeContent(w, r, "", testModTime, strings.NewReader("history"))
+	}))
+	defer srv.Close()
+
+	c := mustNewClient(t, Options{ValidatorDir: t.TempDir()})
+	ctx := context.Background()
+	url := srv.URL + "/0409MSWD2019-history.xml"
+
+	if got, err := c.GetStringOptional(ctx, url); err != nil || got != "history" {
+		t.Fatalf("GetStringOptional = %q, %v", got, err)
+	}
+	present = false
+	if got, err := c.GetStringOptional(ctx, url); err != nil || got != "" {
+		t.Fatalf("GetStringOptional after removal = %q, %v", got, err)
+	}
+	if _, ok := c.validators.load(url); ok {
+		t.Error("validator entry should be dropped after 404")
+	}
+}
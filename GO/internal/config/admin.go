@@ -0,0 +1,60 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// minAdminTokenLen 访问令牌的最短长度
+const minAdminTokenLen = 16
+
+// AdminConfig 管理接口：修改发布状态的操作（固定版本等）不挂在 health.listen 上，
+// 而是单独监听（默认只监听本机），每个请求都要带访问令牌，审计记录中的操作人取令牌的名称
+type AdminConfig struct {
+	Listen string `yaml:"listen"` // 管理接口监听地址，默认 127.0.0.1:8090
+
+	// TokensFile 访问令牌文件，每行 "名称:令牌"，# 开头为注释；为空时不启用管理接口
+	TokensFile string `yaml:"tokens_file"`
+}
+
+// LoadTokens 读取访问令牌文件，返回 令牌 → 名称
+func (a AdminConfig) LoadTokens() (map[string]string, error) {
+	data, err := os.ReadFile(a.TokensFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取访问令牌文件失败: %w", err)
+	}
+	tokens := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, token, ok := strings.Cut(line, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		switch {
+		case !ok || name == "":
+			return nil, fmt.Errorf("%s 第 %d 行格式无效（应为 名称:令牌）", a.TokensFile, n)
+		case len(token) < minAdminTokenLen:
+			return nil, fmt.Errorf("%s 第 %d 行（%s）的令牌太短，至少 %d 个字符", a.TokensFile, n, name, minAdminTokenLen)
+		case tokens[token] != "":
+			return nil, fmt.Errorf("%s 第 %d 行（%s）的令牌与 %s 重复", a.TokensFile, n, name, tokens[token])
+		}
+		tokens[token] = name
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s 中没有访问令牌", a.TokensFile)
+	}
+	return tokens, nil
+}
+
+// validate 检查管理接口配置
+func (a AdminConfig) validate() error {
+	if a.TokensFile != "" && a.Listen == "" {
+		return fmt.Errorf("配置了 admin.tokens_file 但 admin.listen 为空")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdminDefaults(t *testing.T) {
+	clearEnv(t)
+	cfg := Load("")
+	if cfg.Admin.Listen != "127.0.0.1:8090" || cfg.Admin.TokensFile != "" {
+		t.Errorf("admin defaults = %+v", cfg.Admin)
+	}
+	t.Setenv("MAUCACHE_ADMIN_LISTEN", "127.0.0.1:9000")
+	t.Setenv("MAUCACHE_ADMIN_TOKENS_FILE", "/run/secrets/maucache-tokens")
+	if cfg := Load(""); cfg.Admin.Listen != "127.0.0.1:9000" || cfg.Admin.TokensFile != "/run/secrets/maucache-tokens" {
+		t.Errorf("admin from env = %+v", cfg.Admin)
+	}
+
+	cfg.Admin = AdminConfig{TokensFile: "/run/secrets/maucache-tokens"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject tokens_file without listen")
+	}
+}
+
+func TestAdminLoadTokens(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) AdminConfig {
+		path := filepath.Join(dir, "tokens")
+		os.WriteFile(path, []byte(content), 0600)
+		return AdminConfig{Listen: "127.0.0.1:8090", TokensFile: path}
+	}
+
+	tokens, err := write("# operators\nalice: 0123456789abcdef0123\n\nbob:fedcba9876543210fedc\n").LoadTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens["0123456789abcdef0123"] != "alice" || tokens["fedcba9876543210fedc"] != "bob" {
+		t.Errorf("tokens = %v", tokens)
+	}
+
+	for name, content := range map[string]string{
+		"missing separator": "alice 0123456789abcdef0123\n",
+		"empty name":        ":0123456789abcdef0123\n",
+		"short token":       "alice:short\n",
+		"duplicate token":   "alice:0123456789abcdef0123\nbob:0123456789abcdef0123\n",
+		"no tokens":         "# nobody\n",
+	} {
+		if _, err := write(content).LoadTokens(); err == nil {
+			t.Errorf("%s: LoadTokens() should fail", name)
+		} else if strings.Contains(err.Error(), "0123456789abcdef0123") {
+			t.Errorf("%s: error leaks the token: %v", name, err)
+		}
+	}
+	if _, err := (AdminConfig{TokensFile: filepath.Join(dir, "missing")}).LoadTokens(); err == nil {
+		t.Error("LoadTokens() should fail for a missing file")
+	}
+}
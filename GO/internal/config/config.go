@@ -1,8 +1,13 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -16,15 +21,140 @@ type Config struct {
 	Storage StorageConfig `yaml:"storage"`
 	Logging LogConfig     `yaml:"logging"`
 	Health  HealthConfig  `yaml:"health"`
+	HTTP    HTTPConfig    `yaml:"http"`
+
+	// Channels 自定义频道：频道名 → GUID 路径（或裸 GUID）
+	// 与内置的 Production / Preview / Beta 合并，同名覆盖内置定义
+	Channels map[string]string `yaml:"channels"`
+
+	// Apps 要同步的应用：默认为内置的应用列表，可按 AppID / 名称筛选，或追加新的应用
+	Apps AppsConfig `yaml:"apps"`
+
+	// Rollout 分批发布：按客户端网段提供不同版本的编录
+	Rollout RolloutConfig `yaml:"rollout"`
+
+	// Admin 管理接口：固定版本等修改发布状态的操作，单独监听并要求访问令牌
+	Admin AdminConfig `yaml:"admin"`
+}
+
+// AppsConfig 应用列表配置
+// include / exclude 按 AppID 或名称匹配，支持 * ? 通配，不区分大小写；exclude 优先
+type AppsConfig struct {
+	Include []string    `yaml:"include"` // 为空表示全部
+	Exclude []string    `yaml:"exclude"` // 如 ["0409MSFB16", "Teams 1.0*"]
+	Custom  []CustomApp `yaml:"custom"`  // 追加的应用，启动时到上游确认存在
+
+	// Pins 版本固定：AppID → 版本号。固定后根目录的 {AppID}.xml / -chk.xml / .cat 取自
+	// collateral/{版本号}/，新版本的安装包照常下载。也可以通过 POST /apps/{id}/pin 临时固定
+	Pins map[string]string `yaml:"pins"`
+
+	// KeepVersions 按应用覆盖 sync.keep_versions：AppID → 保留的历史版本数；
+	// 只写应用代码相同的一个语言（如 0409MSWD2019）时对所有语言生效
+	KeepVersions map[string]int `yaml:"keep_versions"`
+}
+
+// CustomApp 自定义应用定义
+type CustomApp struct {
+	ID   string `yaml:"id"`   // MAU 应用 ID，如 0409MSWD2019；前 4 位 LCID 按 sync.locales 展开
+	Name string `yaml:"name"` // 显示名称，为空时使用 ID
 }
 
 // SyncConfig 同步引擎配置
 type SyncConfig struct {
-	Channel     string        `yaml:"channel"`     // Production / Preview / Beta
+	Channel     string        `yaml:"channel"`     // Production / Preview / Beta / channels 中的自定义频道
+	Upstream    string        `yaml:"upstream"`    // 上游基础地址，默认 https://officecdnmac.microsoft.com
 	Interval    time.Duration `yaml:"interval"`    // 同步间隔，默认 6h
 	Concurrency int           `yaml:"concurrency"` // 并发下载数，默认 4
 	RetryMax    int           `yaml:"retry_max"`   // 重试次数，默认 3
 	RetryDelay  time.Duration `yaml:"retry_delay"` // 重试退避基数，默认 5s
+
+	// ExtraChannels 同一进程中额外同步的频道（如 Preview / Beta），缓存在 cache_dir/{频道名}/ 下；
+	// Channel 仍在 cache_dir 根目录。各频道依次同步，相同的安装包在频道之间硬链接，只存一份
+	ExtraChannels []string `yaml:"extra_channels"`
+
+	// Locales 要缓存的语言（LCID，如 0409 英语、0407 德语、040C 法语），默认只有 0409；
+	// 每个应用按每个 LCID 分别获取清单和编录，AppID 的前 4 位替换为对应 LCID
+	Locales []string `yaml:"locales"`
+
+	// Upstreams 按顺序尝试的上游镜像（如区域上级缓存），故障时自动切到下一个；
+	// Upstream 总是作为最后的回退，未列出时自动追加到末尾
+	Upstreams      []UpstreamMirror `yaml:"upstreams"`
+	MirrorCooldown time.Duration    `yaml:"mirror_cooldown"` // 镜像故障后被跳过的时长，默认 5m
+
+	BreakerThreshold int           `yaml:"breaker_threshold"` // 连续失败多少次后暂停所有请求，默认 5
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`  // 熔断暂停时长（无 Retry-After 时），默认 30s
+
+	Segments           int `yaml:"segments"`             // 大文件分段并发下载的段数，默认 1（不分段）
+	SegmentThresholdMB int `yaml:"segment_threshold_mb"` // 超过该大小（MB）才分段，默认 100
+
+	BandwidthLimit string `yaml:"bandwidth_limit"` // 全局限速，如 20Mbps / 5MB/s，空或 0 不限速
+
+	// HashPolicy 下载文件与清单的大小 / 哈希不一致时的处理：
+	// strict（默认）拒绝放入缓存并重试，lenient 只记录警告
+	HashPolicy string `yaml:"hash_policy"`
+
+	// SignatureRoots 校验 .pkg 签名用的 Apple 根证书（PEM 文件），配置后未签名、签名者不受信任
+	// 或数据与签名过的 TOC 不符的包不会发布；为空时不校验签名
+	SignatureRoots string `yaml:"signature_roots"`
+	// SignatureTeams 允许的 Developer ID Team ID，默认 Microsoft 的 UBF8T346G9
+	SignatureTeams []string `yaml:"signature_teams"`
+	// CatalogRoots 校验 .cat 编录签名者证书链的根证书（PEM 文件）；为空时只校验签名本身，不校验证书链，
+	// 校验失败也只记录警告（hash_policy=strict 只在配置了根证书时拒绝发布编录）
+	CatalogRoots string `yaml:"catalog_roots"`
+
+	// KeepVersions 除当前版本外还要镜像的历史版本数（按 history.xml，取最新的 N 个）：
+	// 下载这些版本的安装包（增量包同样按构建列表过滤），编录保存到 collateral/{版本号}/，
+	// 客户端回退到旧版本时不必访问外网。默认 0，只镜像当前版本
+	KeepVersions int `yaml:"keep_versions"`
+
+	// RequireApproval 审批模式：新版本照常下载编录和安装包，但只在 collateral/{版本号}/ 中暂存，
+	// 经 POST /apps/{id}/approve 或 maucache approvals approve 批准后才对客户端提供
+	RequireApproval bool `yaml:"require_approval"`
+
+	// Schedule 时段调度：按星期和时间段覆盖 BandwidthLimit / Concurrency，同步进行中也会动态切换
+	Schedule []ScheduleWindow `yaml:"schedule"`
+}
+
+// 下载校验策略，见 SyncConfig.HashPolicy
+const (
+	HashStrict  = "strict"
+	HashLenient = "lenient"
+)
+
+// UpstreamMirror 一个上游镜像
+type UpstreamMirror struct {
+	URL  string `yaml:"url"`  // 镜像基础地址
+	Flat bool   `yaml:"flat"` // 按文件名平铺提供（上级 maucache 的目录，extra_channels 在 /{频道名}/ 下），否则保留 CDN 路径
+}
+
+// HTTPConfig 出站 HTTP 配置（代理 / CA / 客户端证书 / TLS 版本）
+// 对应 PowerShell: Set-MAUCacheAdminHttpClientHandler.ps1
+type HTTPConfig struct {
+	Proxy             string   `yaml:"proxy"`               // 代理地址，如 http://proxy.corp:3128
+	NoProxy           []string `yaml:"no_proxy"`            // 不走代理的主机 / 后缀 / CIDR
+	ProxyUser         string   `yaml:"proxy_user"`          // 代理用户名
+	ProxyPasswordFile string   `yaml:"proxy_password_file"` // 代理密码文件（优先）
+	ProxyPasswordEnv  string   `yaml:"proxy_password_env"`  // 存放代理密码的环境变量名
+	CAFiles           []string `yaml:"ca_files"`            // 额外信任的 CA PEM 文件
+	ClientCert        string   `yaml:"client_cert"`         // 客户端证书 PEM
+	ClientKey         string   `yaml:"client_key"`          // 客户端私钥 PEM
+	TLSMinVersion     string   `yaml:"tls_min_version"`     // 1.2（默认）/ 1.3 等
+}
+
+// ProxyPassword 读取代理密码：先读文件，再读环境变量
+// 密码不直接写进配置文件，避免随配置一起泄露
+func (h HTTPConfig) ProxyPassword() (string, error) {
+	if h.ProxyPasswordFile != "" {
+		data, err := os.ReadFile(h.ProxyPasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("读取代理密码文件失败: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if h.ProxyPasswordEnv != "" {
+		return os.Getenv(h.ProxyPasswordEnv), nil
+	}
+	return "", nil
 }
 
 // StorageConfig 存储路径配置
@@ -32,6 +162,10 @@ type SyncConfig struct {
 type StorageConfig struct {
 	CacheDir   string `yaml:"cache_dir"`   // 对应 $maupath → /data/maucache
 	ScratchDir string `yaml:"scratch_dir"` // 对应 $mautemppath → /data/maucache/.tmp
+	StateDir   string `yaml:"state_dir"`   // 运行状态（条件 GET 校验器缓存等）→ /data/maucache/.state
+
+	// QuarantineDir 结构校验失败的安装包移到这里，供人工排查 → /data/maucache/.quarantine
+	QuarantineDir string `yaml:"quarantine_dir"`
 }
 
 // LogConfig 日志配置
@@ -50,14 +184,40 @@ func Load(path string) *Config {
 	cfg := &Config{
 		Sync: SyncConfig{
 			Channel:     envOr("MAUCACHE_SYNC_CHANNEL", "Production"),
+			Upstream:    envOr("MAUCACHE_SYNC_UPSTREAM", "https://officecdnmac.microsoft.com"),
 			Interval:    durationOr("MAUCACHE_SYNC_INTERVAL", 6*time.Hour),
 			Concurrency: intOr("MAUCACHE_SYNC_CONCURRENCY", 4),
 			RetryMax:    intOr("MAUCACHE_SYNC_RETRY_MAX", 3),
 			RetryDelay:  durationOr("MAUCACHE_SYNC_RETRY_DELAY", 5*time.Second),
+			Locales:     listOr("MAUCACHE_SYNC_LOCALES", []string{"0409"}),
+
+			ExtraChannels: listOr("MAUCACHE_SYNC_EXTRA_CHANNELS", nil),
+
+			Upstreams:      mirrorsOr("MAUCACHE_SYNC_UPSTREAMS"),
+			MirrorCooldown: durationOr("MAUCACHE_SYNC_MIRROR_COOLDOWN", 5*time.Minute),
+
+			BreakerThreshold: intOr("MAUCACHE_SYNC_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  durationOr("MAUCACHE_SYNC_BREAKER_COOLDOWN", 30*time.Second),
+
+			Segments:           intOr("MAUCACHE_SYNC_SEGMENTS", 1),
+			SegmentThresholdMB: intOr("MAUCACHE_SYNC_SEGMENT_THRESHOLD_MB", 100),
+
+			BandwidthLimit: envOr("MAUCACHE_SYNC_BANDWIDTH_LIMIT", ""),
+			HashPolicy:     envOr("MAUCACHE_SYNC_HASH_POLICY", HashStrict),
+
+			SignatureRoots: envOr("MAUCACHE_SYNC_SIGNATURE_ROOTS", ""),
+			SignatureTeams: listOr("MAUCACHE_SYNC_SIGNATURE_TEAMS", []string{"UBF8T346G9"}),
+			CatalogRoots:   envOr("MAUCACHE_SYNC_CATALOG_ROOTS", ""),
+
+			KeepVersions:    intOr("MAUCACHE_SYNC_KEEP_VERSIONS", 0),
+			RequireApproval: boolOr("MAUCACHE_SYNC_REQUIRE_APPROVAL", false),
 		},
 		Storage: StorageConfig{
 			CacheDir:   envOr("MAUCACHE_CACHE_DIR", "/data/maucache"),
 			ScratchDir: envOr("MAUCACHE_SCRATCH_DIR", "/data/maucache/.tmp"),
+			StateDir:   envOr("MAUCACHE_STATE_DIR", "/data/maucache/.state"),
+
+			QuarantineDir: envOr("MAUCACHE_QUARANTINE_DIR", "/data/maucache/.quarantine"),
 		},
 		Logging: LogConfig{
 			Level:  envOr("MAUCACHE_LOG_LEVEL", "info"),
@@ -66,6 +226,33 @@ func Load(path string) *Config {
 		Health: HealthConfig{
 			Listen: envOr("MAUCACHE_HEALTH_LISTEN", ":8080"),
 		},
+		HTTP: HTTPConfig{
+			Proxy:             envOr("MAUCACHE_HTTP_PROXY", ""),
+			NoProxy:           listOr("MAUCACHE_HTTP_NO_PROXY", nil),
+			ProxyUser:         envOr("MAUCACHE_HTTP_PROXY_USER", ""),
+			ProxyPasswordFile: envOr("MAUCACHE_HTTP_PROXY_PASSWORD_FILE", ""),
+			ProxyPasswordEnv:  envOr("MAUCACHE_HTTP_PROXY_PASSWORD_ENV", ""),
+			CAFiles:           listOr("MAUCACHE_HTTP_CA_FILES", nil),
+			ClientCert:        envOr("MAUCACHE_HTTP_CLIENT_CERT", ""),
+			ClientKey:         envOr("MAUCACHE_HTTP_CLIENT_KEY", ""),
+			TLSMinVersion:     envOr("MAUCACHE_HTTP_TLS_MIN_VERSION", "1.2"),
+		},
+		Apps: AppsConfig{
+			Include: listOr("MAUCACHE_APPS_INCLUDE", nil),
+			Exclude: listOr("MAUCACHE_APPS_EXCLUDE", nil),
+			Custom:  customAppsOr("MAUCACHE_APPS_CUSTOM"),
+			Pins:    pinsOr("MAUCACHE_APPS_PINS"),
+
+			KeepVersions: keepVersionsOr("MAUCACHE_APPS_KEEP_VERSIONS"),
+		},
+		Rollout: RolloutConfig{
+			Listen:         envOr("MAUCACHE_ROLLOUT_LISTEN", ""),
+			TrustedProxies: listOr("MAUCACHE_ROLLOUT_TRUSTED_PROXIES", nil),
+		},
+		Admin: AdminConfig{
+			Listen:     envOr("MAUCACHE_ADMIN_LISTEN", "127.0.0.1:8090"),
+			TokensFile: envOr("MAUCACHE_ADMIN_TOKENS_FILE", ""),
+		},
 	}
 
 	// YAML 文件如果存在则覆盖环境变量的值
@@ -78,6 +265,105 @@ func Load(path string) *Config {
 	return cfg
 }
 
+// appIDPattern MAU 应用 ID：4 位 LCID + 应用代码，如 0409MSWD2019、0409MSau04
+var appIDPattern = regexp.MustCompile(`^[0-9A-Fa-f]{4}[A-Za-z0-9]+$`)
+
+// lcidPattern Windows 语言代码（十六进制），如 0409、0407、040C
+var lcidPattern = regexp.MustCompile(`^[0-9A-Fa-f]{4}$`)
+
+// maxSegments 分段下载的段数上限，避免对单个文件打开过多连接
+const maxSegments = 16
+
+// Validate 检查配置是否合法，启动阶段调用
+// 频道名是否存在由 cdn.Client.ValidateChannel 检查（内置频道定义在 cdn 包中）
+func (c *Config) Validate() error {
+	u, err := url.Parse(c.Sync.Upstream)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("sync.upstream 无效: %q", c.Sync.Upstream)
+	}
+	for i, m := range c.Sync.Upstreams {
+		u, err := url.Parse(m.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("sync.upstreams[%d] 无效: %q", i, m.URL)
+		}
+	}
+	if c.Sync.Channel == "" {
+		return fmt.Errorf("sync.channel 不能为空")
+	}
+	seen := map[string]bool{c.Sync.Channel: true}
+	for _, ch := range c.Sync.ExtraChannels {
+		// 频道名直接用作子目录名，不能与缓存目录中已有的子目录冲突
+		if ch == "" || ch != filepath.Base(ch) || strings.HasPrefix(ch, ".") || strings.EqualFold(ch, "collateral") {
+			return fmt.Errorf("sync.extra_channels 中的频道名无效: %q", ch)
+		}
+		if seen[ch] {
+			return fmt.Errorf("sync.extra_channels 中的频道重复: %q", ch)
+		}
+		seen[ch] = true
+	}
+	if len(c.Sync.Locales) == 0 {
+		return fmt.Errorf("sync.locales 不能为空")
+	}
+	for _, l := range c.Sync.Locales {
+		if !lcidPattern.MatchString(l) {
+			return fmt.Errorf("sync.locales 中的 LCID 无效: %q（应为 4 位十六进制，如 0409）", l)
+		}
+	}
+	if c.Sync.Segments < 1 || c.Sync.Segments > maxSegments {
+		return fmt.Errorf("sync.segments 无效: %d（应为 1 到 %d）", c.Sync.Segments, maxSegments)
+	}
+	if c.Sync.SegmentThresholdMB < 1 {
+		return fmt.Errorf("sync.segment_threshold_mb 无效: %d（至少为 1）", c.Sync.SegmentThresholdMB)
+	}
+	if _, err := ParseBandwidth(c.Sync.BandwidthLimit); err != nil {
+		return fmt.Errorf("sync.bandwidth_limit 无效: %w", err)
+	}
+	if c.Sync.HashPolicy != HashStrict && c.Sync.HashPolicy != HashLenient {
+		return fmt.Errorf("sync.hash_policy 无效: %q（可选 %s / %s）", c.Sync.HashPolicy, HashStrict, HashLenient)
+	}
+	if c.Sync.SignatureRoots != "" && len(c.Sync.SignatureTeams) == 0 {
+		return fmt.Errorf("sync.signature_teams 不能为空（已配置 sync.signature_roots）")
+	}
+	for i, w := range c.Sync.Schedule {
+		if err := w.validate(); err != nil {
+			return fmt.Errorf("sync.schedule[%d] 无效: %w", i, err)
+		}
+	}
+	if c.Sync.KeepVersions < 0 {
+		return fmt.Errorf("sync.keep_versions 不能为负: %d", c.Sync.KeepVersions)
+	}
+	for id, n := range c.Apps.KeepVersions {
+		if !appIDPattern.MatchString(id) || n < 0 {
+			return fmt.Errorf("apps.keep_versions 无效: %q → %d", id, n)
+		}
+	}
+	if err := c.Rollout.validate(); err != nil {
+		return err
+	}
+	if err := c.Admin.validate(); err != nil {
+		return err
+	}
+	if c.Sync.RequireApproval && c.Admin.TokensFile == "" {
+		return fmt.Errorf("sync.require_approval 需要配置 admin.tokens_file（审批只能通过需要认证的管理接口进行）")
+	}
+	for i, a := range c.Apps.Custom {
+		if !appIDPattern.MatchString(a.ID) {
+			return fmt.Errorf("apps.custom[%d] 的 id 无效: %q（应为 4 位语言代码加应用代码，如 0409MSWD2019）", i, a.ID)
+		}
+	}
+	for id, version := range c.Apps.Pins {
+		if !appIDPattern.MatchString(id) || strings.TrimSpace(version) == "" {
+			return fmt.Errorf("apps.pins 中的条目无效: %q → %q", id, version)
+		}
+	}
+	for name, path := range c.Channels {
+		if name == "" || path == "" {
+			return fmt.Errorf("channels 中存在空的频道名或路径: %q → %q", name, path)
+		}
+	}
+	return nil
+}
+
 // LogEffective 输出当前生效的配置（供启动时日志记录）
 func (c *Config) LogEffective(cfgPath string) map[string]interface{} {
 	source := "环境变量/默认值"
@@ -85,17 +371,43 @@ func (c *Config) LogEffective(cfgPath string) map[string]interface{} {
 		source = "YAML 文件: " + cfgPath
 	}
 	return map[string]interface{}{
-		"config_source": source,
-		"channel":       c.Sync.Channel,
-		"interval":      c.Sync.Interval.String(),
-		"concurrency":   c.Sync.Concurrency,
-		"retry_max":     c.Sync.RetryMax,
-		"retry_delay":   c.Sync.RetryDelay.String(),
-		"cache_dir":     c.Storage.CacheDir,
-		"scratch_dir":   c.Storage.ScratchDir,
-		"log_level":     c.Logging.Level,
-		"log_format":    c.Logging.Format,
-		"health_listen": c.Health.Listen,
+		"config_source":      source,
+		"channel":            c.Sync.Channel,
+		"extra_channels":     c.Sync.ExtraChannels,
+		"upstream":           c.Sync.Upstream,
+		"upstreams":          len(c.Sync.Upstreams),
+		"interval":           c.Sync.Interval.String(),
+		"concurrency":        c.Sync.Concurrency,
+		"retry_max":          c.Sync.RetryMax,
+		"retry_delay":        c.Sync.RetryDelay.String(),
+		"keep_versions":      c.Sync.KeepVersions,
+		"locales":            c.Sync.Locales,
+		"segments":           c.Sync.Segments,
+		"bandwidth":          c.Sync.BandwidthLimit,
+		"hash_policy":        c.Sync.HashPolicy,
+		"signature_roots":    c.Sync.SignatureRoots,
+		"signature_teams":    c.Sync.SignatureTeams,
+		"catalog_roots":      c.Sync.CatalogRoots,
+		"require_approval":   c.Sync.RequireApproval,
+		"apps_include":       c.Apps.Include,
+		"apps_exclude":       c.Apps.Exclude,
+		"apps_custom":        len(c.Apps.Custom),
+		"apps_pins":          c.Apps.Pins,
+		"apps_keep_versions": c.Apps.KeepVersions,
+		"cache_dir":          c.Storage.CacheDir,
+		"scratch_dir":        c.Storage.ScratchDir,
+		"state_dir":          c.Storage.StateDir,
+		"quarantine_dir":     c.Storage.QuarantineDir,
+		"log_level":          c.Logging.Level,
+		"log_format":         c.Logging.Format,
+		"health_listen":      c.Health.Listen,
+		"rollout_listen":     c.Rollout.Listen,
+		"rollout_rings":      len(c.Rollout.Rings),
+		"admin_listen":       c.Admin.Listen,
+		"admin_tokens_file":  c.Admin.TokensFile,
+		"http_proxy":         redactURL(c.HTTP.Proxy),
+		"ca_files":           len(c.HTTP.CAFiles),
+		"client_cert":        c.HTTP.ClientCert != "",
 	}
 }
 
@@ -107,6 +419,123 @@ func envOr(key, defaultVal string) string {
 	return defaultVal
 }
 
+// ParseBandwidth 把带宽字符串解析为字节/秒
+// 支持 bit 单位（Kbps / Mbps / Gbps）和 byte 单位（B/s、KB/s、MB/s、GB/s，/s 可省略），
+// 纯数字按字节/秒处理；空字符串或 0 表示不限速，返回 0
+func ParseBandwidth(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	lower := strings.ToLower(s)
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"gbps", 1e9 / 8}, {"mbps", 1e6 / 8}, {"kbps", 1e3 / 8}, {"bps", 1.0 / 8},
+		{"gb/s", 1 << 30}, {"mb/s", 1 << 20}, {"kb/s", 1 << 10}, {"b/s", 1},
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"b", 1},
+	}
+	factor := 1.0
+	num := lower
+	for _, u := range units {
+		if strings.HasSuffix(lower, u.suffix) {
+			factor = u.factor
+			num = strings.TrimSpace(strings.TrimSuffix(lower, u.suffix))
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("无法解析带宽 %q", s)
+	}
+	return int64(v * factor), nil
+}
+
+// listOr 读取逗号分隔的环境变量为切片，不存在则返回默认值
+func listOr(key string, defaultVal []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultVal
+	}
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// customAppsOr 读取逗号分隔的自定义应用，条目为 ID=名称（名称可省略），如
+// MAUCACHE_APPS_CUSTOM=0409MSWD2019=Word,0409WINAPP01
+func customAppsOr(key string) []CustomApp {
+	var out []CustomApp
+	for _, s := range listOr(key, nil) {
+		id, name, _ := strings.Cut(s, "=")
+		out = append(out, CustomApp{ID: strings.TrimSpace(id), Name: strings.TrimSpace(name)})
+	}
+	return out
+}
+
+// pinsOr 读取逗号分隔的版本固定，条目为 AppID=版本号，如
+// MAUCACHE_APPS_PINS=0409OPIM2019=16.92.24120731
+func pinsOr(key string) map[string]string {
+	entries := listOr(key, nil)
+	if len(entries) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(entries))
+	for _, s := range entries {
+		id, version, _ := strings.Cut(s, "=")
+		out[strings.TrimSpace(id)] = strings.TrimSpace(version)
+	}
+	return out
+}
+
+// keepVersionsOr 读取逗号分隔的按应用保留版本数，条目为 AppID=N，如
+// MAUCACHE_APPS_KEEP_VERSIONS=0409MSWD2019=3,0409MSau04=0；N 无法解析的条目忽略
+func keepVersionsOr(key string) map[string]int {
+	entries := listOr(key, nil)
+	if len(entries) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(entries))
+	for _, s := range entries {
+		id, n, _ := strings.Cut(s, "=")
+		if v, err := strconv.Atoi(strings.TrimSpace(n)); err == nil {
+			out[strings.TrimSpace(id)] = v
+		}
+	}
+	return out
+}
+
+// mirrorsOr 读取逗号分隔的镜像列表，条目带 flat: 前缀表示平铺目录，如
+// MAUCACHE_SYNC_UPSTREAMS=flat:http://parent-cache.corp,https://mirror.corp
+func mirrorsOr(key string) []UpstreamMirror {
+	var out []UpstreamMirror
+	for _, s := range listOr(key, nil) {
+		m := UpstreamMirror{URL: s}
+		if rest, ok := strings.CutPrefix(s, "flat:"); ok {
+			m = UpstreamMirror{URL: rest, Flat: true}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// redactURL 隐藏 URL 中的密码，用于日志输出
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(invalid)"
+	}
+	return u.Redacted()
+}
+
 // intOr 读取环境变量并解析为 int，失败则返回默认值
 func intOr(key string, defaultVal int) int {
 	if v := os.Getenv(key); v != "" {
@@ -117,6 +546,16 @@ func intOr(key string, defaultVal int) int {
 	return defaultVal
 }
 
+// boolOr 读取环境变量并解析为 bool（true/false/1/0 等），失败则返回默认值
+func boolOr(key string, defaultVal bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
 // durationOr 读取环境变量并解析为 time.Duration，失败则返回默认值
 func durationOr(key string, defaultVal time.Duration) time.Duration {
 	if v := os.Getenv(key); v != "" {
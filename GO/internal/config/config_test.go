@@ -11,15 +11,51 @@ func clearEnv(t *testing.T) {
 	t.Helper()
 	for _, key := range []string{
 		"MAUCACHE_SYNC_CHANNEL",
+		"MAUCACHE_SYNC_UPSTREAM",
+		"MAUCACHE_SYNC_UPSTREAMS",
+		"MAUCACHE_SYNC_HASH_POLICY",
+		"MAUCACHE_SYNC_SIGNATURE_ROOTS",
+		"MAUCACHE_SYNC_SIGNATURE_TEAMS",
+		"MAUCACHE_SYNC_CATALOG_ROOTS",
+		"MAUCACHE_SYNC_MIRROR_COOLDOWN",
 		"MAUCACHE_SYNC_INTERVAL",
 		"MAUCACHE_SYNC_CONCURRENCY",
 		"MAUCACHE_SYNC_RETRY_MAX",
 		"MAUCACHE_SYNC_RETRY_DELAY",
+		"MAUCACHE_SYNC_LOCALES",
+		"MAUCACHE_SYNC_EXTRA_CHANNELS",
+		"MAUCACHE_SYNC_BREAKER_THRESHOLD",
+		"MAUCACHE_SYNC_BREAKER_COOLDOWN",
+		"MAUCACHE_SYNC_SEGMENTS",
+		"MAUCACHE_SYNC_SEGMENT_THRESHOLD_MB",
+		"MAUCACHE_SYNC_BANDWIDTH_LIMIT",
 		"MAUCACHE_CACHE_DIR",
 		"MAUCACHE_SCRATCH_DIR",
+		"MAUCACHE_STATE_DIR",
+		"MAUCACHE_QUARANTINE_DIR",
 		"MAUCACHE_LOG_LEVEL",
 		"MAUCACHE_LOG_FORMAT",
 		"MAUCACHE_HEALTH_LISTEN",
+		"MAUCACHE_HTTP_PROXY",
+		"MAUCACHE_HTTP_NO_PROXY",
+		"MAUCACHE_HTTP_PROXY_USER",
+		"MAUCACHE_HTTP_PROXY_PASSWORD_FILE",
+		"MAUCACHE_HTTP_PROXY_PASSWORD_ENV",
+		"MAUCACHE_HTTP_CA_FILES",
+		"MAUCACHE_HTTP_CLIENT_CERT",
+		"MAUCACHE_HTTP_CLIENT_KEY",
+		"MAUCACHE_HTTP_TLS_MIN_VERSION",
+		"MAUCACHE_APPS_INCLUDE",
+		"MAUCACHE_APPS_EXCLUDE",
+		"MAUCACHE_APPS_CUSTOM",
+		"MAUCACHE_APPS_PINS",
+		"MAUCACHE_SYNC_REQUIRE_APPROVAL",
+		"MAUCACHE_ROLLOUT_LISTEN",
+		"MAUCACHE_SYNC_KEEP_VERSIONS",
+		"MAUCACHE_APPS_KEEP_VERSIONS",
+		"MAUCACHE_ROLLOUT_TRUSTED_PROXIES",
+		"MAUCACHE_ADMIN_LISTEN",
+		"MAUCACHE_ADMIN_TOKENS_FILE",
 	} {
 		t.Setenv(key, "")
 		os.Unsetenv(key)
@@ -45,12 +81,24 @@ func TestDefaultValues(t *testing.T) {
 	if cfg.Sync.RetryDelay != 5*time.Second {
 		t.Errorf("RetryDelay = %v, want %v", cfg.Sync.RetryDelay, 5*time.Second)
 	}
+	if cfg.Sync.Segments != 1 {
+		t.Errorf("Segments = %d, want %d", cfg.Sync.Segments, 1)
+	}
+	if cfg.Sync.SegmentThresholdMB != 100 {
+		t.Errorf("SegmentThresholdMB = %d, want %d", cfg.Sync.SegmentThresholdMB, 100)
+	}
 	if cfg.Storage.CacheDir != "/data/maucache" {
 		t.Errorf("CacheDir = %q, want %q", cfg.Storage.CacheDir, "/data/maucache")
 	}
 	if cfg.Storage.ScratchDir != "/data/maucache/.tmp" {
 		t.Errorf("ScratchDir = %q, want %q", cfg.Storage.ScratchDir, "/data/maucache/.tmp")
 	}
+	if cfg.Storage.StateDir != "/data/maucache/.state" {
+		t.Errorf("StateDir = %q, want %q", cfg.Storage.StateDir, "/data/maucache/.state")
+	}
+	if cfg.Storage.QuarantineDir != "/data/maucache/.quarantine" {
+		t.Errorf("QuarantineDir = %q, want %q", cfg.Storage.QuarantineDir, "/data/maucache/.quarantine")
+	}
 	if cfg.Logging.Level != "info" {
 		t.Errorf("Level = %q, want %q", cfg.Logging.Level, "info")
 	}
@@ -214,3 +262,367 @@ func TestInvalidEnvFallsBackToDefaults(t *testing.T) {
 		t.Errorf("RetryDelay = %v, want default %v", cfg.Sync.RetryDelay, 5*time.Second)
 	}
 }
+
+func TestUpstreamAndChannelsFromYAML(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	yamlContent := `
+sync:
+  channel: Insider
+  upstream: http://parent-cache.local
+channels:
+  Insider: 11111111-2222-3333-4444-555555555555
+`
+	if err := os.WriteFile(yamlPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load(yamlPath)
+
+	if cfg.Sync.Upstream != "http://parent-cache.local" {
+		t.Errorf("Upstream = %q, want %q", cfg.Sync.Upstream, "http://parent-cache.local")
+	}
+	if cfg.Channels["Insider"] != "11111111-2222-3333-4444-555555555555" {
+		t.Errorf("Channels[Insider] = %q", cfg.Channels["Insider"])
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestValidateRejectsBadUpstream(t *testing.T) {
+	clearEnv(t)
+	cfg := Load("")
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default config should be valid: %v", err)
+	}
+
+	cfg.Sync.Upstream = "officecdnmac.microsoft.com"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject upstream without scheme")
+	}
+}
+
+func TestUpstreamMirrors(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MAUCACHE_SYNC_UPSTREAMS", "flat:http://parent-cache.local, https://mirror.local")
+	cfg := Load("")
+	want := []UpstreamMirror{
+		{URL: "http://parent-cache.local", Flat: true},
+		{URL: "https://mirror.local"},
+	}
+	if len(cfg.Sync.Upstreams) != len(want) {
+		t.Fatalf("Upstreams = %+v, want %+v", cfg.Sync.Upstreams, want)
+	}
+	for i := range want {
+		if cfg.Sync.Upstreams[i] != want[i] {
+			t.Errorf("Upstreams[%d] = %+v, want %+v", i, cfg.Sync.Upstreams[i], want[i])
+		}
+	}
+	if cfg.Sync.MirrorCooldown != 5*time.Minute {
+		t.Errorf("MirrorCooldown = %v, want 5m", cfg.Sync.MirrorCooldown)
+	}
+
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	yamlContent := `
+sync:
+  mirror_cooldown: 1m
+  upstreams:
+    - url: http://regional.local
+      flat: true
+    - url: not-a-url
+`
+	if err := os.WriteFile(yamlPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg = Load(yamlPath)
+	if len(cfg.Sync.Upstreams) != 2 || !cfg.Sync.Upstreams[0].Flat || cfg.Sync.MirrorCooldown != time.Minute {
+		t.Fatalf("yaml upstreams = %+v, cooldown %v", cfg.Sync.Upstreams, cfg.Sync.MirrorCooldown)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject mirror without scheme")
+	}
+}
+
+func TestHTTPConfigFromYAMLAndEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MAUCACHE_HTTP_NO_PROXY", "localhost, .corp.local")
+
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	yamlContent := `
+http:
+  proxy: http://proxy.corp.local:3128
+  proxy_user: svc-maucache
+  ca_files:
+    - /etc/ssl/corp-root.pem
+  tls_min_version: "1.3"
+`
+	if err := os.WriteFile(yamlPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load(yamlPath)
+
+	if cfg.HTTP.Proxy != "http://proxy.corp.local:3128" {
+		t.Errorf("Proxy = %q", cfg.HTTP.Proxy)
+	}
+	if len(cfg.HTTP.NoProxy) != 2 || cfg.HTTP.NoProxy[1] != ".corp.local" {
+		t.Errorf("NoProxy = %v, want [localhost .corp.local]", cfg.HTTP.NoProxy)
+	}
+	if len(cfg.HTTP.CAFiles) != 1 || cfg.HTTP.CAFiles[0] != "/etc/ssl/corp-root.pem" {
+		t.Errorf("CAFiles = %v", cfg.HTTP.CAFiles)
+	}
+	if cfg.HTTP.TLSMinVersion != "1.3" {
+		t.Errorf("TLSMinVersion = %q, want %q", cfg.HTTP.TLSMinVersion, "1.3")
+	}
+}
+
+func TestProxyPasswordSources(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	pwFile := filepath.Join(dir, "proxy-password")
+	if err := os.WriteFile(pwFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CORP_PROXY_PASSWORD", "from-env")
+
+	h := HTTPConfig{ProxyPasswordFile: pwFile, ProxyPasswordEnv: "CORP_PROXY_PASSWORD"}
+	if pw, err := h.ProxyPassword(); err != nil || pw != "from-file" {
+		t.Errorf("ProxyPassword() = %q, %v; want file value to take precedence", pw, err)
+	}
+
+	h.ProxyPasswordFile = ""
+	if pw, err := h.ProxyPassword(); err != nil || pw != "from-env" {
+		t.Errorf("ProxyPassword() = %q, %v; want %q", pw, err, "from-env")
+	}
+
+	h.ProxyPasswordFile = filepath.Join(dir, "missing")
+	if _, err := h.ProxyPassword(); err == nil {
+		t.Error("ProxyPassword() should fail when the file is missing")
+	}
+}
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"1048576", 1048576, false},
+		{"5MB/s", 5 * 1024 * 1024, false},
+		{"512 KB", 512 * 1024, false},
+		{"20Mbps", 2_500_000, false},
+		{"1Gbps", 125_000_000, false},
+		{"fast", 0, true},
+		{"-1MB/s", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBandwidth(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBandwidth(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBandwidth(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashPolicy(t *testing.T) {
+	clearEnv(t)
+	cfg := Load("")
+	if cfg.Sync.HashPolicy != HashStrict {
+		t.Errorf("HashPolicy = %q, want %q", cfg.Sync.HashPolicy, HashStrict)
+	}
+
+	t.Setenv("MAUCACHE_SYNC_HASH_POLICY", "lenient")
+	if cfg := Load(""); cfg.Sync.HashPolicy != HashLenient || cfg.Validate() != nil {
+		t.Errorf("HashPolicy = %q, Validate = %v", cfg.Sync.HashPolicy, cfg.Validate())
+	}
+
+	cfg.Sync.HashPolicy = "sometimes"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject unknown hash policy")
+	}
+}
+
+func TestAppsFromYAMLAndEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MAUCACHE_APPS_EXCLUDE", "0409MSFB16, Teams 1.0*")
+	t.Setenv("MAUCACHE_APPS_CUSTOM", "0409WINAPP01=Windows App,0409TEST01")
+	cfg := Load("")
+	if len(cfg.Apps.Exclude) != 2 || cfg.Apps.Exclude[1] != "Teams 1.0*" {
+		t.Errorf("Exclude = %q", cfg.Apps.Exclude)
+	}
+	want := []CustomApp{{ID: "0409WINAPP01", Name: "Windows App"}, {ID: "0409TEST01"}}
+	if len(cfg.Apps.Custom) != 2 || cfg.Apps.Custom[0] != want[0] || cfg.Apps.Custom[1] != want[1] {
+		t.Errorf("Custom = %+v, want %+v", cfg.Apps.Custom, want)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+apps:
+  include: ["*2019", "Edge"]
+  custom:
+    - id: 0409WINAPP01
+      name: Windows App
+`), 0644)
+	cfg = Load(path)
+	if len(cfg.Apps.Include) != 2 || len(cfg.Apps.Custom) != 1 || cfg.Apps.Custom[0].Name != "Windows App" {
+		t.Errorf("Apps = %+v", cfg.Apps)
+	}
+
+	cfg.Apps.Custom = append(cfg.Apps.Custom, CustomApp{ID: "Word"})
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject a custom app ID without an LCID prefix")
+	}
+}
+
+func TestLocales(t *testing.T) {
+	clearEnv(t)
+	cfg := Load("")
+	if len(cfg.Sync.Locales) != 1 || cfg.Sync.Locales[0] != "0409" {
+		t.Errorf("Locales = %q, want [0409]", cfg.Sync.Locales)
+	}
+
+	t.Setenv("MAUCACHE_SYNC_LOCALES", "0409, 0407,040C")
+	cfg = Load("")
+	if len(cfg.Sync.Locales) != 3 || cfg.Sync.Locales[2] != "040C" {
+		t.Errorf("Locales = %q", cfg.Sync.Locales)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	cfg.Sync.Locales = []string{"de-DE"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject a locale that is not an LCID")
+	}
+	cfg.Sync.Locales = nil
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject an empty locale list")
+	}
+}
+
+func TestExtraChannels(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MAUCACHE_SYNC_EXTRA_CHANNELS", "Preview,Beta")
+	cfg := Load("")
+	if len(cfg.Sync.ExtraChannels) != 2 || cfg.Sync.ExtraChannels[1] != "Beta" {
+		t.Errorf("ExtraChannels = %q", cfg.Sync.ExtraChannels)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	for _, bad := range []string{"", "../Beta", ".tmp", "collateral", "Preview"} {
+		cfg.Sync.ExtraChannels = []string{"Preview", bad}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() should reject extra channel %q", bad)
+		}
+	}
+}
+
+func TestPins(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MAUCACHE_APPS_PINS", "0409OPIM2019=16.92.24120731, 0409MSWD2019 = 16.91")
+	cfg := Load("")
+	if len(cfg.Apps.Pins) != 2 || cfg.Apps.Pins["0409MSWD2019"] != "16.91" {
+		t.Errorf("Pins = %v", cfg.Apps.Pins)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	cfg.Apps.Pins = map[string]string{"0409OPIM2019": ""}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject a pin without a version")
+	}
+	cfg.Apps.Pins = map[string]string{"not an id": "16.92"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject a pin with a malformed app ID")
+	}
+}
+
+func TestRequireApproval(t *testing.T) {
+	clearEnv(t)
+	if Load("").Sync.RequireApproval {
+		t.Error("approval mode should be off by default")
+	}
+	t.Setenv("MAUCACHE_SYNC_REQUIRE_APPROVAL", "true")
+	cfg := Load("")
+	if !cfg.Sync.RequireApproval {
+		t.Error("MAUCACHE_SYNC_REQUIRE_APPROVAL=true should enable approval mode")
+	}
+	// Approvals are only accepted on the authenticated admin listener
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should require admin.tokens_file in approval mode")
+	}
+	cfg.Admin.TokensFile = "/run/secrets/maucache-tokens"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	t.Setenv("MAUCACHE_SYNC_REQUIRE_APPROVAL", "maybe")
+	if Load("").Sync.RequireApproval {
+		t.Error("an unparsable value should fall back to the default")
+	}
+}
+
+func TestKeepVersions(t *testing.T) {
+	clearEnv(t)
+	if cfg := Load(""); cfg.Sync.KeepVersions != 0 || cfg.Apps.KeepVersions != nil {
+		t.Errorf("defaults: keep_versions = %d, %v", cfg.Sync.KeepVersions, cfg.Apps.KeepVersions)
+	}
+	t.Setenv("MAUCACHE_SYNC_KEEP_VERSIONS", "2")
+	t.Setenv("MAUCACHE_APPS_KEEP_VERSIONS", "0409MSWD2019=5, 0409MSau04=0,0409XCEL2019=x")
+	cfg := Load("")
+	if cfg.Sync.KeepVersions != 2 {
+		t.Errorf("Sync.KeepVersions = %d, want 2", cfg.Sync.KeepVersions)
+	}
+	if len(cfg.Apps.KeepVersions) != 2 || cfg.Apps.KeepVersions["0409MSWD2019"] != 5 || cfg.Apps.KeepVersions["0409MSau04"] != 0 {
+		t.Errorf("Apps.KeepVersions = %v", cfg.Apps.KeepVersions)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	cfg.Sync.KeepVersions = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject a negative sync.keep_versions")
+	}
+	cfg.Sync.KeepVersions = 0
+	cfg.Apps.KeepVersions = map[string]int{"0409MSWD2019": -1}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject a negative per-app keep_versions")
+	}
+}
+
+func TestValidateSegments(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MAUCACHE_SYNC_SEGMENTS", "8")
+	t.Setenv("MAUCACHE_SYNC_SEGMENT_THRESHOLD_MB", "50")
+	cfg := Load("")
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	for _, tc := range []struct {
+		segments, thresholdMB int
+	}{
+		{0, 50}, {-1, 50}, {maxSegments + 1, 50}, {4, 0}, {4, -10},
+	} {
+		cfg.Sync.Segments, cfg.Sync.SegmentThresholdMB = tc.segments, tc.thresholdMB
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() should reject segments=%d segment_threshold_mb=%d", tc.segments, tc.thresholdMB)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// RolloutConfig 分批发布：maucache 自己提供编录，按客户端地址所在的发布环返回不同版本的编录
+// 例如试点网段立即拿到新版本，其余网段一周后才拿到。安装包等其他文件按缓存目录原样提供
+type RolloutConfig struct {
+	Listen string `yaml:"listen"` // 编录服务监听地址，如 :8081；为空不启用
+
+	// TrustedProxies 可信反向代理的地址段：来自这些地址的请求按 X-Forwarded-For 取客户端地址
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// Rings 发布环，按顺序取第一个包含客户端地址的环；都不包含的客户端拿到最新发布的编录
+	Rings []RolloutRing `yaml:"rings"`
+}
+
+// RolloutRing 一个发布环
+type RolloutRing struct {
+	Name  string   `yaml:"name"`
+	CIDRs []string `yaml:"cidrs"` // 如 10.1.20.0/24、2001:db8::/48
+
+	// Delay 新版本发布多久后才提供给该环，0 表示立即
+	Delay time.Duration `yaml:"delay"`
+
+	// Pins 该环固定的版本：AppID → 版本号，优先于 Delay
+	Pins map[string]string `yaml:"pins"`
+}
+
+// Ring 返回包含 addr 的第一个发布环，都不包含时返回 nil
+func (r RolloutConfig) Ring(addr netip.Addr) *RolloutRing {
+	addr = addr.Unmap()
+	for i := range r.Rings {
+		for _, c := range r.Rings[i].CIDRs {
+			if p, err := netip.ParsePrefix(strings.TrimSpace(c)); err == nil && p.Contains(addr) {
+				return &r.Rings[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Trusted 判断 addr 是否为可信反向代理
+func (r RolloutConfig) Trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, c := range r.TrustedProxies {
+		if p, err := netip.ParsePrefix(strings.TrimSpace(c)); err == nil && p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate 检查分批发布配置
+func (r RolloutConfig) validate() error {
+	if len(r.Rings) > 0 && r.Listen == "" {
+		return fmt.Errorf("配置了 rollout.rings 但未设置 rollout.listen")
+	}
+	for _, c := range r.TrustedProxies {
+		if _, err := netip.ParsePrefix(strings.TrimSpace(c)); err != nil {
+			return fmt.Errorf("rollout.trusted_proxies 中的地址段无效: %q", c)
+		}
+	}
+	seen := make(map[string]bool)
+	for i, ring := range r.Rings {
+		if ring.Name == "" {
+			return fmt.Errorf("rollout.rings[%d] 缺少 name", i)
+		}
+		if seen[ring.Name] {
+			return fmt.Errorf("rollout.rings 中的环名重复: %s", ring.Name)
+		}
+		seen[ring.Name] = true
+		if len(ring.CIDRs) == 0 {
+			return fmt.Errorf("rollout.rings[%s] 缺少 cidrs", ring.Name)
+		}
+		for _, c := range ring.CIDRs {
+			if _, err := netip.ParsePrefix(strings.TrimSpace(c)); err != nil {
+				return fmt.Errorf("rollout.rings[%s] 中的地址段无效: %q", ring.Name, c)
+			}
+		}
+		if ring.Delay < 0 {
+			return fmt.Errorf("rollout.rings[%s] 的 delay 不能为负: %s", ring.Name, ring.Delay)
+		}
+		for id, version := range ring.Pins {
+			if !appIDPattern.MatchString(id) || strings.TrimSpace(version) == "" {
+				return fmt.Errorf("rollout.rings[%s] 的版本固定无效: %q → %q", ring.Name, id, version)
+			}
+		}
+	}
+	return nil
+}
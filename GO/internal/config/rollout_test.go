@@ -0,0 +1,72 @@
+package config
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRolloutFromYAML(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+rollout:
+  listen: ":8081"
+  rings:
+    - name: pilot
+      cidrs: ["10.1.20.0/24", "2001:db8::/48"]
+    - name: broad
+      cidrs: ["10.0.0.0/8"]
+      delay: 168h
+      pins:
+        0409MSWD2019: "16.92"
+`), 0644)
+	cfg := Load(path)
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	if len(cfg.Rollout.Rings) != 2 || cfg.Rollout.Rings[1].Delay != 168*time.Hour || cfg.Rollout.Rings[1].Pins["0409MSWD2019"] != "16.92" {
+		t.Errorf("rings = %+v", cfg.Rollout.Rings)
+	}
+
+	for addr, want := range map[string]string{
+		"10.1.20.7":          "pilot",
+		"::ffff:10.1.20.7":   "pilot",
+		"2001:db8::1":        "pilot",
+		"10.9.0.1":           "broad",
+		"192.0.2.1":          "",
+		"2001:db8:ffff::abc": "",
+	} {
+		got := ""
+		if ring := cfg.Rollout.Ring(netip.MustParseAddr(addr)); ring != nil {
+			got = ring.Name
+		}
+		if got != want {
+			t.Errorf("Ring(%s) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestRolloutValidate(t *testing.T) {
+	valid := RolloutRing{Name: "pilot", CIDRs: []string{"10.1.0.0/24"}}
+	cases := map[string]RolloutConfig{
+		"rings without listen": {Rings: []RolloutRing{valid}},
+		"bad proxy":            {Listen: ":8081", TrustedProxies: []string{"10.0.0.1"}},
+		"missing name":         {Listen: ":8081", Rings: []RolloutRing{{CIDRs: valid.CIDRs}}},
+		"duplicate name":       {Listen: ":8081", Rings: []RolloutRing{valid, valid}},
+		"missing cidrs":        {Listen: ":8081", Rings: []RolloutRing{{Name: "pilot"}}},
+		"bad cidr":             {Listen: ":8081", Rings: []RolloutRing{{Name: "pilot", CIDRs: []string{"10.1.0.0/33"}}}},
+		"negative delay":       {Listen: ":8081", Rings: []RolloutRing{{Name: "pilot", CIDRs: valid.CIDRs, Delay: -time.Hour}}},
+		"bad pin":              {Listen: ":8081", Rings: []RolloutRing{{Name: "pilot", CIDRs: valid.CIDRs, Pins: map[string]string{"0409MSWD2019": ""}}}},
+	}
+	for name, r := range cases {
+		if err := r.validate(); err == nil {
+			t.Errorf("%s: validate() should fail", name)
+		}
+	}
+	if err := (RolloutConfig{Listen: ":8081", TrustedProxies: []string{"10.0.0.1/32"}, Rings: []RolloutRing{valid}}).validate(); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScheduleWindow 时段调度窗口：在指定星期的时间段内覆盖带宽和并发数
+// 例如工作日 08:00-18:00 限速 2Mbps、并发 1，其余时间沿用 sync 的默认值
+type ScheduleWindow struct {
+	Days           []string `yaml:"days"`            // mon / tue / ... / sun，空表示每天
+	Start          string   `yaml:"start"`           // HH:MM（本地时区，容器内由 TZ 决定）
+	End            string   `yaml:"end"`             // HH:MM，早于 Start 表示跨午夜
+	BandwidthLimit string   `yaml:"bandwidth_limit"` // 窗口内的限速，空表示沿用默认
+	Concurrency    int      `yaml:"concurrency"`     // 窗口内的并发数，0 表示沿用默认
+}
+
+// Limits 某一时刻生效的带宽和并发限制
+type Limits struct {
+	BandwidthLimit string `json:"bandwidth_limit"`
+	Concurrency    int    `json:"concurrency"`
+	Window         string `json:"window,omitempty"` // 命中的窗口描述，未命中为空
+}
+
+// weekdays 星期缩写 → time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// LimitsAt 返回 t 时刻生效的限制：按配置顺序取第一个命中的窗口，未命中则用默认值
+func (s SyncConfig) LimitsAt(t time.Time) Limits {
+	limits := Limits{BandwidthLimit: s.BandwidthLimit, Concurrency: s.Concurrency}
+	for _, w := range s.Schedule {
+		if !w.Contains(t) {
+			continue
+		}
+		if w.BandwidthLimit != "" {
+			limits.BandwidthLimit = w.BandwidthLimit
+		}
+		if w.Concurrency > 0 {
+			limits.Concurrency = w.Concurrency
+		}
+		limits.Window = w.String()
+		break
+	}
+	return limits
+}
+
+// MaxConcurrency 返回默认值和各窗口中最大的并发数，下载工作池按此大小创建
+func (s SyncConfig) MaxConcurrency() int {
+	n := s.Concurrency
+	for _, w := range s.Schedule {
+		n = max(n, w.Concurrency)
+	}
+	return max(n, 1)
+}
+
+// Contains 判断 t 是否落在窗口内；跨午夜的窗口按开始那天的星期判断
+func (w ScheduleWindow) Contains(t time.Time) bool {
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return w.onDay(t.Weekday()) && m >= start && m < end
+	}
+	if m >= start {
+		return w.onDay(t.Weekday())
+	}
+	return m < end && w.onDay(t.AddDate(0, 0, -1).Weekday())
+}
+
+// onDay 判断窗口是否适用于某个星期
+func (w ScheduleWindow) onDay(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, name := range w.Days {
+		if wd, ok := weekdays[strings.ToLower(strings.TrimSpace(name))]; ok && wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// String 返回窗口的可读描述，用于日志和状态输出
+func (w ScheduleWindow) String() string {
+	days := "every day"
+	if len(w.Days) > 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	return fmt.Sprintf("%s %s-%s", days, w.Start, w.End)
+}
+
+// validate 检查窗口配置
+func (w ScheduleWindow) validate() error {
+	if _, err := parseClock(w.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return err
+	}
+	if w.Start == w.End {
+		return fmt.Errorf("开始和结束时间相同: %s", w.Start)
+	}
+	for _, d := range w.Days {
+		if _, ok := weekdays[strings.ToLower(strings.TrimSpace(d))]; !ok {
+			return fmt.Errorf("无法识别的星期: %q", d)
+		}
+	}
+	if _, err := ParseBandwidth(w.BandwidthLimit); err != nil {
+		return err
+	}
+	if w.Concurrency < 0 {
+		return fmt.Errorf("并发数不能为负: %d", w.Concurrency)
+	}
+	return nil
+}
+
+// parseClock 解析 HH:MM 为当天的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("无法解析时间 %q（格式 HH:MM）", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func at(weekday time.Weekday, hour, min int) time.Time {
+	// 2025-01-05 is a Sunday
+	return time.Date(2025, 1, 5+int(weekday), hour, min, 0, 0, time.Local)
+}
+
+func TestScheduleWindowContains(t *testing.T) {
+	business := ScheduleWindow{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "18:00"}
+	overnight := ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+
+	tests := []struct {
+		name   string
+		window ScheduleWindow
+		t      time.Time
+		want   bool
+	}{
+		{"business start", business, at(time.Monday, 8, 0), true},
+		{"business before", business, at(time.Monday, 7, 59), false},
+		{"business end exclusive", business, at(time.Friday, 18, 0), false},
+		{"business weekend", business, at(time.Saturday, 12, 0), false},
+		{"overnight same day", overnight, at(time.Friday, 23, 0), true},
+		{"overnight next morning", overnight, at(time.Saturday, 5, 59), true},
+		{"overnight wrong day", overnight, at(time.Thursday, 23, 0), false},
+		{"overnight after end", overnight, at(time.Saturday, 6, 0), false},
+		{"every day", ScheduleWindow{Start: "00:00", End: "01:00"}, at(time.Sunday, 0, 30), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitsAt(t *testing.T) {
+	s := SyncConfig{
+		Concurrency:    8,
+		BandwidthLimit: "",
+		Schedule: []ScheduleWindow{
+			{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "18:00", BandwidthLimit: "2Mbps", Concurrency: 1},
+			{Start: "00:00", End: "23:59", BandwidthLimit: "50Mbps"},
+		},
+	}
+
+	work := s.LimitsAt(at(time.Wednesday, 9, 0))
+	if work.BandwidthLimit != "2Mbps" || work.Concurrency != 1 {
+		t.Errorf("business hours limits = %+v", work)
+	}
+	if work.Window == "" {
+		t.Error("Window should describe the matching window")
+	}
+
+	// First matching window wins; unspecified concurrency keeps the default
+	night := s.LimitsAt(at(time.Wednesday, 20, 0))
+	if night.BandwidthLimit != "50Mbps" || night.Concurrency != 8 {
+		t.Errorf("night limits = %+v", night)
+	}
+
+	none := SyncConfig{Concurrency: 4, BandwidthLimit: "10MB/s"}.LimitsAt(at(time.Monday, 9, 0))
+	if none.BandwidthLimit != "10MB/s" || none.Concurrency != 4 || none.Window != "" {
+		t.Errorf("defaults = %+v", none)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	s := SyncConfig{
+		Concurrency: 2,
+		Schedule: []ScheduleWindow{
+			{Start: "08:00", End: "18:00", Concurrency: 1},
+			{Start: "22:00", End: "06:00", Concurrency: 6},
+			{Start: "18:00", End: "22:00", BandwidthLimit: "5Mbps"},
+		},
+	}
+	if n := s.MaxConcurrency(); n != 6 {
+		t.Errorf("MaxConcurrency() = %d, want 6", n)
+	}
+	if n := (SyncConfig{Concurrency: 3}).MaxConcurrency(); n != 3 {
+		t.Errorf("MaxConcurrency() without schedule = %d, want 3", n)
+	}
+	if n := (SyncConfig{}).MaxConcurrency(); n != 1 {
+		t.Errorf("MaxConcurrency() with zero concurrency = %d, want 1", n)
+	}
+}
+
+func TestScheduleFromYAMLAndValidate(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	yamlContent := `
+sync:
+  concurrency: 8
+  schedule:
+    - days: [mon, tue, wed, thu, fri]
+      start: "08:00"
+      end: "18:00"
+      bandwidth_limit: 2Mbps
+      concurrency: 1
+`
+	if err := os.WriteFile(yamlPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load(yamlPath)
+	if len(cfg.Sync.Schedule) != 1 || cfg.Sync.Schedule[0].Concurrency != 1 {
+		t.Fatalf("Schedule = %+v", cfg.Sync.Schedule)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	bad := []ScheduleWindow{
+		{Start: "8am", End: "18:00"},
+		{Start: "08:00", End: "08:00"},
+		{Days: []string{"funday"}, Start: "08:00", End: "18:00"},
+		{Start: "08:00", End: "18:00", BandwidthLimit: "lots"},
+	}
+	for _, w := range bad {
+		cfg.Sync.Schedule = []ScheduleWindow{w}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() should reject %+v", w)
+		}
+	}
+}
@@ -19,6 +19,14 @@ type Tracker struct {
 	skipped    int
 	failed     int
 	duration   time.Duration
+	failedApps []string // 最近一次同步中清单获取失败的应用
+
+	channels map[string]ChannelStatus // 各频道最近一次同步的结果
+
+	// 其他模块注册的附加状态（如限速器），在 /sync/status 中按 key 输出
+	extras map[string]func() interface{}
+	// 其他模块注册的管理接口（如版本固定），Serve 时挂到同一个端口
+	handlers map[string]http.Handler
 }
 
 // NewTracker 创建状态追踪器
@@ -42,8 +50,97 @@ func (t *Tracker) RecordSync(downloaded, skipped, failed int, dur time.Duration)
 	t.mu.Unlock()
 }
 
-// Serve 启动健康检查 HTTP 服务
-func Serve(ctx context.Context, addr string, t *Tracker, log *slog.Logger) {
+// SetFailedApps 记录最近一次同步中清单获取失败的应用
+func (t *Tracker) SetFailedApps(appIDs []string) {
+	t.mu.Lock()
+	t.failedApps = appIDs
+	t.mu.Unlock()
+}
+
+// ChannelStatus 单个频道最近一次同步的结果
+type ChannelStatus struct {
+	CacheDir   string    `json:"cache_dir"`
+	LastSync   time.Time `json:"last_sync"`
+	Downloaded int       `json:"downloaded"`
+	Linked     int       `json:"linked"` // 从其他频道硬链接、无需下载的文件
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	FailedApps []string  `json:"failed_apps,omitempty"`
+	Duration   string    `json:"duration"`
+	Error      string    `json:"error,omitempty"` // 该频道同步中止的原因
+
+	BuildsSource string `json:"builds_source,omitempty"` // 过滤增量包的构建列表来源：channel / history / production
+	Builds       int    `json:"builds"`                  // 构建列表中的版本数
+}
+
+// RecordChannel 记录单个频道的同步结果
+func (t *Tracker) RecordChannel(name string, s ChannelStatus) {
+	t.mu.Lock()
+	if t.channels == nil {
+		t.channels = make(map[string]ChannelStatus)
+	}
+	t.channels[name] = s
+	t.mu.Unlock()
+}
+
+// RegisterStatus 注册附加状态，/sync/status 请求时调用 fn 取当前值
+// 用于暴露同步过程中实时变化的数据（限速器速率等），key 重复时覆盖
+func (t *Tracker) RegisterStatus(key string, fn func() interface{}) {
+	t.mu.Lock()
+	if t.extras == nil {
+		t.extras = make(map[string]func() interface{})
+	}
+	t.extras[key] = fn
+	t.mu.Unlock()
+}
+
+// RegisterHandler 注册管理接口，pattern 使用 http.ServeMux 的写法（如 "POST /apps/{id}/pin"）
+// 需在 Serve 之前注册
+func (t *Tracker) RegisterHandler(pattern string, h http.Handler) {
+	t.mu.Lock()
+	if t.handlers == nil {
+		t.handlers = make(map[string]http.Handler)
+	}
+	t.handlers[pattern] = h
+	t.mu.Unlock()
+}
+
+// Status 返回 /sync/status 的内容
+func (t *Tracker) Status() map[string]interface{} {
+	t.mu.RLock()
+	status := map[string]interface{}{
+		"running":    t.running,
+		"last_sync":  t.lastSync,
+		"downloaded": t.downloaded,
+		"skipped":    t.skipped,
+		"failed":     t.failed,
+		"duration":   t.duration.String(),
+	}
+	if len(t.failedApps) > 0 {
+		status["failed_apps"] = t.failedApps
+	}
+	if len(t.channels) > 0 {
+		channels := make(map[string]ChannelStatus, len(t.channels))
+		for name, s := range t.channels {
+			channels[name] = s
+		}
+		status["channels"] = channels
+	}
+	extras := make(map[string]func() interface{}, len(t.extras))
+	for key, fn := range t.extras {
+		extras[key] = fn
+	}
+	t.mu.RUnlock()
+
+	// 附加状态的回调会获取各自的锁，在释放 t.mu 之后调用，避免锁嵌套
+	for key, fn := range extras {
+		status[key] = fn()
+	}
+	return status
+}
+
+// Handler 返回 /healthz、/sync/status 和已注册管理接口的路由
+func (t *Tracker) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -52,22 +149,23 @@ func Serve(ctx context.Context, addr string, t *Tracker, log *slog.Logger) {
 	})
 
 	mux.HandleFunc("/sync/status", func(w http.ResponseWriter, r *http.Request) {
-		t.mu.RLock()
-		defer t.mu.RUnlock()
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"running":    t.running,
-			"last_sync":  t.lastSync,
-			"downloaded": t.downloaded,
-			"skipped":    t.skipped,
-			"failed":     t.failed,
-			"duration":   t.duration.String(),
-		})
+		_ = json.NewEncoder(w).Encode(t.Status())
 	})
 
+	t.mu.RLock()
+	for pattern, h := range t.handlers {
+		mux.Handle(pattern, h)
+	}
+	t.mu.RUnlock()
+	return mux
+}
+
+// Serve 启动健康检查 HTTP 服务
+func Serve(ctx context.Context, addr string, t *Tracker, log *slog.Logger) {
 	srv := &http.Server{
 		Addr:              addr,
-		Handler:           mux,
+		Handler:           t.Handler(),
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 	go func() {
@@ -155,6 +155,88 @@ func TestSyncStatusEndpoint(t *testing.T) {
 	}
 }
 
+func TestRegisterStatusAppearsInStatus(t *testing.T) {
+	tr := NewTracker()
+	rate := int64(1024)
+	tr.RegisterStatus("bandwidth", func() interface{} {
+		return map[string]int64{"current_bytes_per_sec": rate}
+	})
+
+	status := tr.Status()
+	bw, ok := status["bandwidth"].(map[string]int64)
+	if !ok {
+		t.Fatalf("bandwidth = %#v, want map", status["bandwidth"])
+	}
+	if bw["current_bytes_per_sec"] != 1024 {
+		t.Errorf("current_bytes_per_sec = %d, want 1024", bw["current_bytes_per_sec"])
+	}
+
+	// Values are read at request time, not at registration
+	rate = 2048
+	bw = tr.Status()["bandwidth"].(map[string]int64)
+	if bw["current_bytes_per_sec"] != 2048 {
+		t.Errorf("current_bytes_per_sec = %d, want 2048", bw["current_bytes_per_sec"])
+	}
+	if _, ok := status["running"]; !ok {
+		t.Error("base status fields should still be present")
+	}
+}
+
+func TestStatusCallsExtrasWithoutLock(t *testing.T) {
+	tr := NewTracker()
+	// A status callback that waits on a goroutine writing to the tracker would
+	// deadlock if Status still held its read lock while calling it
+	tr.RegisterStatus("engine", func() interface{} {
+		done := make(chan struct{})
+		go func() {
+			tr.SetRunning(true)
+			close(done)
+		}()
+		<-done
+		return "ok"
+	})
+
+	result := make(chan map[string]interface{}, 1)
+	go func() { result <- tr.Status() }()
+	select {
+	case status := <-result:
+		if status["engine"] != "ok" {
+			t.Errorf("engine = %v, want ok", status["engine"])
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Status() deadlocked calling a status callback")
+	}
+}
+
+func TestRegisterHandler(t *testing.T) {
+	tr := NewTracker()
+	tr.RegisterHandler("POST /apps/{id}/pin", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.PathValue("id"))
+	}))
+	srv := httptest.NewServer(tr.Handler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/apps/0409MSWD2019/pin", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "0409MSWD2019" {
+		t.Errorf("POST = %d %q", resp.StatusCode, body)
+	}
+
+	// Built-in endpoints stay available next to registered handlers
+	resp, err = http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", resp.StatusCode)
+	}
+}
+
 func TestServeContextCancellation(t *testing.T) {
 	tr := NewTracker()
 	log := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -177,3 +259,15 @@ func TestServeContextCancellation(t *testing.T) {
 		t.Error("Serve did not shut down after context cancellation")
 	}
 }
+
+func TestStatusIncludesChannels(t *testing.T) {
+	tr := NewTracker()
+	if _, ok := tr.Status()["channels"]; ok {
+		t.Error("status without channel results should not include channels")
+	}
+	tr.RecordChannel("Preview", ChannelStatus{Downloaded: 2, Linked: 5, FailedApps: []string{"0409MSWD2019"}})
+	channels, ok := tr.Status()["channels"].(map[string]ChannelStatus)
+	if !ok || channels["Preview"].Linked != 5 || len(channels["Preview"].FailedApps) != 1 {
+		t.Errorf("channels = %+v", tr.Status()["channels"])
+	}
+}
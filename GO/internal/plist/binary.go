@@ -0,0 +1,486 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"unicode/utf16"
+)
+
+// 二进制 plist（bplist00）
+// 文件结构：8 字节头 "bplist00" → 对象区 → 偏移表 → 32 字节尾部
+// 尾部记录偏移表每项的字节数、对象引用的字节数、对象总数、根对象编号和偏移表位置
+
+const binaryMagic = "bplist00"
+
+// binaryEpoch 二进制 plist 的 date 以 2001-01-01 UTC 起的秒数（float64）存储
+var binaryEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// maxBinaryDepth 容器嵌套深度上限，防止构造的循环引用导致无限递归
+const maxBinaryDepth = 512
+
+// 对象类型标记（高 4 位）
+const (
+	bpSimple = 0x0 // null / false / true / fill
+	bpInt    = 0x1
+	bpReal   = 0x2
+	bpDate   = 0x3
+	bpData   = 0x4
+	bpASCII  = 0x5
+	bpUTF16  = 0x6
+	bpUID    = 0x8
+	bpArray  = 0xA
+	bpSet    = 0xC
+	bpDict   = 0xD
+)
+
+// binaryParser 按偏移表随机访问对象
+type binaryParser struct {
+	data    []byte
+	offsets []uint64
+	refSize int
+	// visiting 记录当前递归路径上的对象，出现环时报错
+	visiting map[uint64]bool
+}
+
+// parseBinary 解析 bplist00
+func parseBinary(data []byte) (interface{}, error) {
+	if len(data) < len(binaryMagic)+32 {
+		return nil, binaryErrorf(0, "文件过短")
+	}
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	refSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	topObject := binary.BigEndian.Uint64(trailer[16:])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:])
+
+	if offsetSize < 1 || offsetSize > 8 || refSize < 1 || refSize > 8 {
+		return nil, binaryErrorf(len(data)-32, "尾部的整数宽度无效（offset %d, ref %d）", offsetSize, refSize)
+	}
+	objectsEnd := uint64(len(data) - 32)
+	if numObjects == 0 || topObject >= numObjects || tableOffset < uint64(len(binaryMagic)) ||
+		tableOffset > objectsEnd || numObjects > (objectsEnd-tableOffset)/uint64(offsetSize) {
+		return nil, binaryErrorf(len(data)-32, "尾部的对象数或偏移表位置无效")
+	}
+
+	p := &binaryParser{data: data[:objectsEnd], refSize: refSize, visiting: make(map[uint64]bool)}
+	p.offsets = make([]uint64, numObjects)
+	for i := range p.offsets {
+		pos := int(tableOffset) + i*offsetSize
+		off := readUint(data[pos : pos+offsetSize])
+		if off < uint64(len(binaryMagic)) || off >= tableOffset {
+			return nil, binaryErrorf(pos, "对象 %d 的偏移 %d 超出对象区", i, off)
+		}
+		p.offsets[i] = off
+	}
+	return p.object(topObject, 0)
+}
+
+// object 解析编号为 ref 的对象
+func (p *binaryParser) object(ref uint64, depth int) (interface{}, error) {
+	if ref >= uint64(len(p.offsets)) {
+		return nil, binaryErrorf(0, "对象引用 %d 超出范围", ref)
+	}
+	if depth > maxBinaryDepth {
+		return nil, binaryErrorf(0, "嵌套过深")
+	}
+	off := int(p.offsets[ref])
+	marker := p.data[off]
+	kind, info := marker>>4, marker&0x0F
+
+	switch kind {
+	case bpSimple:
+		switch info {
+		case 0x8:
+			return false, nil
+		case 0x9:
+			return true, nil
+		}
+		return nil, binaryErrorf(off, "不支持的对象标记 0x%02x", marker)
+	case bpInt:
+		return p.integer(off, info)
+	case bpReal:
+		b, err := p.bytes(off+1, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		switch info {
+		case 2:
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+		case 3:
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+		}
+		return nil, binaryErrorf(off, "real 宽度 %d 无效", 1<<info)
+	case bpDate:
+		if info != 3 {
+			return nil, binaryErrorf(off, "date 标记 0x%02x 无效", marker)
+		}
+		b, err := p.bytes(off+1, 8)
+		if err != nil {
+			return nil, err
+		}
+		secs := math.Float64frombits(binary.BigEndian.Uint64(b))
+		if math.IsNaN(secs) || math.IsInf(secs, 0) {
+			return nil, binaryErrorf(off, "date 值无效")
+		}
+		return binaryEpoch.Add(time.Duration(secs * float64(time.Second))), nil
+	case bpData:
+		n, start, err := p.count(off, info)
+		if err != nil {
+			return nil, err
+		}
+		b, err := p.bytes(start, n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case bpASCII:
+		n, start, err := p.count(off, info)
+		if err != nil {
+			return nil, err
+		}
+		b, err := p.bytes(start, n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case bpUTF16:
+		n, start, err := p.count(off, info)
+		if err != nil {
+			return nil, err
+		}
+		b, err := p.bytes(start, n*2)
+		if err != nil {
+			return nil, err
+		}
+		units := make([]uint16, n)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	case bpUID:
+		return nil, binaryErrorf(off, "不支持 UID 对象（NSKeyedArchiver 归档）")
+	case bpArray, bpSet, bpDict:
+		return p.container(ref, off, kind, info, depth)
+	}
+	return nil, binaryErrorf(off, "未知的对象标记 0x%02x", marker)
+}
+
+// container 解析 array / set / dict；set 按 array 处理
+func (p *binaryParser) container(ref uint64, off int, kind, info byte, depth int) (interface{}, error) {
+	if p.visiting[ref] {
+		return nil, binaryErrorf(off, "对象 %d 存在循环引用", ref)
+	}
+	p.visiting[ref] = true
+	defer delete(p.visiting, ref)
+
+	n, start, err := p.count(off, info)
+	if err != nil {
+		return nil, err
+	}
+	refCount := n
+	if kind == bpDict {
+		refCount = n * 2
+	}
+	if n > len(p.data) || refCount > len(p.data) {
+		return nil, binaryErrorf(off, "容器长度 %d 超出文件大小", n)
+	}
+	refs, err := p.bytes(start, refCount*p.refSize)
+	if err != nil {
+		return nil, err
+	}
+	refAt := func(i int) uint64 { return readUint(refs[i*p.refSize : (i+1)*p.refSize]) }
+
+	if kind != bpDict {
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = p.object(refAt(i), depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := p.object(refAt(i), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, binaryErrorf(off, "dict 的 key 必须是 string，实际为 %s", kindName(k))
+		}
+		if m[key], err = p.object(refAt(n+i), depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// integer 解析 int 对象；16 字节的 int 只在高 8 字节为 0 时支持（表示 uint64）
+func (p *binaryParser) integer(off int, info byte) (interface{}, error) {
+	size := 1 << info
+	b, err := p.bytes(off+1, size)
+	if err != nil {
+		return nil, err
+	}
+	switch size {
+	case 1, 2, 4:
+		return int64(readUint(b)), nil
+	case 8:
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case 16:
+		hi, lo := binary.BigEndian.Uint64(b), binary.BigEndian.Uint64(b[8:])
+		switch {
+		case hi == 0 && lo > math.MaxInt64:
+			return lo, nil
+		case hi == 0 || hi == math.MaxUint64:
+			return int64(lo), nil
+		}
+		return nil, binaryErrorf(off, "integer 超出 64 位范围")
+	}
+	return nil, binaryErrorf(off, "integer 宽度 %d 无效", size)
+}
+
+// count 解析对象长度：低 4 位小于 15 时即长度，否则后面跟一个 int 对象
+// 返回长度和内容的起始位置
+func (p *binaryParser) count(off int, info byte) (int, int, error) {
+	if info != 0x0F {
+		return int(info), off + 1, nil
+	}
+	if off+1 >= len(p.data) {
+		return 0, 0, binaryErrorf(off, "对象被截断")
+	}
+	marker := p.data[off+1]
+	if marker>>4 != bpInt {
+		return 0, 0, binaryErrorf(off+1, "长度字段应为 integer，实际标记 0x%02x", marker)
+	}
+	size := 1 << (marker & 0x0F)
+	if size > 8 {
+		return 0, 0, binaryErrorf(off+1, "长度字段过宽")
+	}
+	b, err := p.bytes(off+2, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	n := readUint(b)
+	if n > uint64(len(p.data)) {
+		return 0, 0, binaryErrorf(off, "长度 %d 超出文件大小", n)
+	}
+	return int(n), off + 2 + size, nil
+}
+
+// bytes 返回 [start, start+n) 的数据，越界时报错
+func (p *binaryParser) bytes(start, n int) ([]byte, error) {
+	if n < 0 || start < 0 || start > len(p.data) || n > len(p.data)-start {
+		return nil, binaryErrorf(start, "对象被截断")
+	}
+	return p.data[start : start+n], nil
+}
+
+// readUint 读取 1~8 字节的大端无符号整数
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// binaryErrorf 二进制格式的解析错误，位置是字节偏移（Line 为 0）
+func binaryErrorf(offset int, format string, args ...interface{}) error {
+	return &SyntaxError{Offset: int64(offset), Msg: fmt.Sprintf(format, args...)}
+}
+
+// binaryWriter 把通用值展开为对象列表后写出
+// 字符串、数字、日期、data 按值去重（与 CoreFoundation 一致），容器不去重
+type binaryWriter struct {
+	objects [][]byte // 每个对象编码后的字节，引用暂以 8 字节占位
+	refs    [][]uint64
+	uniq    map[string]uint64
+}
+
+// encodeBinary 把通用值编码为 bplist00
+func encodeBinary(v interface{}) []byte {
+	w := &binaryWriter{uniq: make(map[string]uint64)}
+	top := w.flatten(v)
+
+	refSize := intWidth(uint64(len(w.objects)))
+	var buf bytes.Buffer
+	buf.WriteString(binaryMagic)
+	offsets := make([]uint64, len(w.objects))
+	for i, obj := range w.objects {
+		offsets[i] = uint64(buf.Len())
+		buf.Write(obj)
+		for _, r := range w.refs[i] {
+			writeUint(&buf, r, refSize)
+		}
+	}
+
+	tableOffset := uint64(buf.Len())
+	offsetSize := intWidth(tableOffset)
+	for _, off := range offsets {
+		writeUint(&buf, off, offsetSize)
+	}
+
+	var trailer [32]byte
+	trailer[6] = byte(offsetSize)
+	trailer[7] = byte(refSize)
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(w.objects)))
+	binary.BigEndian.PutUint64(trailer[16:], top)
+	binary.BigEndian.PutUint64(trailer[24:], tableOffset)
+	buf.Write(trailer[:])
+	return buf.Bytes()
+}
+
+// flatten 为 v 分配对象编号并递归展开容器，返回 v 的编号
+// 容器的头部先占位，子对象编号确定后再填入引用，顺序与 CoreFoundation 相同：
+// 先容器本身，再所有 key，再所有 value
+func (w *binaryWriter) flatten(v interface{}) uint64 {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		idx := w.add(countHeader(bpDict, len(x)), nil)
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		refs := make([]uint64, 0, 2*len(keys))
+		for _, k := range keys {
+			refs = append(refs, w.flatten(k))
+		}
+		for _, k := range keys {
+			refs = append(refs, w.flatten(x[k]))
+		}
+		w.refs[idx] = refs
+		return idx
+	case []interface{}:
+		idx := w.add(countHeader(bpArray, len(x)), nil)
+		refs := make([]uint64, 0, len(x))
+		for _, e := range x {
+			refs = append(refs, w.flatten(e))
+		}
+		w.refs[idx] = refs
+		return idx
+	}
+
+	enc, key := encodeScalar(v)
+	if idx, ok := w.uniq[key]; ok {
+		return idx
+	}
+	idx := w.add(enc, nil)
+	w.uniq[key] = idx
+	return idx
+}
+
+// add 追加一个对象，返回其编号
+func (w *binaryWriter) add(enc []byte, refs []uint64) uint64 {
+	w.objects = append(w.objects, enc)
+	w.refs = append(w.refs, refs)
+	return uint64(len(w.objects) - 1)
+}
+
+// encodeScalar 编码非容器值，同时返回用于去重的 key（类型前缀 + 编码字节）
+func encodeScalar(v interface{}) ([]byte, string) {
+	var buf bytes.Buffer
+	switch x := v.(type) {
+	case bool:
+		if x {
+			buf.WriteByte(0x09)
+		} else {
+			buf.WriteByte(0x08)
+		}
+	case int64:
+		writeInt(&buf, x)
+	case uint64:
+		if x > math.MaxInt64 {
+			buf.WriteByte(bpInt<<4 | 4)
+			buf.Write(make([]byte, 8))
+			writeUint(&buf, x, 8)
+		} else {
+			writeInt(&buf, int64(x))
+		}
+	case float64:
+		buf.WriteByte(bpReal<<4 | 3)
+		writeUint(&buf, math.Float64bits(x), 8)
+	case time.Time:
+		buf.WriteByte(bpDate<<4 | 3)
+		secs := x.Sub(binaryEpoch).Seconds()
+		writeUint(&buf, math.Float64bits(secs), 8)
+	case []byte:
+		buf.Write(countHeader(bpData, len(x)))
+		buf.Write(x)
+	case string:
+		if isASCII(x) {
+			buf.Write(countHeader(bpASCII, len(x)))
+			buf.WriteString(x)
+		} else {
+			units := utf16.Encode([]rune(x))
+			buf.Write(countHeader(bpUTF16, len(units)))
+			for _, u := range units {
+				writeUint(&buf, uint64(u), 2)
+			}
+		}
+	}
+	return buf.Bytes(), buf.String()
+}
+
+// writeInt 按 CoreFoundation 的规则写 int：非负数用 1/2/4/8 字节中最短的，负数固定 8 字节
+func writeInt(buf *bytes.Buffer, n int64) {
+	size := 8
+	if n >= 0 {
+		size = intWidth(uint64(n))
+	}
+	var info byte
+	for 1<<info < size {
+		info++
+	}
+	buf.WriteByte(bpInt<<4 | info)
+	writeUint(buf, uint64(n), size)
+}
+
+// countHeader 生成带长度的对象标记，长度 >= 15 时标记后跟一个 int 对象
+func countHeader(kind byte, n int) []byte {
+	if n < 15 {
+		return []byte{kind<<4 | byte(n)}
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(kind<<4 | 0x0F)
+	writeInt(&buf, int64(n))
+	return buf.Bytes()
+}
+
+// writeUint 以 size 字节大端写出 v
+func writeUint(buf *bytes.Buffer, v uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(v >> (8 * i)))
+	}
+}
+
+// intWidth 表示 v 所需的最少字节数，取 1/2/4/8 之一
+func intWidth(v uint64) int {
+	switch {
+	case v <= math.MaxUint8:
+		return 1
+	case v <= math.MaxUint16:
+		return 2
+	case v <= math.MaxUint32:
+		return 4
+	}
+	return 8
+}
+
+// isASCII 判断字符串能否按 ASCII 存储
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
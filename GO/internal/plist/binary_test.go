@@ -0,0 +1,153 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pythonBplist was produced by Python's plistlib, an independent bplist00 writer.
+// It holds the same kind of keys and value types as a MAU manifest entry.
+const pythonBplist = `
+YnBsaXN0MDDXAQIDBAUGBwgJCgsODxBURGF0ZVlGaWxlIFNpemVUSGFzaFlMb2NhdGlvbnNVUmF0
+aW9XVHJpZ2dlcl5VcGRhdGUgVmVyc2lvbjNBxpnahAAAABI+gAAAQwABAqIMDV8QKGh0dHBzOi8v
+b2ZmaWNlY2RubWFjLm1pY3Jvc29mdC5jb20vYS5wa2drANwAYgBlAHIAcAByAPwAZgB1AG4AZyM/
+0AAAAAAAAAleMTYuOTMuMjUwMTEyMTIIFxwmKzU7Q1JbYGRnkqmyswAAAAAAAAEBAAAAAAAAABEA
+AAAAAAAAAAAAAAAAAADC`
+
+func decodeFixture(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseBinaryFromOtherWriter(t *testing.T) {
+	data := decodeFixture(t, pythonBplist)
+	if DetectFormat(data) != BinaryFormat {
+		t.Fatal("fixture should be detected as binary")
+	}
+	v, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := map[string]interface{}{
+		"Update Version": "16.93.25011212",
+		"File Size":      int64(1048576000),
+		"Date":           time.Date(2025, 1, 12, 8, 30, 0, 0, time.UTC),
+		"Hash":           []byte{0, 1, 2},
+		"Locations":      []interface{}{"https://officecdnmac.microsoft.com/a.pkg", "Überprüfung"},
+		"Trigger":        true,
+		"Ratio":          0.25,
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("Parse =\n%#v\nwant\n%#v", v, want)
+	}
+
+	// The same struct decoding works regardless of the input format.
+	var m struct {
+		Version string `plist:"Update Version"`
+		Size    int64  `plist:"File Size"`
+	}
+	if err := Unmarshal(data, &m); err != nil || m.Version != "16.93.25011212" || m.Size != 1048576000 {
+		t.Errorf("Unmarshal = %+v, %v", m, err)
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	v, err := Parse([]byte(canonical))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Large containers and strings exercise the extended length encoding.
+	long := make([]interface{}, 300)
+	for i := range long {
+		long[i] = int64(i * 1000)
+	}
+	v.(map[string]interface{})["Long"] = long
+	v.(map[string]interface{})["Text"] = strings.Repeat("中文 ", 20)
+	v.(map[string]interface{})["Max"] = uint64(1<<64 - 1)
+
+	bin, err := MarshalFormat(v, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(bin, []byte("bplist00")) {
+		t.Fatalf("missing bplist00 header: %q", bin[:8])
+	}
+	back, err := Parse(bin)
+	if err != nil {
+		t.Fatalf("Parse(binary): %v", err)
+	}
+	if !reflect.DeepEqual(back, v) {
+		t.Errorf("binary round trip =\n%#v\nwant\n%#v", back, v)
+	}
+
+	// Converting binary back to XML reproduces the original document.
+	delete(back.(map[string]interface{}), "Long")
+	delete(back.(map[string]interface{}), "Text")
+	delete(back.(map[string]interface{}), "Max")
+	xml, err := Marshal(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(xml) != canonical {
+		t.Errorf("binary → xml differs:\n%s", xml)
+	}
+}
+
+func TestBinaryDeduplicatesScalars(t *testing.T) {
+	v := []interface{}{"same", "same", int64(7), int64(7)}
+	bin, err := MarshalFormat(v, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(bin, []byte("same")); n != 1 {
+		t.Errorf("string stored %d times, want 1", n)
+	}
+}
+
+func TestParseBinaryRejectsCorruptInput(t *testing.T) {
+	good := decodeFixture(t, pythonBplist)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", []byte("bplist00")},
+		{"truncated", good[:len(good)-40]},
+		{"bad trailer", append(append([]byte(nil), good[:len(good)-26]...), make([]byte, 26)...)},
+		{"unknown version", append([]byte("bplist15"), good[8:]...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.data)
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Errorf("err = %v, want SyntaxError", err)
+			}
+		})
+	}
+}
+
+func TestParseBinaryRejectsCycles(t *testing.T) {
+	// A single array whose only element references itself.
+	data := []byte("bplist00")
+	data = append(data, 0xA1, 0x00) // array of 1, ref → object 0
+	data = append(data, 0x08)       // offset table: object 0 at 8
+	trailer := make([]byte, 32)
+	trailer[6], trailer[7] = 1, 1
+	trailer[15] = 1  // one object
+	trailer[31] = 10 // offset table at 10
+	data = append(data, trailer...)
+
+	_, err := Parse(data)
+	if err == nil || !strings.Contains(err.Error(), "循环引用") {
+		t.Errorf("err = %v, want cycle error", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Package plist 读写 Apple 属性列表（Property List），支持 XML 和二进制（bplist00）两种格式，
+// 解析时按文件头自动识别
+//
+// 解码得到的通用值与 Go 类型的对应关系：
+//
+//	dict       → map[string]interface{}
+//	array      → []interface{}
+//	string     → string
+//	integer    → int64（超出 int64 范围的正数为 uint64）
+//	real       → float64
+//	true/false → bool
+//	date       → time.Time（UTC）
+//	data       → []byte
+//
+// 也可以解码到结构体：字段名默认即 key，用 `plist:"Update Version"` 指定 key，
+// `plist:"-"` 忽略字段，`plist:",omitempty"` 编码时跳过零值，规则与 encoding/json 相同
+//
+// 编码输出与 plutil -convert xml1 一致：制表符缩进、dict 的 key 按字典序排列
+package plist
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+// SyntaxError 解析错误，带出错位置
+// XML 格式给出行、列（从 1 开始），二进制格式给出字节偏移（Line 为 0）
+type SyntaxError struct {
+	Line   int
+	Column int
+	Offset int64
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("plist: 偏移 %d: %s", e.Offset, e.Msg)
+	}
+	if e.Column > 0 {
+		return fmt.Sprintf("plist: 第 %d 行第 %d 列: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("plist: 第 %d 行: %s", e.Line, e.Msg)
+}
+
+// UnmarshalTypeError plist 值的类型与目标 Go 类型不匹配
+type UnmarshalTypeError struct {
+	Value string       // plist 值的类型，如 "string"、"dict"
+	Type  reflect.Type // 目标 Go 类型
+	Path  string       // 出错值在文档中的路径，如 "[3].File Size"
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("plist: 无法把 %s 解码为 %s", e.Value, e.Type)
+	}
+	return fmt.Sprintf("plist: %s: 无法把 %s 解码为 %s", e.Path, e.Value, e.Type)
+}
+
+// UnsupportedTypeError 编码时遇到 plist 无法表示的 Go 类型
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("plist: 不支持编码类型 %s", e.Type)
+}
+
+// Format plist 的存储格式
+type Format int
+
+const (
+	XMLFormat    Format = iota // <?xml ...?><plist>...</plist>
+	BinaryFormat               // bplist00
+)
+
+func (f Format) String() string {
+	if f == BinaryFormat {
+		return "binary"
+	}
+	return "xml"
+}
+
+// DetectFormat 按文件头判断格式，不是 bplist 的一律按 XML 处理
+func DetectFormat(data []byte) Format {
+	if bytes.HasPrefix(data, []byte(binaryMagic)) {
+		return BinaryFormat
+	}
+	return XMLFormat
+}
+
+// Parse 把 plist 文档解析为通用值（见包注释中的类型对应关系），自动识别 XML / 二进制格式
+func Parse(data []byte) (interface{}, error) {
+	if DetectFormat(data) == BinaryFormat {
+		return parseBinary(data)
+	}
+	if bytes.HasPrefix(data, []byte("bplist")) {
+		return nil, &SyntaxError{Msg: fmt.Sprintf("不支持的二进制 plist 版本 %q", data[:min(len(data), 8)])}
+	}
+	return parseXML(data)
+}
+
+// Unmarshal 解析 plist 文档（XML 或二进制）并存入 v 指向的值
+// v 必须是非 nil 指针；解码到 *interface{} 时得到通用值
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("plist: Unmarshal 需要非 nil 指针，实际为 %T", v)
+	}
+	val, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	return assign(rv.Elem(), val, "")
+}
+
+// Marshal 把 v 编码为 XML plist
+func Marshal(v interface{}) ([]byte, error) {
+	return MarshalFormat(v, XMLFormat)
+}
+
+// MarshalFormat 把 v 编码为指定格式的 plist
+func MarshalFormat(v interface{}, format Format) ([]byte, error) {
+	val, omit, err := toValue(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	if omit {
+		return nil, fmt.Errorf("plist: 不能编码 nil 值")
+	}
+	if format == BinaryFormat {
+		return encodeBinary(val), nil
+	}
+	return encodeXML(val), nil
+}
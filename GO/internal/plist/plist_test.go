@@ -0,0 +1,202 @@
+package plist
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// canonical is formatted exactly the way plutil -convert xml1 writes it.
+const canonical = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Date</key>
+	<date>2025-01-12T08:30:00Z</date>
+	<key>Empty</key>
+	<dict/>
+	<key>File Size</key>
+	<integer>1048576000</integer>
+	<key>Hash</key>
+	<data>
+	AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gISIjJCUmJygpKissLS4vMDEy
+	MzQ1Njc4OTo7PD0+P0BBQkNERUZHSElKS0xNTk9QUVJTVFVWV1hZWltcXV5fYGFiY2Q=
+	</data>
+	<key>Locations</key>
+	<array>
+		<string>https://officecdnmac.microsoft.com/a.pkg</string>
+		<string>Tom &amp; Jerry &lt;3 "quotes"</string>
+	</array>
+	<key>Nested</key>
+	<dict>
+		<key>Ratio</key>
+		<real>0.25</real>
+		<key>Retired</key>
+		<false/>
+	</dict>
+	<key>Offset</key>
+	<integer>-42</integer>
+	<key>Trigger</key>
+	<true/>
+</dict>
+</plist>
+`
+
+func sampleData() []byte {
+	b := make([]byte, 101)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func TestParseTypedValues(t *testing.T) {
+	v, err := Parse([]byte(canonical))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := map[string]interface{}{
+		"Date":      time.Date(2025, 1, 12, 8, 30, 0, 0, time.UTC),
+		"Empty":     map[string]interface{}{},
+		"File Size": int64(1048576000),
+		"Hash":      sampleData(),
+		"Locations": []interface{}{"https://officecdnmac.microsoft.com/a.pkg", `Tom & Jerry <3 "quotes"`},
+		"Nested":    map[string]interface{}{"Ratio": 0.25, "Retired": false},
+		"Offset":    int64(-42),
+		"Trigger":   true,
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("Parse =\n%#v\nwant\n%#v", v, want)
+	}
+}
+
+func TestRoundTripIsByteIdentical(t *testing.T) {
+	v, err := Parse([]byte(canonical))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, []byte(canonical)) {
+		t.Errorf("Marshal output differs:\n%s\nwant\n%s", out, canonical)
+	}
+}
+
+type nested struct {
+	Ratio   float64 `plist:"Ratio"`
+	Retired bool    `plist:"Retired"`
+}
+
+type manifest struct {
+	Date      time.Time `plist:"Date"`
+	FileSize  int64     `plist:"File Size"`
+	Hash      []byte    `plist:"Hash"`
+	Locations []string  `plist:"Locations"`
+	Nested    *nested   `plist:"Nested"`
+	Trigger   bool
+	Ignored   string `plist:"-"`
+	Missing   string `plist:"Missing,omitempty"`
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	var m manifest
+	if err := Unmarshal([]byte(canonical), &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if m.FileSize != 1048576000 || !m.Trigger || len(m.Locations) != 2 || len(m.Hash) != 101 {
+		t.Errorf("Unmarshal = %+v", m)
+	}
+	if m.Nested == nil || m.Nested.Ratio != 0.25 {
+		t.Errorf("Nested = %+v", m.Nested)
+	}
+	if !m.Date.Equal(time.Date(2025, 1, 12, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("Date = %v", m.Date)
+	}
+
+	out, err := Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back manifest
+	if err := Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, m) {
+		t.Errorf("struct round trip = %+v, want %+v", back, m)
+	}
+	if bytes.Contains(out, []byte("Missing")) || bytes.Contains(out, []byte("Ignored")) {
+		t.Errorf("omitempty / - fields were encoded:\n%s", out)
+	}
+}
+
+func TestUnmarshalTypeErrorHasPath(t *testing.T) {
+	var v []struct {
+		Size int `plist:"File Size"`
+	}
+	doc := `<plist><array><dict><key>File Size</key><integer>1</integer></dict>` +
+		`<dict><key>File Size</key><string>big</string></dict></array></plist>`
+	err := Unmarshal([]byte(doc), &v)
+	var te *UnmarshalTypeError
+	if !errors.As(err, &te) {
+		t.Fatalf("err = %v, want UnmarshalTypeError", err)
+	}
+	if te.Path != "[1].File Size" || te.Value != "string" {
+		t.Errorf("error = %+v", te)
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		line int
+	}{
+		{"bad integer", "<plist>\n<dict>\n<key>A</key>\n<integer>x1</integer>\n</dict>\n</plist>", 4},
+		{"missing value", "<plist>\n<dict>\n<key>A</key>\n</dict>\n</plist>", 4},
+		{"unknown element", "<plist>\n<array>\n\n<foo/>\n</array>\n</plist>", 4},
+		{"unclosed", "<plist>\n<array>\n<string>a</string>\n", 4},
+		{"empty", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.doc))
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("err = %v, want SyntaxError", err)
+			}
+			if se.Line != tt.line {
+				t.Errorf("line = %d, want %d (%v)", se.Line, tt.line, se)
+			}
+		})
+	}
+}
+
+func TestIntegerRange(t *testing.T) {
+	v, err := Parse([]byte("<integer>18446744073709551615</integer>"))
+	if err != nil || v != uint64(18446744073709551615) {
+		t.Errorf("max uint64 = %#v, %v", v, err)
+	}
+	v, err = Parse([]byte("<integer>-9223372036854775808</integer>"))
+	if err != nil || v != int64(-9223372036854775808) {
+		t.Errorf("min int64 = %#v, %v", v, err)
+	}
+	v, err = Parse([]byte("<integer>0x1F</integer>"))
+	if err != nil || v != int64(31) {
+		t.Errorf("hex = %#v, %v", v, err)
+	}
+}
+
+func TestMarshalRejectsUnsupported(t *testing.T) {
+	_, err := Marshal(map[string]interface{}{"ch": make(chan int)})
+	var ue *UnsupportedTypeError
+	if !errors.As(err, &ue) {
+		t.Errorf("err = %v, want UnsupportedTypeError", err)
+	}
+	if _, err := Marshal(nil); err == nil {
+		t.Error("Marshal(nil) should fail")
+	}
+}
@@ -0,0 +1,334 @@
+package plist
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// kindName 返回通用值对应的 plist 类型名，用于错误信息
+func kindName(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "dict"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case int64, uint64:
+		return "integer"
+	case float64:
+		return "real"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	case []byte:
+		return "data"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// assign 把通用值 v 存入 dst，path 是出错时报告的位置
+func assign(dst reflect.Value, v interface{}, path string) error {
+	mismatch := func() error {
+		return &UnmarshalTypeError{Value: kindName(v), Type: dst.Type(), Path: path}
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), v, path)
+	}
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	}
+	switch dst.Type() {
+	case timeType:
+		t, ok := v.(time.Time)
+		if !ok {
+			return mismatch()
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	case bytesType:
+		b, ok := v.([]byte)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetBytes(b)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		s, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetString(s)
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := v.(int64)
+		if !ok || dst.OverflowInt(n) {
+			return mismatch()
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch x := v.(type) {
+		case int64:
+			if x < 0 {
+				return mismatch()
+			}
+			n = uint64(x)
+		case uint64:
+			n = x
+		default:
+			return mismatch()
+		}
+		if dst.OverflowUint(n) {
+			return mismatch()
+		}
+		dst.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch x := v.(type) {
+		case float64:
+			dst.SetFloat(x)
+		case int64:
+			dst.SetFloat(float64(x))
+		case uint64:
+			dst.SetFloat(float64(x))
+		default:
+			return mismatch()
+		}
+	case reflect.Slice:
+		a, ok := v.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		s := reflect.MakeSlice(dst.Type(), len(a), len(a))
+		for i, e := range a {
+			if err := assign(s.Index(i), e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+	case reflect.Array:
+		a, ok := v.([]interface{})
+		if !ok || len(a) != dst.Len() {
+			return mismatch()
+		}
+		for i, e := range a {
+			if err := assign(dst.Index(i), e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+		out := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for k, e := range m {
+			ev := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(ev, e, joinPath(path, k)); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), ev)
+		}
+		dst.Set(out)
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for _, f := range structFields(dst.Type()) {
+			e, ok := m[f.key]
+			if !ok {
+				continue
+			}
+			if err := assign(dst.FieldByIndex(f.index), e, joinPath(path, f.key)); err != nil {
+				return err
+			}
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// joinPath 拼接错误路径中的 dict key
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// toValue 把 Go 值转换为通用值；omit 为 true 表示该值应省略（nil 指针 / nil 接口，plist 没有 null）
+func toValue(rv reflect.Value) (v interface{}, omit bool, err error) {
+	if !rv.IsValid() {
+		return nil, true, nil
+	}
+	if rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, true, nil
+		}
+		return toValue(rv.Elem())
+	}
+	switch rv.Type() {
+	case timeType:
+		return rv.Interface().(time.Time), false, nil
+	case bytesType:
+		return append([]byte(nil), rv.Bytes()...), false, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), false, nil
+	case reflect.Bool:
+		return rv.Bool(), false, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u > math.MaxInt64 {
+			return u, false, nil
+		}
+		return int64(rv.Uint()), false, nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), false, nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte(nil), rv.Bytes()...), false, nil
+		}
+		a := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			e, omit, err := toValue(rv.Index(i))
+			if err != nil {
+				return nil, false, err
+			}
+			if !omit {
+				a = append(a, e)
+			}
+		}
+		return a, false, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false, &UnsupportedTypeError{Type: rv.Type()}
+		}
+		m := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			e, omit, err := toValue(iter.Value())
+			if err != nil {
+				return nil, false, err
+			}
+			if !omit {
+				m[iter.Key().String()] = e
+			}
+		}
+		return m, false, nil
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		for _, f := range structFields(rv.Type()) {
+			fv := rv.FieldByIndex(f.index)
+			if f.omitEmpty && isEmpty(fv) {
+				continue
+			}
+			e, omit, err := toValue(fv)
+			if err != nil {
+				return nil, false, err
+			}
+			if !omit {
+				m[f.key] = e
+			}
+		}
+		return m, false, nil
+	}
+	return nil, false, &UnsupportedTypeError{Type: rv.Type()}
+}
+
+// isEmpty 判断 omitempty 意义下的零值
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+		return false
+	}
+	return v.IsZero()
+}
+
+// field 结构体字段与 dict key 的对应
+type field struct {
+	key       string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // reflect.Type → []field
+
+// structFields 返回结构体的可导出字段，嵌入的结构体（无标签时）展开到外层
+func structFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	var all []field
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("plist")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			idx := append(append([]int(nil), index...), i)
+			if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+				walk(sf.Type, idx)
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			all = append(all, field{key: name, index: idx, omitEmpty: opts == "omitempty"})
+		}
+	}
+	walk(t, nil)
+
+	// 外层字段优先于嵌入结构体中的同名字段
+	sort.SliceStable(all, func(i, j int) bool { return len(all[i].index) < len(all[j].index) })
+	var fields []field
+	seen := make(map[string]bool)
+	for _, f := range all {
+		if !seen[f.key] {
+			seen[f.key] = true
+			fields = append(fields, f)
+		}
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
@@ -0,0 +1,387 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout plist date 的格式（ISO 8601，始终为 UTC）
+const dateLayout = "2006-01-02T15:04:05Z"
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+`
+
+// xmlParser 基于 xml.Decoder 的 token 流解析 plist
+// 逐个元素递归下降，不经过中间 DOM，出错时能给出准确位置
+type xmlParser struct {
+	d *xml.Decoder
+}
+
+// parseXML 解析 XML plist，根元素可以是 <plist> 也可以直接是值元素
+func parseXML(data []byte) (interface{}, error) {
+	p := &xmlParser{d: xml.NewDecoder(bytes.NewReader(data))}
+
+	start, err := p.nextStart(true)
+	if err != nil {
+		return nil, err
+	}
+	if start.Name.Local != "plist" {
+		v, err := p.value(*start)
+		if err != nil {
+			return nil, err
+		}
+		return v, p.expectEOF()
+	}
+
+	inner, err := p.nextStart(false)
+	if err != nil {
+		return nil, err
+	}
+	if inner == nil {
+		return nil, p.errorf("<plist> 中没有任何值")
+	}
+	v, err := p.value(*inner)
+	if err != nil {
+		return nil, err
+	}
+	end, err := p.nextStart(false)
+	if err != nil {
+		return nil, err
+	}
+	if end != nil {
+		return nil, p.errorf("<plist> 中只能有一个根值，多出了 <%s>", end.Name.Local)
+	}
+	return v, p.expectEOF()
+}
+
+// nextStart 跳过注释、处理指令、DOCTYPE 和空白，返回下一个开始标签
+// 遇到结束标签时返回 nil（调用方据此结束 dict / array）；topLevel 时文档结束视为错误
+func (p *xmlParser) nextStart(topLevel bool) (*xml.StartElement, error) {
+	for {
+		tok, err := p.d.Token()
+		if err == io.EOF {
+			if topLevel {
+				return nil, p.errorf("文档为空")
+			}
+			return nil, p.errorf("文档意外结束")
+		}
+		if err != nil {
+			return nil, p.wrap(err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return &t, nil
+		case xml.EndElement:
+			return nil, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return nil, p.errorf("值元素之外出现文本 %q", strings.TrimSpace(string(t)))
+			}
+		}
+	}
+}
+
+// expectEOF 确认根值之后只剩空白和注释
+func (p *xmlParser) expectEOF() error {
+	for {
+		tok, err := p.d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return p.wrap(err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return p.errorf("根值之后出现多余的 <%s>", t.Name.Local)
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return p.errorf("根值之后出现多余的文本")
+			}
+		}
+	}
+}
+
+// value 解析以 start 开头的一个值元素
+func (p *xmlParser) value(start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		return p.dict()
+	case "array":
+		return p.array()
+	case "true", "false":
+		text, err := p.text(start.Name.Local)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(text) != "" {
+			return nil, p.errorf("<%s/> 不能包含内容", start.Name.Local)
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	text, err := p.text(start.Name.Local)
+	if err != nil {
+		return nil, err
+	}
+	switch start.Name.Local {
+	case "string":
+		return text, nil
+	case "integer":
+		return p.integer(strings.TrimSpace(text))
+	case "real":
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, p.errorf("无效的 real %q", text)
+		}
+		return f, nil
+	case "date":
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(text))
+		if err != nil {
+			return nil, p.errorf("无效的 date %q", text)
+		}
+		return t.UTC(), nil
+	case "data":
+		b, err := base64.StdEncoding.DecodeString(stripSpace(text))
+		if err != nil {
+			return nil, p.errorf("无效的 data: %v", err)
+		}
+		return b, nil
+	}
+	return nil, p.errorf("未知元素 <%s>", start.Name.Local)
+}
+
+// dict 解析 <dict> 的内容：<key> 和值交替出现，直到 </dict>
+func (p *xmlParser) dict() (interface{}, error) {
+	m := make(map[string]interface{})
+	for {
+		start, err := p.nextStart(false)
+		if err != nil {
+			return nil, err
+		}
+		if start == nil {
+			return m, nil
+		}
+		if start.Name.Local != "key" {
+			return nil, p.errorf("dict 中应为 <key>，实际为 <%s>", start.Name.Local)
+		}
+		key, err := p.text("key")
+		if err != nil {
+			return nil, err
+		}
+		vstart, err := p.nextStart(false)
+		if err != nil {
+			return nil, err
+		}
+		if vstart == nil {
+			return nil, p.errorf("key %q 缺少对应的值", key)
+		}
+		v, err := p.value(*vstart)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+}
+
+// array 解析 <array> 的内容，直到 </array>
+func (p *xmlParser) array() (interface{}, error) {
+	a := []interface{}{}
+	for {
+		start, err := p.nextStart(false)
+		if err != nil {
+			return nil, err
+		}
+		if start == nil {
+			return a, nil
+		}
+		v, err := p.value(*start)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+}
+
+// text 读取元素的文本内容直到对应的结束标签，不允许嵌套元素
+func (p *xmlParser) text(name string) (string, error) {
+	var sb strings.Builder
+	for {
+		tok, err := p.d.Token()
+		if err == io.EOF {
+			return "", p.errorf("<%s> 没有结束标签", name)
+		}
+		if err != nil {
+			return "", p.wrap(err)
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			sb.Write(t)
+		case xml.StartElement:
+			return "", p.errorf("<%s> 中不能嵌套 <%s>", name, t.Name.Local)
+		case xml.EndElement:
+			return sb.String(), nil
+		}
+	}
+}
+
+// integer 解析 <integer>，支持十进制和 0x 前缀的十六进制
+func (p *xmlParser) integer(s string) (interface{}, error) {
+	base, digits := 10, s
+	neg := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(strings.TrimPrefix(digits, "-"), "+")
+	if rest, ok := strings.CutPrefix(strings.ToLower(digits), "0x"); ok {
+		base, digits = 16, rest
+	}
+	u, err := strconv.ParseUint(digits, base, 64)
+	if err != nil || digits == "" {
+		return nil, p.errorf("无效的 integer %q", s)
+	}
+	switch {
+	case neg && u <= 1<<63:
+		return -int64(u-1) - 1, nil
+	case neg:
+		return nil, p.errorf("integer %q 超出范围", s)
+	case u > math.MaxInt64:
+		return u, nil
+	}
+	return int64(u), nil
+}
+
+// errorf 生成带当前位置的 SyntaxError
+func (p *xmlParser) errorf(format string, args ...interface{}) error {
+	line, col := p.d.InputPos()
+	return &SyntaxError{Line: line, Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// wrap 把 encoding/xml 的错误转成 SyntaxError
+func (p *xmlParser) wrap(err error) error {
+	var se *xml.SyntaxError
+	if errors.As(err, &se) {
+		return &SyntaxError{Line: se.Line, Msg: se.Msg}
+	}
+	return p.errorf("%v", err)
+}
+
+// stripSpace 去掉 base64 文本中的换行和缩进
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// encodeXML 把通用值编码为完整的 XML plist 文档
+func encodeXML(v interface{}) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xmlHeader)
+	writeXMLValue(&buf, v, 0)
+	buf.WriteString("</plist>\n")
+	return buf.Bytes()
+}
+
+// writeXMLValue 按 CoreFoundation 的格式写出一个值：每层一个制表符，
+// 空容器写成 <dict/>、<array/>，data 按行折叠（缩进计入 76 字符的行宽）
+func writeXMLValue(buf *bytes.Buffer, v interface{}, indent int) {
+	tabs := strings.Repeat("\t", indent)
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if len(x) == 0 {
+			buf.WriteString(tabs + "<dict/>\n")
+			return
+		}
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteString(tabs + "<dict>\n")
+		for _, k := range keys {
+			buf.WriteString(tabs + "\t<key>")
+			xmlEscape(buf, k)
+			buf.WriteString("</key>\n")
+			writeXMLValue(buf, x[k], indent+1)
+		}
+		buf.WriteString(tabs + "</dict>\n")
+	case []interface{}:
+		if len(x) == 0 {
+			buf.WriteString(tabs + "<array/>\n")
+			return
+		}
+		buf.WriteString(tabs + "<array>\n")
+		for _, e := range x {
+			writeXMLValue(buf, e, indent+1)
+		}
+		buf.WriteString(tabs + "</array>\n")
+	case string:
+		buf.WriteString(tabs + "<string>")
+		xmlEscape(buf, x)
+		buf.WriteString("</string>\n")
+	case int64:
+		buf.WriteString(tabs + "<integer>" + strconv.FormatInt(x, 10) + "</integer>\n")
+	case uint64:
+		buf.WriteString(tabs + "<integer>" + strconv.FormatUint(x, 10) + "</integer>\n")
+	case float64:
+		buf.WriteString(tabs + "<real>" + formatReal(x) + "</real>\n")
+	case bool:
+		if x {
+			buf.WriteString(tabs + "<true/>\n")
+		} else {
+			buf.WriteString(tabs + "<false/>\n")
+		}
+	case time.Time:
+		buf.WriteString(tabs + "<date>" + x.UTC().Format(dateLayout) + "</date>\n")
+	case []byte:
+		buf.WriteString(tabs + "<data>\n")
+		enc := base64.StdEncoding.EncodeToString(x)
+		width := 76 - 8*min(indent, 8)
+		for len(enc) > 0 {
+			n := min(width, len(enc))
+			buf.WriteString(tabs + enc[:n] + "\n")
+			enc = enc[n:]
+		}
+		buf.WriteString(tabs + "</data>\n")
+	}
+}
+
+// formatReal 按 CoreFoundation 的写法输出浮点数
+func formatReal(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+infinity"
+	case math.IsInf(f, -1):
+		return "-infinity"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// xmlEscape 只转义 & < >，与 CoreFoundation 一致（不转义引号）
+func xmlEscape(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
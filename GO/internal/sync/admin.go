@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// adminUserKey 请求上下文中已认证的操作人（访问令牌的名称）
+type adminUserKey struct{}
+
+// adminUser 返回通过 requireToken 认证的操作人，未认证时为空
+func adminUser(r *http.Request) string {
+	name, _ := r.Context().Value(adminUserKey{}).(string)
+	return name
+}
+
+// authenticate 按 Authorization: Bearer <令牌> 查找操作人；逐个做定长比较，不因比较耗时泄露令牌
+func (e *Engine) authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	name, found := "", false
+	for t, n := range e.adminTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			name, found = n, true
+		}
+	}
+	return name, found
+}
+
+// requireToken 管理接口认证：令牌有效时把操作人放进请求上下文，否则返回 401
+func (e *Engine) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := e.authenticate(r)
+		if !ok {
+			e.log.Warn("管理接口认证失败", "client", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="maucache"`)
+			writeJSONError(w, http.StatusUnauthorized, errors.New("缺少或无效的访问令牌"))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminUserKey{}, name)))
+	})
+}
+
+// ServeAdmin 启动管理接口（admin.listen），直到 ctx 取消
+// 未配置 admin.tokens_file 时不启动，修改发布状态只能通过配置文件
+func (e *Engine) ServeAdmin(ctx context.Context) {
+	if e.adminTokens == nil {
+		e.log.Warn("未配置 admin.tokens_file，管理接口未启用")
+		return
+	}
+	srv := &http.Server{
+		Addr:              e.cfg.Admin.Listen,
+		Handler:           e.requireToken(e.admin),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	e.log.Info("管理接口启动", "addr", e.cfg.Admin.Listen, "tokens", len(e.adminTokens))
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		e.log.Error("管理接口异常退出", "error", err)
+	}
+}
@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testAdminToken = "0123456789abcdef0123456789abcdef"
+
+func TestRequireToken(t *testing.T) {
+	e := &Engine{log: discardLogger, adminTokens: map[string]string{testAdminToken: "alice", "fedcba9876543210fedcba9876543210": "bob"}}
+	var seen string
+	h := e.requireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = adminUser(r)
+	}))
+
+	for name, header := range map[string]string{
+		"missing":   "",
+		"basic":     "Basic YWxpY2U6c2VjcmV0",
+		"empty":     "Bearer ",
+		"wrong":     "Bearer 0123456789abcdef0123456789abcdee",
+		"truncated": "Bearer 0123456789abcdef",
+	} {
+		seen = ""
+		req := httptest.NewRequest("POST", "/apps/0409MSWD2019/pin", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || seen != "" {
+			t.Errorf("%s: status %d, handler saw %q; want 401 without reaching the handler", name, rec.Code, seen)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/apps/0409MSWD2019/pin", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || seen != "alice" {
+		t.Errorf("valid token: status %d, user %q; want 200 as alice", rec.Code, seen)
+	}
+}
@@ -0,0 +1,363 @@
+package sync
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"maucache/internal/cdn"
+)
+
+// 审批模式在 StateDir 中的文件
+const (
+	approvalsFile = "approvals.json"        // 待审批版本和审批结果
+	auditFile     = "approvals-audit.jsonl" // 审计记录，每行一条，只追加
+)
+
+// 审批操作
+const (
+	approvalApprove = "approve"
+	approvalReject  = "reject"
+)
+
+// Decision 对一个应用版本的审批结果
+type Decision struct {
+	Action  string    `json:"action"`
+	By      string    `json:"by"`
+	Comment string    `json:"comment,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// AuditEntry 审计记录中的一条：谁在何时批准 / 拒绝了哪个版本
+type AuditEntry struct {
+	Decision
+	AppID     string   `json:"app_id"`
+	Version   string   `json:"version"`
+	Remote    string   `json:"remote,omitempty"`    // 请求来源地址
+	Published []string `json:"published,omitempty"` // 批准后立即发布到的频道
+}
+
+// PendingVersion 已暂存、等待审批的版本
+type PendingVersion struct {
+	AppID     string    `json:"app_id"`
+	AppName   string    `json:"app_name"`
+	Version   string    `json:"version"`
+	Channels  []string  `json:"channels"` // 上游提供该版本的频道
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// approvalStore 审批模式的状态，持久化为 StateDir/approvals.json，重启后待审批列表和审批结果仍然有效
+type approvalStore struct {
+	mu        gosync.Mutex
+	path      string
+	auditPath string
+	Pending   map[string]map[string]*PendingVersion `json:"pending"`   // AppID → 版本 → 待审批
+	Decisions map[string]map[string]Decision        `json:"decisions"` // AppID → 版本 → 审批结果
+}
+
+// loadApprovals 读取审批状态，不存在或损坏时从空开始
+func loadApprovals(stateDir string) *approvalStore {
+	s := &approvalStore{
+		path:      filepath.Join(stateDir, approvalsFile),
+		auditPath: filepath.Join(stateDir, auditFile),
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		_ = json.Unmarshal(data, s)
+	}
+	if s.Pending == nil {
+		s.Pending = make(map[string]map[string]*PendingVersion)
+	}
+	if s.Decisions == nil {
+		s.Decisions = make(map[string]map[string]Decision)
+	}
+	return s
+}
+
+// decision 返回应用版本的审批结果
+func (s *approvalStore) decision(appID, version string) (Decision, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.Decisions[appID][version]
+	return d, ok
+}
+
+// track 用一个频道本次同步中未批准的版本更新待审批列表
+// seen 是该频道本次参与审批的全部应用；这些应用在该频道的旧记录先清除，
+// 频道已经不再提供的版本随之从列表中消失。已拒绝的版本不再列出
+func (s *approvalStore) track(channel string, seen []string, held []collateralSet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range seen {
+		for v, p := range s.Pending[id] {
+			p.Channels = slices.DeleteFunc(p.Channels, func(c string) bool { return c == channel })
+			if len(p.Channels) == 0 {
+				delete(s.Pending[id], v)
+			}
+		}
+		if len(s.Pending[id]) == 0 {
+			delete(s.Pending, id)
+		}
+	}
+	for _, set := range held {
+		id, v := set.app.AppID, set.app.Version
+		if _, decided := s.Decisions[id][v]; decided {
+			continue
+		}
+		if s.Pending[id] == nil {
+			s.Pending[id] = make(map[string]*PendingVersion)
+		}
+		p := s.Pending[id][v]
+		if p == nil {
+			p = &PendingVersion{AppID: id, AppName: set.app.AppName, Version: v, FirstSeen: time.Now().UTC()}
+			s.Pending[id][v] = p
+		}
+		p.Channels = append(p.Channels, channel)
+		sort.Strings(p.Channels)
+	}
+	return s.save()
+}
+
+// pending 返回待审批版本，按 AppID 和版本排序
+func (s *approvalStore) pending() []PendingVersion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []PendingVersion{}
+	for _, versions := range s.Pending {
+		for _, p := range versions {
+			cp := *p
+			cp.Channels = slices.Clone(p.Channels)
+			out = append(out, cp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AppID != out[j].AppID {
+			return out[i].AppID < out[j].AppID
+		}
+		return out[i].Version < out[j].Version
+	})
+	return out
+}
+
+// decide 记录审批结果并从待审批列表中移除，返回该版本所在的频道
+// 只能审批待审批列表中的版本
+func (s *approvalStore) decide(appID, version string, d Decision) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.Pending[appID][version]
+	if !ok {
+		return nil, fmt.Errorf("%s 的版本 %s 不在待审批列表中", appID, version)
+	}
+	if s.Decisions[appID] == nil {
+		s.Decisions[appID] = make(map[string]Decision)
+	}
+	s.Decisions[appID][version] = d
+	delete(s.Pending[appID], version)
+	if len(s.Pending[appID]) == 0 {
+		delete(s.Pending, appID)
+	}
+	return p.Channels, s.save()
+}
+
+// audit 追加一条审计记录
+func (s *approvalStore) audit(entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.auditPath), 0750); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.auditPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// auditLog 读取全部审计记录，按时间顺序；无法解析的行跳过
+func (s *approvalStore) auditLog() ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := []AuditEntry{}
+	f, err := os.Open(s.auditPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// save 写回审批状态，调用方持有 mu
+func (s *approvalStore) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// holdUnapproved 从待发布的当前版本编录中去掉未批准的版本，并更新待审批列表
+// 未批准的版本照常暂存到 collateral/{版本号}/、照常下载安装包，根目录继续提供上次批准的编录。
+// 返回剩余的编录组和被暂缓的 AppID（清理时保留其根目录编录）
+func (e *Engine) holdUnapproved(sets []collateralSet, channel string, log *slog.Logger) ([]collateralSet, []string) {
+	var held []collateralSet
+	seen := make([]string, 0, len(sets))
+	out := sets[:0]
+	for _, set := range sets {
+		seen = append(seen, set.app.AppID)
+		d, ok := e.approvals.decision(set.app.AppID, set.app.Version)
+		if ok && d.Action == approvalApprove {
+			out = append(out, set)
+			continue
+		}
+		held = append(held, set)
+		if ok {
+			log.Info("版本已被拒绝，继续提供上次批准的编录", "appID", set.app.AppID, "version", set.app.Version, "by", d.By)
+		} else {
+			log.Info("新版本等待审批，继续提供上次批准的编录", "appID", set.app.AppID, "version", set.app.Version)
+		}
+	}
+	if err := e.approvals.track(channel, seen, held); err != nil {
+		log.Warn("保存待审批列表失败", "error", err)
+	}
+	ids := make([]string, len(held))
+	for i, set := range held {
+		ids[i] = set.app.AppID
+	}
+	return out, ids
+}
+
+// approvalRequest POST /apps/{id}/approve 和 /apps/{id}/reject 的请求体
+// 审批人不由请求体声明，取管理接口认证的操作人（访问令牌的名称）
+type approvalRequest struct {
+	Version string `json:"version"`
+	Comment string `json:"comment"`
+}
+
+// handleApprovals GET /approvals：待审批版本和审批结果
+func (e *Engine) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	e.approvals.mu.Lock()
+	decisions, err := json.Marshal(e.approvals.Decisions)
+	e.approvals.mu.Unlock()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"pending":   e.approvals.pending(),
+		"decisions": json.RawMessage(decisions),
+	})
+}
+
+// handleAudit GET /approvals/audit：审计记录
+func (e *Engine) handleAudit(w http.ResponseWriter, r *http.Request) {
+	entries, err := e.approvals.auditLog()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("读取审计记录失败: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleApprove POST /apps/{id}/approve：批准待审批版本，立即发布到提供该版本的频道
+func (e *Engine) handleApprove(w http.ResponseWriter, r *http.Request) {
+	e.decideVersion(w, r, approvalApprove)
+}
+
+// handleReject POST /apps/{id}/reject：拒绝待审批版本，根目录继续提供上次批准的编录
+func (e *Engine) handleReject(w http.ResponseWriter, r *http.Request) {
+	e.decideVersion(w, r, approvalReject)
+}
+
+func (e *Engine) decideVersion(w http.ResponseWriter, r *http.Request, action string) {
+	appID, ok := e.lookupApp(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("未知应用: %s", r.PathValue("id")))
+		return
+	}
+	by := adminUser(r)
+	if by == "" {
+		writeJSONError(w, http.StatusUnauthorized, errors.New("审批需要通过管理接口认证"))
+		return
+	}
+	var req approvalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Version) == "" {
+		writeJSONError(w, http.StatusBadRequest, errors.New(`请求体应为 {"version": "...", "comment": "..."}`))
+		return
+	}
+	d := Decision{Action: action, By: by, Comment: req.Comment, At: time.Now().UTC()}
+	version := strings.TrimSpace(req.Version)
+
+	e.publishMu.Lock()
+	defer e.publishMu.Unlock()
+	channels, err := e.approvals.decide(appID, version, d)
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, err)
+		return
+	}
+	entry := AuditEntry{Decision: d, AppID: appID, Version: version, Remote: r.RemoteAddr}
+	if action == approvalApprove {
+		entry.Published = e.publishApproved(appID, version, channels)
+	}
+	if err := e.approvals.audit(entry); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("写入审计记录失败: %w", err))
+		return
+	}
+	e.log.Warn("版本审批", "action", action, "appID", appID, "version", version, "by", d.By, "published", entry.Published)
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// publishApproved 用暂存的编录替换各频道根目录的编录，返回成功发布的频道
+// 固定了版本的应用不替换（固定优先）；暂存不完整的频道在下次同步时发布。调用方持有 publishMu
+func (e *Engine) publishApproved(appID, version string, channels []string) []string {
+	if _, pinned := e.pins.all()[appID]; pinned {
+		e.log.Info("应用已固定版本，批准的版本在取消固定后发布", "appID", appID, "version", version)
+		return nil
+	}
+	var published []string
+	for _, ch := range e.channels {
+		if !slices.Contains(channels, ch.name) {
+			continue
+		}
+		if err := applyPin(ch.cfg.Storage.CacheDir, appID, version); err != nil {
+			e.log.Warn("暂存的编录不完整，下次同步时发布", "channel", ch.name, "appID", appID, "version", version, "error", err)
+			continue
+		}
+		published = append(published, ch.name)
+		e.recordReleases(ch.name, []collateralSet{{app: cdn.AppInfo{AppID: appID, Version: version}}}, time.Now())
+	}
+	return published
+}
@@ -0,0 +1,159 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+)
+
+func newApprovalEngine(t *testing.T) *Engine {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Sync.Channel = "Production"
+	cfg.Sync.ExtraChannels = []string{"Preview"}
+	cfg.Sync.RequireApproval = true
+	cfg.Storage.CacheDir = t.TempDir()
+	cfg.Storage.StateDir = t.TempDir()
+	client, err := cdn.NewClient(cdn.Options{Apps: []cdn.AppDef{
+		{AppID: "0409MSWD2019", AppName: "Word"},
+		{AppID: "0409XCEL2019", AppName: "Excel"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Engine{
+		cfg:       cfg,
+		channels:  channelTargets(cfg),
+		client:    client,
+		log:       discardLogger,
+		pins:      loadPins(filepath.Join(cfg.Storage.StateDir, pinsFile), nil),
+		approvals: loadApprovals(cfg.Storage.StateDir),
+
+		admin:       http.NewServeMux(),
+		adminTokens: map[string]string{testAdminToken: "alice", "fedcba9876543210fedcba9876543210": "bob"},
+	}
+}
+
+func wordSet(version string) collateralSet {
+	return collateralSet{app: cdn.AppInfo{AppID: "0409MSWD2019", AppName: "Word", Version: version}}
+}
+
+func TestHoldUnapprovedTracksPendingPerChannel(t *testing.T) {
+	e := newApprovalEngine(t)
+
+	sets, held := e.holdUnapproved([]collateralSet{wordSet("16.93")}, "Production", discardLogger)
+	if len(sets) != 0 || len(held) != 1 {
+		t.Fatalf("sets=%d held=%v, want the new version held", len(sets), held)
+	}
+	e.holdUnapproved([]collateralSet{wordSet("16.93")}, "Preview", discardLogger)
+	pending := e.approvals.pending()
+	if len(pending) != 1 || strings.Join(pending[0].Channels, ",") != "Preview,Production" {
+		t.Fatalf("pending = %+v", pending)
+	}
+
+	// Preview moved on to a newer build: 16.93 is only pending for Production
+	e.holdUnapproved([]collateralSet{wordSet("16.94")}, "Preview", discardLogger)
+	pending = loadApprovals(e.cfg.Storage.StateDir).pending()
+	if len(pending) != 2 || strings.Join(pending[0].Channels, ",") != "Production" || pending[1].Version != "16.94" {
+		t.Errorf("reloaded pending = %+v", pending)
+	}
+
+	if _, err := e.approvals.decide("0409MSWD2019", "16.93", Decision{Action: approvalApprove, By: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	sets, held = e.holdUnapproved([]collateralSet{wordSet("16.93")}, "Production", discardLogger)
+	if len(sets) != 1 || len(held) != 0 {
+		t.Errorf("approved version: sets=%d held=%v, want it published", len(sets), held)
+	}
+	if _, err := e.approvals.decide("0409MSWD2019", "16.93", Decision{Action: approvalReject}); err == nil {
+		t.Error("deciding a version that is no longer pending should fail")
+	}
+}
+
+func TestApprovalAPI(t *testing.T) {
+	e := newApprovalEngine(t)
+	e.admin.HandleFunc("GET /approvals", e.handleApprovals)
+	e.admin.HandleFunc("GET /approvals/audit", e.handleAudit)
+	e.admin.HandleFunc("POST /apps/{id}/approve", e.handleApprove)
+	e.admin.HandleFunc("POST /apps/{id}/reject", e.handleReject)
+	srv := httptest.NewServer(e.requireToken(e.admin))
+	defer srv.Close()
+
+	token := testAdminToken
+	do := func(method, path, body string, out interface{}) int {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	root := e.cfg.Storage.CacheDir
+	writeCollateral(t, root, "0409MSWD2019", "served")
+	writeCollateral(t, filepath.Join(root, "collateral", "16.93"), "0409MSWD2019", "staged")
+	e.holdUnapproved([]collateralSet{wordSet("16.93")}, "Production", discardLogger)
+	e.holdUnapproved([]collateralSet{{app: cdn.AppInfo{AppID: "0409XCEL2019", Version: "16.93"}}}, "Production", discardLogger)
+
+	var list struct {
+		Pending []PendingVersion `json:"pending"`
+	}
+	if code := do("GET", "/approvals", "", &list); code != http.StatusOK || len(list.Pending) != 2 {
+		t.Fatalf("GET /approvals = %d %+v", code, list)
+	}
+
+	token = ""
+	if code := do("POST", "/apps/0409MSWD2019/approve", `{"version":"16.93"}`, nil); code != http.StatusUnauthorized {
+		t.Errorf("approve without a token: status %d, want 401", code)
+	}
+	token = testAdminToken
+	if code := do("POST", "/apps/0409MSWD2019/approve", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("approve without version: status %d, want 400", code)
+	}
+	if code := do("POST", "/apps/0409MSWD2019/approve", `{"version":"16.99"}`, nil); code != http.StatusConflict {
+		t.Errorf("approve a version that is not pending: status %d, want 409", code)
+	}
+	var entry AuditEntry
+	// A self-declared approver in the body is ignored; the token's name is recorded
+	if code := do("POST", "/apps/0409mswd2019/approve", `{"version":"16.93","by":"mallory","comment":"pilot ok"}`, &entry); code != http.StatusOK {
+		t.Fatalf("approve: status %d", code)
+	}
+	if entry.AppID != "0409MSWD2019" || len(entry.Published) != 1 || entry.Published[0] != "Production" {
+		t.Errorf("approve response = %+v", entry)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "0409MSWD2019.xml")); string(data) != "staged:0409MSWD2019.xml" {
+		t.Errorf("root xml = %q, want the approved version published immediately", data)
+	}
+
+	token = "fedcba9876543210fedcba9876543210"
+	if code := do("POST", "/apps/0409XCEL2019/reject", `{"version":"16.93"}`, nil); code != http.StatusOK {
+		t.Fatalf("reject: status %d", code)
+	}
+	// A rejected version stays held and is not listed as pending again
+	if _, held := e.holdUnapproved([]collateralSet{{app: cdn.AppInfo{AppID: "0409XCEL2019", Version: "16.93"}}}, "Production", discardLogger); len(held) != 1 {
+		t.Errorf("rejected version should stay held, held=%v", held)
+	}
+	if p := e.approvals.pending(); len(p) != 0 {
+		t.Errorf("pending after decisions = %+v", p)
+	}
+
+	var audit []AuditEntry
+	if code := do("GET", "/approvals/audit", "", &audit); code != http.StatusOK || len(audit) != 2 {
+		t.Fatalf("GET /approvals/audit = %d %+v", code, audit)
+	}
+	if audit[0].By != "alice" || audit[0].Action != approvalApprove || audit[1].By != "bob" || audit[1].Action != approvalReject {
+		t.Errorf("audit = %+v", audit)
+	}
+}
@@ -0,0 +1,53 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"maucache/internal/cdn"
+)
+
+// 过滤增量包所用构建列表的来源，记录在日志和 /sync/status 中
+const (
+	buildsFromChannel    = "channel"    // 频道自己的 builds.txt
+	buildsFromHistory    = "history"    // 频道没有 builds.txt，从应用的历史清单推断
+	buildsFromProduction = "production" // 历史清单也为空，回退到 Production 的 builds.txt
+)
+
+// buildResolver 为每个频道确定构建列表，一次同步内 Production 的 builds.txt 只取一次
+type buildResolver struct {
+	client     *cdn.Client
+	production []string
+}
+
+// channelBuilds 获取频道自己的 builds.txt；频道没有时返回 nil, nil，稍后用 resolve 推断
+// 网络错误等原样返回：取不到时不继续同步，不会先删掉正在提供服务的编录
+func (r *buildResolver) channelBuilds(ctx context.Context, channel string) ([]string, error) {
+	builds, err := r.client.FetchChannelBuilds(ctx, channel)
+	if errors.Is(err, cdn.ErrNoBuilds) {
+		return nil, nil
+	}
+	return builds, err
+}
+
+// resolve 确定频道的构建列表和来源
+// 优先频道自己的 builds.txt（channel 不为 nil）；其次从应用的历史版本推断；都没有时回退到 Production
+func (r *buildResolver) resolve(ctx context.Context, channel []string, apps []cdn.AppInfo, log *slog.Logger) ([]string, string, error) {
+	if channel != nil {
+		return channel, buildsFromChannel, nil
+	}
+	if builds := cdn.HistoricBuilds(apps); len(builds) > 0 {
+		return builds, buildsFromHistory, nil
+	}
+	if r.production == nil {
+		builds, err := r.client.FetchBuilds(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("获取 Production builds.txt 失败: %w", err)
+		}
+		r.production = builds
+	}
+	log.Warn("频道既没有 builds.txt 也没有历史清单，使用 Production 的构建列表过滤增量包")
+	return r.production, buildsFromProduction, nil
+}
@@ -0,0 +1,63 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"maucache/internal/cdn"
+)
+
+func TestBuildResolverStrategies(t *testing.T) {
+	var prodFetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path.Base(r.URL.Path) == "builds.txt" && strings.Contains(r.URL.Path, "C1297A47") {
+			prodFetches.Add(1)
+			w.Write([]byte("16.93.25011212\n"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	client, err := cdn.NewClient(cdn.Options{Upstream: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &buildResolver{client: client}
+	ctx := context.Background()
+
+	// Production has its own builds.txt.
+	own, err := r.channelBuilds(ctx, "Production")
+	if err != nil || len(own) != 1 {
+		t.Fatalf("Production channelBuilds = %q, %v", own, err)
+	}
+	if builds, source, _ := r.resolve(ctx, own, nil, discardLogger); source != buildsFromChannel || len(builds) != 1 {
+		t.Errorf("Production: source=%s builds=%q", source, builds)
+	}
+
+	// Beta has none: infer from the history manifests.
+	own, err = r.channelBuilds(ctx, "Beta")
+	if err != nil || own != nil {
+		t.Fatalf("Beta channelBuilds = %q, %v; want nil, nil", own, err)
+	}
+	apps := []cdn.AppInfo{{HistoricVersions: []string{"16.94.25020100"}}}
+	if builds, source, _ := r.resolve(ctx, own, apps, discardLogger); source != buildsFromHistory || len(builds) != 1 || builds[0] != "16.94.25020100" {
+		t.Errorf("Beta with history: source=%s builds=%q", source, builds)
+	}
+
+	// No history either: fall back to Production, fetched once per sync.
+	fetchesBefore := prodFetches.Load()
+	for i := 0; i < 2; i++ {
+		if builds, source, err := r.resolve(ctx, nil, []cdn.AppInfo{{}}, discardLogger); err != nil || source != buildsFromProduction || len(builds) != 1 {
+			t.Errorf("fallback: source=%s builds=%q err=%v", source, builds, err)
+		}
+	}
+	if n := prodFetches.Load() - fetchesBefore; n != 1 {
+		t.Errorf("Production builds.txt fetched %d times for the fallback, want 1", n)
+	}
+}
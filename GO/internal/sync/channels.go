@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+)
+
+// channelTarget 一个要同步的频道及其缓存目录
+// cfg 是引擎配置的副本，Sync.Channel / Storage.CacheDir / Storage.StateDir 已换成该频道的值，
+// 同步流程中的各步骤照常从 cfg 读取目录
+type channelTarget struct {
+	name string
+	cfg  *config.Config
+}
+
+// channelTargets 按配置生成要同步的频道
+// sync.channel 仍在 cache_dir 根目录（已有客户端不用改地址）；sync.extra_channels 中的频道
+// 各自在 cache_dir/{频道名}/ 下，状态在 state_dir/{频道名}/ 下
+func channelTargets(cfg *config.Config) []channelTarget {
+	targets := []channelTarget{{name: cfg.Sync.Channel, cfg: cfg}}
+	for _, name := range cfg.Sync.ExtraChannels {
+		if name == cfg.Sync.Channel {
+			continue
+		}
+		c := *cfg
+		c.Sync.Channel = name
+		c.Storage.CacheDir = filepath.Join(cfg.Storage.CacheDir, name)
+		c.Storage.StateDir = filepath.Join(cfg.Storage.StateDir, name)
+		targets = append(targets, channelTarget{name: name, cfg: &c})
+	}
+	return targets
+}
+
+// linkShared 对需要下载的任务，先在其他频道的缓存目录中找同一个安装包，找到则硬链接过来
+// 频道之间大部分安装包相同，硬链接后同一个文件只占一份空间、只下载一次。
+// 大小必须与计划一致；清单给出哈希时还要哈希一致。链接失败（如跨文件系统）时照常下载
+// 链接过来的文件沿用来源频道缓存清单中的记录（签名者等），来源没有记录时按计划中的信息记录
+func linkShared(jobs []DownloadJob, cacheDir string, peers []peerCache, log *slog.Logger) int {
+	linked := 0
+	for i := range jobs {
+		job := &jobs[i]
+		if !job.NeedDownload || job.SizeBytes <= 0 {
+			continue
+		}
+		for _, peer := range peers {
+			src := filepath.Join(peer.dir, job.Payload)
+			if !sameContent(src, job) {
+				continue
+			}
+			target := filepath.Join(cacheDir, job.Payload)
+			if err := linkFile(src, target); err != nil {
+				log.Debug("硬链接失败，改为下载", "file", job.Payload, "from", peer.dir, "error", err)
+				continue
+			}
+			log.Debug("已从其他频道硬链接安装包", "file", job.Payload, "from", peer.dir)
+			job.NeedDownload = false
+			job.linked = peer.entry(*job)
+			linked++
+			break
+		}
+	}
+	return linked
+}
+
+// sameContent 文件是否就是任务要下载的内容
+func sameContent(path string, job *DownloadJob) bool {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != job.SizeBytes {
+		return false
+	}
+	if len(job.Package.Hash) == 0 && len(job.Package.SHA256) == 0 {
+		return true
+	}
+	sums, err := cdn.HashFile(path)
+	if err != nil {
+		return false
+	}
+	err = job.Package.VerifyDigests(sums)
+	return err == nil || errors.Is(err, cdn.ErrNoManifestHash)
+}
+
+// linkFile 把 src 硬链接为 target，target 已存在时替换
+// 先链接到临时名再改名，替换过程中 target 始终完整可读
+func linkFile(src, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+		return err
+	}
+	tmp := target + ".link"
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// peerCache 另一个频道的缓存目录和缓存清单
+type peerCache struct {
+	dir string
+	inv *inventory
+}
+
+// peerCaches 除 self 以外所有频道的缓存目录和缓存清单
+func peerCaches(targets []channelTarget, self string) []peerCache {
+	var peers []peerCache
+	for _, t := range targets {
+		if t.name != self {
+			dir := t.cfg.Storage.CacheDir
+			peers = append(peers, peerCache{dir: dir, inv: loadInventory(filepath.Join(t.cfg.Storage.StateDir, inventoryFile), dir)})
+		}
+	}
+	return peers
+}
+
+// entry 链接过来的文件在本频道缓存清单中的记录：来源频道有同样大小的记录时沿用，否则按任务生成
+func (p peerCache) entry(job DownloadJob) *inventoryEntry {
+	if p.inv != nil {
+		if e, ok := p.inv.Files[job.Payload]; ok && e.Size == job.SizeBytes {
+			return &e
+		}
+	}
+	e := inventoryEntry{App: job.AppName, URL: job.LocationURI, Size: job.SizeBytes, PublishedAt: time.Now().UTC()}
+	if len(job.Package.SHA256) > 0 {
+		e.SHA256 = hex.EncodeToString(job.Package.SHA256)
+	}
+	return &e
+}
@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+)
+
+func TestChannelTargets(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Sync.Channel = "Production"
+	cfg.Sync.ExtraChannels = []string{"Preview", "Production", "Beta"}
+	cfg.Storage.CacheDir = "/data/maucache"
+	cfg.Storage.StateDir = "/data/maucache/.state"
+
+	targets := channelTargets(cfg)
+	if len(targets) != 3 {
+		t.Fatalf("got %d targets, want 3 (the primary channel is not duplicated)", len(targets))
+	}
+	if targets[0].cfg != cfg {
+		t.Error("the primary channel should use the engine config (cache_dir root)")
+	}
+	preview := targets[1].cfg
+	if preview.Sync.Channel != "Preview" || preview.Storage.CacheDir != "/data/maucache/Preview" || preview.Storage.StateDir != "/data/maucache/.state/Preview" {
+		t.Errorf("Preview target = %+v / %+v", preview.Sync, preview.Storage)
+	}
+	if cfg.Sync.Channel != "Production" || cfg.Storage.CacheDir != "/data/maucache" {
+		t.Error("deriving channel configs modified the engine config")
+	}
+	if peers := peerCaches(targets, "Preview"); len(peers) != 2 || peers[0].dir != "/data/maucache" || peers[1].dir != "/data/maucache/Beta" {
+		t.Errorf("peerCaches = %+v", peers)
+	}
+}
+
+func TestLinkSharedHardlinksMatchingPackages(t *testing.T) {
+	root := t.TempDir()
+	prod := filepath.Join(root, "prod")
+	preview := filepath.Join(root, "preview")
+	os.MkdirAll(prod, 0750)
+	os.MkdirAll(preview, 0750)
+	os.WriteFile(filepath.Join(prod, "Word.pkg"), []byte("word"), 0640)
+	os.WriteFile(filepath.Join(prod, "Excel.pkg"), []byte("excel"), 0640)
+	os.WriteFile(filepath.Join(prod, "Teams.pkg"), []byte("teams"), 0640)
+
+	wordSum := sha256.Sum256([]byte("word"))
+	jobs := []DownloadJob{
+		{Payload: "Word.pkg", SizeBytes: 4, NeedDownload: true, Package: cdn.Package{SHA256: wordSum[:]}},
+		{Payload: "Excel.pkg", SizeBytes: 6, NeedDownload: true},                                           // size differs
+		{Payload: "Teams.pkg", SizeBytes: 5, NeedDownload: true, Package: cdn.Package{SHA256: wordSum[:]}}, // hash differs
+		{Payload: "Edge.pkg", SizeBytes: 4, NeedDownload: true},                                            // not in any peer
+	}
+	prodInv := loadInventory(filepath.Join(root, "prod-state", inventoryFile), prod)
+	prodInv.Files["Word.pkg"] = inventoryEntry{App: "Word", Size: 4, Signer: "Developer ID Installer: Microsoft Corporation (UBF8T346G9)", TeamID: "UBF8T346G9"}
+	if n := linkShared(jobs, preview, []peerCache{{dir: prod, inv: prodInv}}, discardLogger); n != 1 {
+		t.Errorf("linked %d files, want 1", n)
+	}
+	if jobs[0].NeedDownload || !jobs[1].NeedDownload || !jobs[2].NeedDownload || !jobs[3].NeedDownload {
+		t.Errorf("NeedDownload = %v %v %v %v, want only Word.pkg linked", jobs[0].NeedDownload, jobs[1].NeedDownload, jobs[2].NeedDownload, jobs[3].NeedDownload)
+	}
+
+	src, _ := os.Stat(filepath.Join(prod, "Word.pkg"))
+	dst, err := os.Stat(filepath.Join(preview, "Word.pkg"))
+	if err != nil || !os.SameFile(src, dst) {
+		t.Errorf("Word.pkg is not a hardlink of the Production copy (err=%v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(preview, "Excel.pkg")); !os.IsNotExist(err) {
+		t.Error("Excel.pkg should not be linked")
+	}
+
+	// The linked file carries the peer's inventory entry (signer included)
+	if e := jobs[0].linked; e == nil || e.TeamID != "UBF8T346G9" || e.App != "Word" {
+		t.Errorf("linked entry = %+v, want the Production inventory entry", e)
+	}
+	if jobs[1].linked != nil {
+		t.Error("unlinked jobs should not carry an inventory entry")
+	}
+}
+
+func TestPeerEntryWithoutPeerInventory(t *testing.T) {
+	sum := sha256.Sum256([]byte("word"))
+	job := DownloadJob{AppName: "Word", LocationURI: "https://example.com/Word.pkg", Payload: "Word.pkg", SizeBytes: 4, Package: cdn.Package{SHA256: sum[:]}}
+	e := peerCache{dir: t.TempDir()}.entry(job)
+	if e.App != "Word" || e.URL != job.LocationURI || e.Size != 4 || e.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("entry = %+v, want one built from the job", e)
+	}
+}
@@ -19,8 +19,14 @@ var deprecatedFiles = []string{
 // Cleanup 清理旧文件
 // 对应 MacUpdatesOffice.Modify.ps1 第 15-36 行的文件删除逻辑
 // 修复 P4：xml 和 cat 只删根目录，不递归进 collateral/ 子目录
-// scratchDir 参数允许清理配置的临时目录
+// scratch 临时目录由 cleanScratch 在同步结束时按下载计划清理
 func Cleanup(cacheDir string, log *slog.Logger) int {
+	return CleanupExcept(cacheDir, nil, log)
+}
+
+// CleanupExcept 与 Cleanup 相同，但保留 keepAppIDs 中应用的根目录编录
+// 本次同步获取清单失败的应用没有新编录可写，保留旧编录让客户端仍能正常更新
+func CleanupExcept(cacheDir string, keepAppIDs []string, log *slog.Logger) int {
 	count := 0
 
 	// 1. 删除废弃的具名文件（在根目录下查找）
@@ -45,6 +51,10 @@ func Cleanup(cacheDir string, log *slog.Logger) int {
 		}
 		name := e.Name()
 		ext := strings.ToLower(filepath.Ext(name))
+		if keep := keptApp(name, keepAppIDs); keep != "" {
+			log.Debug("保留获取失败应用的旧编录", "path", filepath.Join(cacheDir, name), "appID", keep)
+			continue
+		}
 		if ext == ".xml" || ext == ".cat" || name == "builds.txt" {
 			path := filepath.Join(cacheDir, name)
 			log.Debug("删除根目录旧文件", "path", path)
@@ -53,10 +63,45 @@ func Cleanup(cacheDir string, log *slog.Logger) int {
 		}
 	}
 
-	// 3. 清理 scratch 临时目录残留
-	scratchDir := filepath.Join(cacheDir, ".tmp")
-	os.RemoveAll(scratchDir)
-	_ = os.MkdirAll(scratchDir, 0750)
-
 	return count
 }
+
+// keptApp 判断文件是否属于需要保留的应用，返回匹配的 AppID
+// 匹配 {AppID}.xml、{AppID}-chk.xml、{AppID}_{version}.cat 等形式
+func keptApp(name string, keepAppIDs []string) string {
+	for _, id := range keepAppIDs {
+		if rest, ok := strings.CutPrefix(name, id); ok && rest != "" && strings.ContainsRune(".-_", rune(rest[0])) {
+			return id
+		}
+	}
+	return ""
+}
+
+// cleanScratch 删除 scratch 目录（storage.scratch_dir）中不再需要的残留文件
+// planned 为本次计划下载的文件名：这些文件的部分文件与其 .resume 元数据成对保留，供下次断点续传；
+// 不在计划中的（已下载完成、已从清单移除）或落单的任一方都删除
+func cleanScratch(scratchDir string, planned map[string]bool, log *slog.Logger) {
+	entries, err := os.ReadDir(scratchDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		path := filepath.Join(scratchDir, name)
+		if e.IsDir() {
+			os.RemoveAll(path)
+			continue
+		}
+		if strings.HasSuffix(name, resumeSuffix) {
+			if _, err := os.Stat(strings.TrimSuffix(path, resumeSuffix)); err != nil || !planned[strings.TrimSuffix(name, resumeSuffix)] {
+				os.Remove(path)
+			}
+			continue
+		}
+		if _, err := os.Stat(path + resumeSuffix); err != nil || !planned[name] {
+			os.Remove(path)
+			continue
+		}
+		log.Debug("保留可续传的部分文件", "path", path)
+	}
+}
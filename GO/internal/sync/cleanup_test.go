@@ -125,3 +125,29 @@ func TestCleanupEmptyDir(t *testing.T) {
 		t.Errorf("count = %d, want 0 for empty dir", count)
 	}
 }
+
+func TestCleanupExceptKeepsFailedAppCollaterals(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".tmp"), 0750)
+
+	kept := []string{"0409OPIM2019.xml", "0409OPIM2019-chk.xml", "0409OPIM2019.cat", "0409OPIM2019_16.93.cat"}
+	removed := []string{"0409MSWD2019.xml", "0409OPIM20190.xml", "builds.txt"}
+	for _, name := range append(kept, removed...) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	CleanupExcept(dir, []string{"0409OPIM2019"}, discardLogger)
+
+	for _, name := range kept {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%q belongs to a failed app and should be kept", name)
+		}
+	}
+	for _, name := range removed {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%q should have been deleted", name)
+		}
+	}
+}
@@ -2,36 +2,75 @@ package sync
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"maucache/internal/catalog"
 	"maucache/internal/cdn"
+	"maucache/internal/config"
 )
 
-// SaveCollaterals 保存编录文件
-// isProd=true: 保存到 cacheDir 根目录 + 带版本号的编录（对应 Save-MAUCollaterals -isProd $true）
-// isProd=false: 保存到 cacheDir/collateral/{version}/（对应 Save-oldMAUCollaterals）
-func SaveCollaterals(ctx context.Context, client *cdn.Client, apps []cdn.AppInfo, cacheDir string, isProd bool, log *slog.Logger) {
+// collateralFile 已下载、尚未发布的一个编录文件
+type collateralFile struct {
+	name    string
+	body    []byte
+	lastMod time.Time
+}
+
+// collateralSet 一个应用的一组编录文件，整组校验、整组发布
+type collateralSet struct {
+	app   cdn.AppInfo
+	dir   string
+	files []collateralFile
+}
+
+// catalogPolicy .cat 编录校验策略
+type catalogPolicy struct {
+	roots  *x509.CertPool // 为 nil 时只校验签名本身，不校验证书链
+	strict bool           // 校验失败时拒绝发布；否则只记录警告
+}
+
+// loadCatalogPolicy 按配置加载编录校验策略（sync.catalog_roots / sync.hash_policy）
+// 只有配置了根证书才拒绝校验失败的编录：不校验证书链时任何自签名的编录都能通过签名校验，
+// 这种校验不足以作为拒绝发布的依据，失败时只记录警告
+func loadCatalogPolicy(cfg *config.Config) (*catalogPolicy, error) {
+	p := &catalogPolicy{}
+	if cfg.Sync.CatalogRoots != "" {
+		roots, err := loadCertPool(cfg.Sync.CatalogRoots)
+		if err != nil {
+			return nil, err
+		}
+		p.roots = roots
+		p.strict = cfg.Sync.HashPolicy != config.HashLenient
+	}
+	return p, nil
+}
+
+// FetchCollaterals 下载编录文件并用 .cat 校验，不写入缓存目录
+// isProd=true: 目标为 cacheDir 根目录 + 带版本号的编录（对应 Save-MAUCollaterals -isProd $true）
+// isProd=false: 目标为 cacheDir/collateral/{version}/（对应 Save-oldMAUCollaterals）
+// 返回待发布的编录组、被拒绝的 AppID 和下载不完整的 AppID，这两类应用都不发布任何文件，继续使用旧编录。
+// 被拒绝表示编录校验失败，本次不下载其安装包；下载不完整（网络等临时故障）只是本次不更新编录，安装包照常下载
+func FetchCollaterals(ctx context.Context, client *cdn.Client, apps []cdn.AppInfo, cacheDir string, isProd bool, policy *catalogPolicy, log *slog.Logger) (sets []collateralSet, rejected, incomplete []string) {
 	mode := "当前版本编录"
 	if !isProd {
 		mode = "历史版本编录"
 	}
-	log.Info("开始保存编录文件", "mode", mode, "app_count", len(apps))
+	log.Info("开始获取编录文件", "mode", mode, "app_count", len(apps))
 
-	totalSaved := 0
 	totalFailed := 0
 	for _, app := range apps {
-		var targetDir string
-		if isProd {
-			targetDir = cacheDir
-		} else {
+		set := collateralSet{app: app, dir: cacheDir}
+		if !isProd {
 			// 对应 Save-oldMAUCollaterals.ps1 第 20-26 行
-			targetDir = filepath.Join(cacheDir, "collateral", app.Version)
-		}
-		if err := os.MkdirAll(targetDir, 0750); err != nil {
-			log.Warn("创建编录目录失败", "path", targetDir, "error", err)
-			continue
+			set.dir = filepath.Join(cacheDir, "collateral", app.Version)
 		}
 
 		// 基础编录 URI
@@ -55,42 +94,257 @@ func SaveCollaterals(ctx context.Context, client *cdn.Client, apps []cdn.AppInfo
 			}
 		}
 
-		appSaved := 0
-		for _, uri := range uris {
+		missing := false
+		for i, uri := range uris {
 			fileName := filepath.Base(uri)
-			outPath := filepath.Join(targetDir, fileName)
-
-			f, err := os.Create(outPath)
+			// 条件 GET：内容未变化时服务器返回 304，直接复用上次保存的内容
+			body, lastMod, err := client.Fetch(ctx, uri)
 			if err != nil {
-				log.Warn("创建文件失败", "path", outPath, "error", err)
+				log.Warn("下载编录失败", "app", app.AppName, "file", fileName, "uri", uri, "error", err)
 				totalFailed++
+				// 前三个是客户端必需的编录，缺一个就不能整组发布；带版本号的编录缺失时其余照常发布
+				missing = missing || i < 3
 				continue
 			}
+			set.files = append(set.files, collateralFile{name: fileName, body: body, lastMod: lastMod})
+		}
+		if missing {
+			log.Warn("编录下载不完整，保留旧编录", "app", app.AppName, "appID", app.AppID, "version", app.Version, "mode", mode)
+			incomplete = append(incomplete, app.AppID)
+			continue
+		}
+
+		if err := policy.verify(set); err != nil {
+			if policy.strict {
+				log.Error("编录校验失败，保留旧编录", "app", app.AppName, "appID", app.AppID, "version", app.Version, "mode", mode, "error", err)
+				rejected = append(rejected, app.AppID)
+				continue
+			}
+			log.Warn("编录校验失败（未配置 catalog_roots 或 hash_policy=lenient，仍然发布）", "app", app.AppName, "appID", app.AppID, "version", app.Version, "mode", mode, "error", err)
+		}
+		sets = append(sets, set)
+	}
 
-			lastMod, dlErr := client.Download(ctx, uri, f)
-			closeErr := f.Close()
+	log.Info("编录文件获取完成", "mode", mode, "apps", len(sets), "rejected", len(rejected), "incomplete", len(incomplete), "failed", totalFailed)
+	return sets, rejected, incomplete
+}
 
-			if dlErr != nil {
-				log.Warn("下载编录失败", "app", app.AppName, "file", fileName, "uri", uri, "error", dlErr)
-				os.Remove(outPath)
-				totalFailed++
+// FetchHistoricCollaterals 下载要保留的历史版本的编录（{AppID}_{版本号}.xml / .cat），目标为 cacheDir/collateral/{版本号}/
+// 除原文件名外再各存一份 {AppID}.xml / {AppID}.cat，与其他版本目录的布局一致，固定版本和分批发布按这两个名字读取；
+// 上游没有历史版本的 -chk.xml。keep 为各应用保留的历史版本数；校验失败的版本在 strict 下不保存，不影响其他版本和当前版本
+func FetchHistoricCollaterals(ctx context.Context, client *cdn.Client, apps []cdn.AppInfo, keep map[string]int, cacheDir string, policy *catalogPolicy, log *slog.Logger) []collateralSet {
+	var sets []collateralSet
+	for _, app := range apps {
+		for _, ver := range app.RecentHistory(keep[app.AppID]) {
+			set := collateralSet{app: app, dir: filepath.Join(cacheDir, "collateral", ver)}
+			set.app.Version = ver
+			failed := false
+			for _, uri := range []string{
+				cdn.BuildVersionedURI(app.CollateralURIs.CAT, ver, ".xml"),
+				cdn.BuildVersionedURI(app.CollateralURIs.CAT, ver, ""),
+			} {
+				if uri == "" {
+					continue
+				}
+				body, lastMod, err := client.Fetch(ctx, uri)
+				if err != nil {
+					log.Warn("下载历史版本编录失败", "app", app.AppName, "version", ver, "uri", uri, "error", err)
+					failed = true
+					break
+				}
+				set.files = append(set.files, collateralFile{name: filepath.Base(uri), body: body, lastMod: lastMod})
+			}
+			if failed {
 				continue
 			}
-			if closeErr != nil {
-				log.Warn("关闭文件失败", "path", outPath, "error", closeErr)
+			if err := policy.verifyHistoric(set); err != nil {
+				if policy.strict {
+					log.Error("历史版本编录校验失败，不保存", "app", app.AppName, "appID", app.AppID, "version", ver, "error", err)
+					continue
+				}
+				log.Warn("历史版本编录校验失败（未配置 catalog_roots 或 hash_policy=lenient，仍然保存）", "app", app.AppName, "appID", app.AppID, "version", ver, "error", err)
+			}
+			set.files = withServedNames(set.files, app)
+			sets = append(sets, set)
+		}
+	}
+	if len(sets) > 0 {
+		log.Info("历史版本编录获取完成", "versions", len(sets))
+	}
+	return sets
+}
+
+// withServedNames 为带版本号的 xml / cat 追加以 {AppID}.xml / {AppID}.cat 命名的副本
+func withServedNames(files []collateralFile, app cdn.AppInfo) []collateralFile {
+	out := files
+	for _, f := range files {
+		name := filepath.Base(app.CollateralURIs.AppXML)
+		if strings.EqualFold(filepath.Ext(f.name), ".cat") {
+			name = filepath.Base(app.CollateralURIs.CAT)
+		}
+		out = append(out, collateralFile{name: name, body: f.body, lastMod: f.lastMod})
+	}
+	return out
+}
+
+// PublishCollaterals 把通过校验的编录写入缓存目录
+// 先写临时文件再改名，客户端不会读到写了一半的编录
+func PublishCollaterals(sets []collateralSet, log *slog.Logger) {
+	totalSaved := 0
+	totalFailed := 0
+	for _, set := range sets {
+		if err := os.MkdirAll(set.dir, 0750); err != nil {
+			log.Warn("创建编录目录失败", "path", set.dir, "error", err)
+			totalFailed += len(set.files)
+			continue
+		}
+		appSaved := 0
+		for _, f := range set.files {
+			outPath := filepath.Join(set.dir, f.name)
+			if err := writeFileAtomic(outPath, f.body, f.lastMod); err != nil {
+				log.Warn("写入文件失败", "path", outPath, "error", err)
 				totalFailed++
 				continue
 			}
+			appSaved++
+		}
+		totalSaved += appSaved
+		log.Debug("编录保存完成", "app", set.app.AppName, "version", set.app.Version, "dir", set.dir, "saved", appSaved)
+	}
+	log.Info("编录文件保存完成", "saved", totalSaved, "failed", totalFailed)
+}
+
+// writeFileAtomic 经临时文件写入 path，lastMod 不为零值时设置修改时间
+func writeFileAtomic(path string, data []byte, lastMod time.Time) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if !lastMod.IsZero() {
+		_ = os.Chtimes(tmp, lastMod, lastMod)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// verify 校验一组编录：所有 .cat 的签名（配置了根证书时还有证书链），
+// 以及 {AppID}.xml / {AppID}-chk.xml 与编录条目一致
+func (p *catalogPolicy) verify(set collateralSet) error {
+	cats, err := p.catalogs(set)
+	if err != nil {
+		return err
+	}
+	return checkCollaterals(set, cats)
+}
 
-			if !lastMod.IsZero() {
-				_ = os.Chtimes(outPath, lastMod, lastMod)
+// verifyHistoric 校验历史版本的编录组：{AppID}_{版本号}.cat 的签名，以及每个 xml 都被编录覆盖
+// 编录中的条目可能是带版本号的文件名，也可能是 {AppID}.xml，两种都认
+func (p *catalogPolicy) verifyHistoric(set collateralSet) error {
+	cats, err := p.catalogs(set)
+	if err != nil {
+		return err
+	}
+	for _, f := range set.files {
+		if !strings.EqualFold(filepath.Ext(f.name), ".xml") {
+			continue
+		}
+		if err := checkListed(cats, f.body, f.name, filepath.Base(set.app.CollateralURIs.AppXML)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkListed 核对内容与任一编录中 names 之一的条目一致
+func checkListed(cats []*catalog.Catalog, body []byte, names ...string) error {
+	for _, name := range names {
+		for _, c := range cats {
+			err := c.Check(name, body)
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, catalog.ErrNotListed) {
+				return err
 			}
-			appSaved++
 		}
+	}
+	return fmt.Errorf("%s 不在编录中", names[0])
+}
 
-		totalSaved += appSaved
-		log.Debug("编录保存完成", "app", app.AppName, "version", app.Version, "dir", targetDir, "saved", appSaved, "total_uris", len(uris))
+// catalogs 解析编录组中的 .cat 并校验签名（配置了根证书时还有证书链），没有 .cat 时返回错误
+func (p *catalogPolicy) catalogs(set collateralSet) ([]*catalog.Catalog, error) {
+	var cats []*catalog.Catalog
+	for _, f := range set.files {
+		if !strings.EqualFold(filepath.Ext(f.name), ".cat") {
+			continue
+		}
+		c, err := catalog.Parse(f.body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		if p.roots != nil {
+			if err := c.VerifyChain(p.roots, time.Time{}); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.name, err)
+			}
+		}
+		cats = append(cats, c)
+	}
+	if len(cats) == 0 {
+		return nil, fmt.Errorf("缺少编录签名文件 %s", filepath.Base(set.app.CollateralURIs.CAT))
+	}
+	return cats, nil
+}
+
+// checkCollaterals 核对编录组中的 xml 与编录条目
+// {AppID}.xml 和 {AppID}-chk.xml 必须出现在编录组中且被某个编录覆盖；
+// 其他 xml 只在编录列出时核对
+func checkCollaterals(set collateralSet, cats []*catalog.Catalog) error {
+	required := map[string]bool{
+		filepath.Base(set.app.CollateralURIs.AppXML): false,
+		filepath.Base(set.app.CollateralURIs.ChkXml): false,
+	}
+	for _, f := range set.files {
+		if !strings.EqualFold(filepath.Ext(f.name), ".xml") {
+			continue
+		}
+		_, isRequired := required[f.name]
+		listed := false
+		for _, c := range cats {
+			err := c.Check(f.name, f.body)
+			if err == nil {
+				listed = true
+				break
+			}
+			if !errors.Is(err, catalog.ErrNotListed) {
+				return err
+			}
+		}
+		if !listed && isRequired {
+			return fmt.Errorf("%s 不在编录中", f.name)
+		}
+		if isRequired {
+			required[f.name] = true
+		}
 	}
+	for name, seen := range required {
+		if !seen {
+			return fmt.Errorf("缺少 %s，无法校验编录组", name)
+		}
+	}
+	return nil
+}
 
-	log.Info("编录文件保存完成", "mode", mode, "saved", totalSaved, "failed", totalFailed)
+// excludeApps 去掉编录被拒绝的应用，它们的安装包按旧编录继续提供，本次不下载
+func excludeApps(apps []cdn.AppInfo, appIDs []string) []cdn.AppInfo {
+	out := make([]cdn.AppInfo, 0, len(apps))
+	for _, app := range apps {
+		if !slices.Contains(appIDs, app.AppID) {
+			out = append(out, app)
+		}
+	}
+	return out
 }
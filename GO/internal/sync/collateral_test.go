@@ -0,0 +1,253 @@
+package sync
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"maucache/internal/catalog"
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+)
+
+func testCollateralApp(base string) cdn.AppInfo {
+	return cdn.AppInfo{
+		AppID:   "0409MSWD2019",
+		AppName: "Word",
+		Version: "16.93.25011212",
+		CollateralURIs: cdn.CollateralURIs{
+			AppXML: base + "/0409MSWD2019.xml",
+			CAT:    base + "/0409MSWD2019.cat",
+			ChkXml: base + "/0409MSWD2019-chk.xml",
+		},
+	}
+}
+
+func sha256Entry(name, data string) catalog.Entry {
+	sum := sha256.Sum256([]byte(data))
+	return catalog.Entry{Name: name, Digest: sum[:]}
+}
+
+func TestCheckCollaterals(t *testing.T) {
+	set := collateralSet{
+		app: testCollateralApp("https://example.com"),
+		files: []collateralFile{
+			{name: "0409MSWD2019.xml", body: []byte("manifest")},
+			{name: "0409MSWD2019-chk.xml", body: []byte("chk")},
+			{name: "0409MSWD2019_16.93.25011212.xml", body: []byte("unlisted")},
+		},
+	}
+	good := &catalog.Catalog{Entries: []catalog.Entry{
+		sha256Entry("0409MSWD2019.xml", "manifest"),
+		sha256Entry("0409MSWD2019-chk.xml", "chk"),
+	}}
+	if err := checkCollaterals(set, []*catalog.Catalog{good}); err != nil {
+		t.Errorf("matching set: %v", err)
+	}
+
+	tampered := &catalog.Catalog{Entries: []catalog.Entry{
+		sha256Entry("0409MSWD2019.xml", "other manifest"),
+		sha256Entry("0409MSWD2019-chk.xml", "chk"),
+	}}
+	var mismatch *catalog.MismatchError
+	if err := checkCollaterals(set, []*catalog.Catalog{tampered}); !errors.As(err, &mismatch) {
+		t.Errorf("mismatched manifest: got %v, want *catalog.MismatchError", err)
+	}
+
+	partial := &catalog.Catalog{Entries: []catalog.Entry{sha256Entry("0409MSWD2019.xml", "manifest")}}
+	if err := checkCollaterals(set, []*catalog.Catalog{partial}); err == nil {
+		t.Error("chk.xml not covered by the catalog should be rejected")
+	}
+
+	missing := set
+	missing.files = set.files[:1]
+	if err := checkCollaterals(missing, []*catalog.Catalog{good}); err == nil {
+		t.Error("set without chk.xml should be rejected")
+	}
+}
+
+func TestFetchCollateralsRejectsUnverifiableSet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not a catalog"))
+	}))
+	defer srv.Close()
+
+	cacheDir := t.TempDir()
+	old := filepath.Join(cacheDir, "0409MSWD2019.xml")
+	os.WriteFile(old, []byte("served"), 0640)
+	apps := []cdn.AppInfo{testCollateralApp(srv.URL)}
+
+	sets, rejected, _ := FetchCollaterals(context.Background(), newTestClient(t), apps, cacheDir, false, &catalogPolicy{strict: true}, discardLogger)
+	if len(sets) != 0 || len(rejected) != 1 || rejected[0] != "0409MSWD2019" {
+		t.Fatalf("strict: sets=%d rejected=%v, want the app rejected", len(sets), rejected)
+	}
+	PublishCollaterals(sets, discardLogger)
+	if data, _ := os.ReadFile(old); string(data) != "served" {
+		t.Errorf("served collateral replaced with %q", data)
+	}
+
+	sets, rejected, _ = FetchCollaterals(context.Background(), newTestClient(t), apps, cacheDir, false, &catalogPolicy{}, discardLogger)
+	if len(sets) != 1 || len(rejected) != 0 {
+		t.Fatalf("lenient: sets=%d rejected=%v, want the set published", len(sets), rejected)
+	}
+	PublishCollaterals(sets, discardLogger)
+	dir := filepath.Join(cacheDir, "collateral", "16.93.25011212")
+	if data, err := os.ReadFile(filepath.Join(dir, "0409MSWD2019.cat")); err != nil || string(data) != "not a catalog" {
+		t.Errorf("published cat = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "0409MSWD2019.cat.tmp")); !os.IsNotExist(err) {
+		t.Error("temporary file left behind")
+	}
+}
+
+func TestFetchCollateralsKeepsOldSetOnFetchFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "-chk.xml") {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	apps := []cdn.AppInfo{testCollateralApp(srv.URL)}
+	client := newTestClient(t)
+	for _, policy := range []*catalogPolicy{{strict: true}, {}} {
+		sets, rejected, incomplete := FetchCollaterals(context.Background(), client, apps, t.TempDir(), false, policy, discardLogger)
+		// A fetch failure keeps the old collaterals but must not exclude the app's packages
+		if len(sets) != 0 || len(rejected) != 0 || len(incomplete) != 1 || incomplete[0] != "0409MSWD2019" {
+			t.Errorf("strict=%v: sets=%d rejected=%v incomplete=%v", policy.strict, len(sets), rejected, incomplete)
+		}
+	}
+}
+
+func TestLoadCatalogPolicyStrictOnlyWithRoots(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Sync.HashPolicy = config.HashStrict
+	p, err := loadCatalogPolicy(cfg)
+	if err != nil || p.strict || p.roots != nil {
+		t.Errorf("without catalog_roots: policy = %+v, %v; want warn-only", p, err)
+	}
+
+	cfg.Sync.CatalogRoots = writeTestRoot(t)
+	if p, err := loadCatalogPolicy(cfg); err != nil || !p.strict || p.roots == nil {
+		t.Errorf("with catalog_roots: policy = %+v, %v; want strict", p, err)
+	}
+	cfg.Sync.HashPolicy = config.HashLenient
+	if p, err := loadCatalogPolicy(cfg); err != nil || p.strict {
+		t.Errorf("lenient with catalog_roots: policy = %+v, %v; want warn-only", p, err)
+	}
+}
+
+// writeTestRoot writes a self-signed CA certificate as PEM and returns its path
+func writeTestRoot(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "roots.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExcludeApps(t *testing.T) {
+	apps := []cdn.AppInfo{{AppID: "A"}, {AppID: "B"}, {AppID: "C"}}
+	got := excludeApps(apps, []string{"B"})
+	if len(got) != 2 || got[0].AppID != "A" || got[1].AppID != "C" {
+		t.Errorf("excludeApps = %v", got)
+	}
+}
+
+func TestFetchHistoricCollaterals(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		_, _ = w.Write([]byte("not a catalog"))
+	}))
+	defer srv.Close()
+
+	cacheDir := t.TempDir()
+	app := testCollateralApp(srv.URL)
+	app.HistoricPackages = map[string][]cdn.Package{"16.92.24120731": nil, "16.91.24111020": nil}
+	keep := map[string]int{app.AppID: 1}
+
+	sets := FetchHistoricCollaterals(context.Background(), newTestClient(t), []cdn.AppInfo{app}, keep, cacheDir, &catalogPolicy{strict: true}, discardLogger)
+	if len(sets) != 0 {
+		t.Fatalf("strict: %d sets, want the unverifiable version skipped", len(sets))
+	}
+	if len(paths) != 2 || paths[0] != "/0409MSWD2019_16.92.24120731.xml" || paths[1] != "/0409MSWD2019_16.92.24120731.cat" {
+		t.Errorf("requested %v, want only the newest kept version's manifest and catalog", paths)
+	}
+
+	sets = FetchHistoricCollaterals(context.Background(), newTestClient(t), []cdn.AppInfo{app}, keep, cacheDir, &catalogPolicy{}, discardLogger)
+	PublishCollaterals(sets, discardLogger)
+	dir := filepath.Join(cacheDir, "collateral", "16.92.24120731")
+	// Saved under the upstream names and under the names pins and rollout rings read
+	for _, name := range []string{"0409MSWD2019_16.92.24120731.xml", "0409MSWD2019_16.92.24120731.cat", "0409MSWD2019.xml", "0409MSWD2019.cat"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("lenient: %s not saved: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "collateral", "16.91.24111020")); !os.IsNotExist(err) {
+		t.Error("version beyond keep_versions should not be saved")
+	}
+}
+
+func TestPinKeptHistoricVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("historic:" + r.URL.Path))
+	}))
+	defer srv.Close()
+
+	cacheDir := t.TempDir()
+	app := testCollateralApp(srv.URL)
+	app.HistoricPackages = map[string][]cdn.Package{"16.92.24120731": nil}
+	sets := FetchHistoricCollaterals(context.Background(), newTestClient(t), []cdn.AppInfo{app}, map[string]int{app.AppID: 1}, cacheDir, &catalogPolicy{}, discardLogger)
+	PublishCollaterals(sets, discardLogger)
+	writeCollateral(t, cacheDir, app.AppID, "current")
+
+	if err := applyPin(cacheDir, app.AppID, "16.92.24120731"); err != nil {
+		t.Fatalf("pinning a keep_versions version: %v", err)
+	}
+	for name, want := range map[string]string{
+		"0409MSWD2019.xml": "historic:/0409MSWD2019_16.92.24120731.xml",
+		"0409MSWD2019.cat": "historic:/0409MSWD2019_16.92.24120731.cat",
+	} {
+		if data, _ := os.ReadFile(filepath.Join(cacheDir, name)); string(data) != want {
+			t.Errorf("root %s = %q, want %q", name, data, want)
+		}
+	}
+	// Upstream has no historic -chk.xml; the current one must not be served with the pinned catalog
+	if _, err := os.Stat(filepath.Join(cacheDir, "0409MSWD2019-chk.xml")); !os.IsNotExist(err) {
+		t.Errorf("root -chk.xml should be removed when the pinned version has none (err=%v)", err)
+	}
+}
@@ -2,16 +2,18 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"math"
 	"os"
 	"path/filepath"
+	gosync "sync"
 	"sync/atomic"
 	"time"
 
 	"maucache/internal/cdn"
 	"maucache/internal/config"
+	"maucache/internal/xar"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -31,64 +33,100 @@ func ExecuteDownloads(ctx context.Context, client *cdn.Client, jobs []DownloadJo
 	cacheDir := cfg.Storage.CacheDir
 	scratchDir := cfg.Storage.ScratchDir
 
+	needCount := 0
+	for _, j := range jobs {
+		if j.NeedDownload {
+			needCount++
+		}
+	}
+	// 准备阶段出错时待下载的文件一个也下不了，全部计为失败，避免本次同步被当作成功
+	setupFailed := DownloadResult{Skipped: len(jobs) - needCount, Failed: needCount}
+
 	// 确保目录存在
 	if err := os.MkdirAll(cacheDir, 0750); err != nil {
 		log.Error("创建缓存目录失败", "path", cacheDir, "error", err)
-		return DownloadResult{}
+		return setupFailed
 	}
 	if err := os.MkdirAll(scratchDir, 0750); err != nil {
 		log.Error("创建临时目录失败", "path", scratchDir, "error", err)
-		return DownloadResult{}
+		return setupFailed
 	}
-
-	needCount := 0
-	for _, j := range jobs {
-		if j.NeedDownload {
-			needCount++
-		}
+	trust, err := loadTrustPolicy(cfg)
+	if err != nil {
+		log.Error("加载签名信任策略失败", "error", err)
+		return setupFailed
 	}
+
+	// 时段调度：按当前时刻确定带宽和并发，同步进行中每分钟重新评估
+	gate := newThrottle(cfg.Sync.Concurrency)
+	limits := applyLimits(cfg, client.Limiter(), gate, time.Now(), log)
 	log.Info("开始执行下载",
 		"total_jobs", len(jobs),
 		"need_download", needCount,
 		"cache_valid", len(jobs)-needCount,
-		"concurrency", cfg.Sync.Concurrency,
+		"concurrency", limits.Concurrency,
+		"bandwidth_limit", limits.BandwidthLimit,
+		"schedule_window", limits.Window,
 	)
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	go watchSchedule(watchCtx, cfg, client.Limiter(), gate, limits, log)
 
+	opts := newDownloadOptions(cfg)
+	opts.trust = trust
+	opts.inventory = loadInventory(filepath.Join(cfg.Storage.StateDir, inventoryFile), cacheDir)
 	var downloaded, skipped, failed atomic.Int64
 
+	// 固定大小的工作池（调度中最大的并发数）从队列取任务，实际并发数由 gate 控制（可在同步中途调整）
+	queue := make(chan DownloadJob)
 	g, gCtx := errgroup.WithContext(ctx)
-	g.SetLimit(cfg.Sync.Concurrency) // 并发数限制
+	for range min(cfg.Sync.MaxConcurrency(), needCount) {
+		g.Go(func() error {
+			for job := range queue {
+				if err := gate.acquire(gCtx); err != nil {
+					failed.Add(1)
+					continue
+				}
+				err := downloadOneFile(gCtx, client, job, opts, log)
+				gate.release()
+				if err != nil {
+					failed.Add(1)
+					// 一个文件失败不阻塞其他下载
+					log.Error("下载失败",
+						"app", job.AppName,
+						"file", job.Payload,
+						"size_bytes", job.SizeBytes,
+						"url", job.LocationURI,
+						"error", err,
+					)
+					continue
+				}
+				downloaded.Add(1)
+			}
+			return nil
+		})
+	}
 
 	for _, job := range jobs {
 		if !job.NeedDownload {
 			skipped.Add(1)
+			if job.linked != nil {
+				opts.inventory.put(job.Payload, *job.linked)
+			}
 			log.Debug("缓存有效，跳过",
 				"app", job.AppName,
 				"file", job.Payload,
 			)
 			continue
 		}
-
-		g.Go(func() error {
-			err := downloadOneFile(gCtx, client, job, cacheDir, scratchDir, cfg.Sync.RetryMax, cfg.Sync.RetryDelay, log)
-			if err != nil {
-				failed.Add(1)
-				// 不 return error，一个文件失败不阻塞其他下载
-				log.Error("下载失败",
-					"app", job.AppName,
-					"file", job.Payload,
-					"size_bytes", job.SizeBytes,
-					"url", job.LocationURI,
-					"error", err,
-				)
-				return nil
-			}
-			downloaded.Add(1)
-			return nil
-		})
+		queue <- job
 	}
+	close(queue)
 
 	_ = g.Wait()
+	if err := opts.inventory.save(); err != nil {
+		log.Error("保存缓存清单失败", "error", err)
+	}
 
 	return DownloadResult{
 		Downloaded: int(downloaded.Load()),
@@ -97,13 +135,48 @@ func ExecuteDownloads(ctx context.Context, client *cdn.Client, jobs []DownloadJo
 	}
 }
 
+// downloadOptions downloadOneFile 的下载参数，由配置生成
+type downloadOptions struct {
+	cacheDir         string
+	scratchDir       string
+	maxRetry         int
+	retryDelay       time.Duration
+	segments         int   // 分段数，<=1 表示不分段
+	segmentThreshold int64 // 超过该大小（字节）的文件才分段下载
+	strictVerify     bool  // 大小或哈希与清单不一致时拒绝放入缓存
+	quarantineDir    string
+	trust            *xar.TrustPolicy // 不为 nil 时 .pkg 必须带有受信任的签名
+	inventory        *inventory       // 记录已发布文件，为 nil 时不记录
+}
+
+// newDownloadOptions 从配置生成下载参数
+func newDownloadOptions(cfg *config.Config) downloadOptions {
+	return downloadOptions{
+		cacheDir:         cfg.Storage.CacheDir,
+		scratchDir:       cfg.Storage.ScratchDir,
+		maxRetry:         cfg.Sync.RetryMax,
+		retryDelay:       cfg.Sync.RetryDelay,
+		segments:         cfg.Sync.Segments,
+		segmentThreshold: int64(cfg.Sync.SegmentThresholdMB) * 1024 * 1024,
+		strictVerify:     cfg.Sync.HashPolicy != config.HashLenient,
+		quarantineDir:    cfg.Storage.QuarantineDir,
+	}
+}
+
+// useSegments 判断该任务是否走分段下载
+func (o downloadOptions) useSegments(job DownloadJob) bool {
+	return o.segments > 1 && job.SizeBytes > 0 && job.SizeBytes >= o.segmentThreshold
+}
+
 // downloadOneFile 下载单个文件，带重试和原子写入
 // 对应 Invoke-MAUCacheDownload.ps1 第 88-108 行
 // 修复 P1: 不再静默吞噬异常
 // 修复 P8: 重试次数可配置 + 指数退避
-func downloadOneFile(ctx context.Context, client *cdn.Client, job DownloadJob, cacheDir, scratchDir string, maxRetry int, retryDelay time.Duration, log *slog.Logger) error {
-	targetPath := filepath.Join(cacheDir, job.Payload)
-	scratchPath := filepath.Join(scratchDir, job.Payload)
+func downloadOneFile(ctx context.Context, client *cdn.Client, job DownloadJob, opts downloadOptions, log *slog.Logger) error {
+	targetPath := filepath.Join(opts.cacheDir, job.Payload)
+	scratchPath := filepath.Join(opts.scratchDir, job.Payload)
+	maxRetry := opts.maxRetry
+	policy := cdn.RetryPolicy{Max: opts.maxRetry, Delay: opts.retryDelay}
 
 	sizeMB := float64(job.SizeBytes) / 1024 / 1024
 	log.Info("开始下载",
@@ -116,9 +189,12 @@ func downloadOneFile(ctx context.Context, client *cdn.Client, job DownloadJob, c
 
 	dlStart := time.Now()
 	var lastErr error
+	var sums cdn.Digests
+	attempts := 0
 	for attempt := 0; attempt < maxRetry; attempt++ {
 		if attempt > 0 {
-			backoff := time.Duration(math.Pow(2, float64(attempt))) * retryDelay
+			// 与元数据请求共用退避规则：2^n × retryDelay，上游给出 Retry-After 时至少等待这么久
+			backoff := policy.Backoff(attempt, lastErr)
 			log.Warn("重试下载",
 				"file", job.Payload,
 				"attempt", attempt+1,
@@ -133,7 +209,21 @@ func downloadOneFile(ctx context.Context, client *cdn.Client, job DownloadJob, c
 			}
 		}
 
-		lastErr = doDownload(ctx, client, job.LocationURI, scratchPath)
+		attempts++
+		if opts.useSegments(job) {
+			sums, lastErr = doSegmentedDownload(ctx, client, job, scratchPath, opts.segments, log)
+			if errors.Is(lastErr, cdn.ErrRangeNotSupported) {
+				log.Warn("服务器不支持分段下载，回退为单连接下载", "file", job.Payload)
+				removeResumeState(scratchPath)
+				sums, lastErr = doDownload(ctx, client, job, scratchPath, log)
+			}
+		} else {
+			sums, lastErr = doDownload(ctx, client, job, scratchPath, log)
+		}
+		if lastErr == nil {
+			// 校验失败的文件已被删除，重试时从头下载
+			lastErr = verifyDownload(job, scratchPath, sums, opts.strictVerify, log)
+		}
 		if lastErr == nil {
 			break
 		}
@@ -142,28 +232,34 @@ func downloadOneFile(ctx context.Context, client *cdn.Client, job DownloadJob, c
 			"attempt", attempt+1,
 			"error", lastErr,
 		)
+		// 404 / 403 等重试也不会成功，直接放弃
+		if !cdn.IsRetryable(lastErr) {
+			break
+		}
 	}
 	if lastErr != nil {
 		dlDuration := time.Since(dlStart)
 		log.Error("下载最终失败",
 			"file", job.Payload,
-			"total_attempts", maxRetry,
+			"total_attempts", attempts,
 			"duration", dlDuration.Round(time.Second),
 			"error", lastErr,
 		)
-		return fmt.Errorf("重试 %d 次后仍失败: %w", maxRetry, lastErr)
+		return fmt.Errorf("尝试 %d 次后仍失败: %w", attempts, lastErr)
 	}
 
-	// 验证下载文件大小
-	if fi, err := os.Stat(scratchPath); err == nil {
-		if job.SizeBytes > 0 && fi.Size() != job.SizeBytes {
-			log.Warn("下载文件大小不匹配",
-				"file", job.Payload,
-				"expected_bytes", job.SizeBytes,
-				"actual_bytes", fi.Size(),
-			)
+	// 结构无效或签名不可信的安装包重试也不会变好（上游给的就是它），隔离后等下次同步再处理
+	var info xar.PackageInfo
+	if isInstallerPackage(job.Payload) {
+		var err error
+		if info, err = validatePackage(job, scratchPath, opts.quarantineDir, opts.trust, log); err != nil {
+			return err
 		}
 	}
+	fi, err := os.Stat(scratchPath)
+	if err != nil {
+		return err
+	}
 
 	// 原子 rename：scratch → cache
 	// 对应 Invoke-MAUCacheDownload.ps1 第 108 行: Move-Item
@@ -175,6 +271,9 @@ func downloadOneFile(ctx context.Context, client *cdn.Client, job DownloadJob, c
 	if !job.LastMod.IsZero() {
 		_ = os.Chtimes(targetPath, job.LastMod, job.LastMod)
 	}
+	if opts.inventory != nil {
+		opts.inventory.record(job, fi.Size(), sums, info)
+	}
 
 	dlDuration := time.Since(dlStart)
 	speedMBps := 0.0
@@ -190,23 +289,156 @@ func downloadOneFile(ctx context.Context, client *cdn.Client, job DownloadJob, c
 	return nil
 }
 
-// doDownload 执行一次下载（写到 scratch 路径）
-func doDownload(ctx context.Context, client *cdn.Client, uri, scratchPath string) error {
-	f, err := os.Create(scratchPath)
+// verifyDownload 用清单元数据校验 scratch 文件：先比对大小，再比对哈希
+// 严格模式下不一致的文件被删除（不会进入缓存）并返回错误；宽松模式只记录警告
+func verifyDownload(job DownloadJob, scratchPath string, sums cdn.Digests, strict bool, log *slog.Logger) error {
+	fi, err := os.Stat(scratchPath)
 	if err != nil {
 		return err
 	}
 
-	_, dlErr := client.Download(ctx, uri, f)
+	var problem error
+	if job.SizeBytes > 0 && fi.Size() != job.SizeBytes {
+		problem = fmt.Errorf("下载文件大小不匹配: 期望 %d，实际 %d", job.SizeBytes, fi.Size())
+	} else {
+		err := job.Package.VerifyDigests(sums)
+		switch {
+		case errors.Is(err, cdn.ErrNoManifestHash):
+			log.Debug("清单未提供哈希，跳过校验", "file", job.Payload)
+		case err != nil:
+			problem = err
+		default:
+			log.Debug("哈希校验通过", "file", job.Payload)
+		}
+	}
+	if problem == nil {
+		return nil
+	}
+	if !strict {
+		log.Warn("下载文件校验失败，宽松模式仍放入缓存", "file", job.Payload, "error", problem)
+		return nil
+	}
+	log.Error("下载文件校验失败，不放入缓存", "file", job.Payload, "error", problem)
+	os.Remove(scratchPath)
+	removeResumeState(scratchPath)
+	return problem
+}
+
+// doDownload 执行一次下载（写到 scratch 路径），返回整个文件的摘要
+// 部分文件和 .resume 元数据在失败时保留，下次重试或进程重启后从断点继续
+func doDownload(ctx context.Context, client *cdn.Client, job DownloadJob, scratchPath string, log *slog.Logger) (cdn.Digests, error) {
+	want := newResumeState(job)
+	offset := resumeOffset(scratchPath, want)
+
+	if offset > 0 && offset == job.SizeBytes {
+		// 上次已完整下载但未来得及 rename
+		log.Info("部分文件已完整，跳过下载", "file", job.Payload, "size_bytes", offset)
+		removeResumeState(scratchPath)
+		return cdn.HashFile(scratchPath)
+	}
+
+	f, err := os.OpenFile(scratchPath, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return cdn.Digests{}, err
+	}
+	if offset == 0 {
+		// 无法续传：丢弃旧的部分文件，记录新的续传状态
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return cdn.Digests{}, err
+		}
+		if err := saveResumeState(scratchPath, want); err != nil {
+			log.Warn("写入续传状态失败", "file", job.Payload, "error", err)
+		}
+	} else {
+		log.Info("断点续传", "file", job.Payload, "offset_bytes", offset, "size_bytes", job.SizeBytes)
+	}
+
+	res, dlErr := client.DownloadResume(ctx, job.LocationURI, f, offset, want.ifRange())
 	closeErr := f.Close()
 
 	if dlErr != nil {
-		os.Remove(scratchPath) // 删除不完整文件
-		return dlErr
+		// 保留部分文件，下次从断点继续
+		return cdn.Digests{}, dlErr
 	}
 	if closeErr != nil {
 		os.Remove(scratchPath)
-		return closeErr
+		removeResumeState(scratchPath)
+		return cdn.Digests{}, closeErr
 	}
-	return nil
+	if offset > 0 && !res.Resumed {
+		log.Info("服务器未接受 Range 请求，已整文件重新下载", "file", job.Payload)
+	}
+	removeResumeState(scratchPath)
+	return res.Digests, nil
+}
+
+// doSegmentedDownload 分段并发下载（写到 scratch 路径），返回整个文件的摘要
+// scratch 文件预分配为完整大小，各段按偏移量直接写入；每段完成后记录到 .resume，
+// 重试或进程重启时只下载未完成的段。各段乱序到达，摘要在全部完成后整体计算
+func doSegmentedDownload(ctx context.Context, client *cdn.Client, job DownloadJob, scratchPath string, segments int, log *slog.Logger) (cdn.Digests, error) {
+	want := newResumeState(job)
+	want.Segments = cdn.SplitSegments(job.SizeBytes, segments)
+
+	done := make([]bool, len(want.Segments))
+	if saved, ok := loadResumeState(scratchPath); ok && saved.matches(want) && len(saved.SegmentsDone) == len(done) {
+		if fi, err := os.Stat(scratchPath); err == nil && fi.Size() == job.SizeBytes {
+			copy(done, saved.SegmentsDone)
+		}
+	}
+
+	f, err := os.OpenFile(scratchPath, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return cdn.Digests{}, err
+	}
+	defer f.Close()
+	if err := f.Truncate(job.SizeBytes); err != nil {
+		return cdn.Digests{}, err
+	}
+
+	var (
+		pending []cdn.Segment
+		index   []int // pending[i] 对应 want.Segments[index[i]]
+	)
+	for i, seg := range want.Segments {
+		if !done[i] {
+			pending = append(pending, seg)
+			index = append(index, i)
+		}
+	}
+	if len(pending) < len(want.Segments) {
+		log.Info("分段续传", "file", job.Payload, "segments", len(want.Segments), "remaining", len(pending))
+	} else {
+		log.Debug("分段下载", "file", job.Payload, "segments", len(want.Segments))
+	}
+
+	var mu gosync.Mutex
+	want.SegmentsDone = done
+	if err := saveResumeState(scratchPath, want); err != nil {
+		log.Warn("写入续传状态失败", "file", job.Payload, "error", err)
+	}
+	dlErr := client.DownloadSegments(ctx, job.LocationURI, f, pending, want.ifRange(), func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+		done[index[i]] = true
+		_ = saveResumeState(scratchPath, want)
+	})
+	if dlErr != nil {
+		return cdn.Digests{}, dlErr
+	}
+	if err := f.Sync(); err != nil {
+		return cdn.Digests{}, err
+	}
+
+	// 所有段完成后校验总大小再交给上层 rename
+	fi, err := f.Stat()
+	if err != nil {
+		return cdn.Digests{}, err
+	}
+	if fi.Size() != job.SizeBytes {
+		removeResumeState(scratchPath)
+		return cdn.Digests{}, fmt.Errorf("分段下载后文件大小不符: 期望 %d，实际 %d", job.SizeBytes, fi.Size())
+	}
+	removeResumeState(scratchPath)
+	return cdn.HashFile(scratchPath)
 }
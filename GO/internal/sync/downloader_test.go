@@ -0,0 +1,203 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+)
+
+func testDownloadOptions(t *testing.T) downloadOptions {
+	t.Helper()
+	dir := t.TempDir()
+	opts := downloadOptions{
+		cacheDir:     filepath.Join(dir, "cache"),
+		scratchDir:   filepath.Join(dir, "scratch"),
+		maxRetry:     3,
+		retryDelay:   time.Millisecond,
+		strictVerify: true,
+	}
+	os.MkdirAll(opts.cacheDir, 0750)
+	os.MkdirAll(opts.scratchDir, 0750)
+	return opts
+}
+
+func TestDownloadOneFileDoesNotRetry404(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	job := DownloadJob{AppName: "Test", LocationURI: srv.URL + "/gone.pkg", Payload: "gone.pkg", NeedDownload: true}
+	err := downloadOneFile(context.Background(), newTestClient(t), job, testDownloadOptions(t), discardLogger)
+	if err == nil {
+		t.Fatal("expected an error for 404")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server called %d times, want 1 (404 must not be retried)", calls.Load())
+	}
+}
+
+func TestDownloadOneFileRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("payload"))
+	}))
+	defer srv.Close()
+
+	// Not a .pkg, so the fake body is not subject to xar validation
+	opts := testDownloadOptions(t)
+	job := DownloadJob{AppName: "Test", LocationURI: srv.URL + "/a.zip", Payload: "a.zip", SizeBytes: 7, NeedDownload: true}
+	if err := downloadOneFile(context.Background(), newTestClient(t), job, opts, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("server called %d times, want 3", calls.Load())
+	}
+	data, err := os.ReadFile(filepath.Join(opts.cacheDir, "a.zip"))
+	if err != nil || string(data) != "payload" {
+		t.Errorf("cached file = %q, %v", data, err)
+	}
+}
+
+func TestDownloadOneFileRejectsHashMismatch(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte("<html>proxy</html>"))
+	}))
+	defer srv.Close()
+
+	good := sha256.Sum256([]byte("the real package"))
+	job := DownloadJob{
+		AppName: "Test", LocationURI: srv.URL + "/a.zip", Payload: "a.zip", NeedDownload: true,
+		Package: cdn.Package{FileName: "a.zip", SHA256: good[:]},
+	}
+
+	opts := testDownloadOptions(t)
+	err := downloadOneFile(context.Background(), newTestClient(t), job, opts, discardLogger)
+	var mismatch *cdn.HashMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("err = %v, want hash mismatch", err)
+	}
+	if calls.Load() != int32(opts.maxRetry) {
+		t.Errorf("server called %d times, want %d (mismatch is retried)", calls.Load(), opts.maxRetry)
+	}
+	if _, err := os.Stat(filepath.Join(opts.cacheDir, "a.zip")); !os.IsNotExist(err) {
+		t.Error("mismatching file must not be published to the cache")
+	}
+	if _, err := os.Stat(filepath.Join(opts.scratchDir, "a.zip")); !os.IsNotExist(err) {
+		t.Error("mismatching file should be removed from scratch")
+	}
+
+	// Lenient mode publishes the file anyway.
+	opts.strictVerify = false
+	if err := downloadOneFile(context.Background(), newTestClient(t), job, opts, discardLogger); err != nil {
+		t.Fatalf("lenient download failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(opts.cacheDir, "a.zip")); err != nil {
+		t.Errorf("lenient mode should publish the file: %v", err)
+	}
+}
+
+func TestDownloadOneFileRejectsSizeMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("short"))
+	}))
+	defer srv.Close()
+
+	opts := testDownloadOptions(t)
+	opts.maxRetry = 1
+	job := DownloadJob{AppName: "Test", LocationURI: srv.URL + "/b.pkg", Payload: "b.pkg", SizeBytes: 100, NeedDownload: true}
+	if err := downloadOneFile(context.Background(), newTestClient(t), job, opts, discardLogger); err == nil {
+		t.Fatal("expected size mismatch error")
+	}
+	if _, err := os.Stat(filepath.Join(opts.cacheDir, "b.pkg")); !os.IsNotExist(err) {
+		t.Error("truncated file must not be published to the cache")
+	}
+}
+
+func TestDownloadOneFileQuarantinesInvalidPackage(t *testing.T) {
+	page := []byte("<html><body>Blocked by proxy policy</body></html>")
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write(page)
+	}))
+	defer srv.Close()
+
+	opts := testDownloadOptions(t)
+	opts.quarantineDir = filepath.Join(t.TempDir(), "quarantine")
+	job := DownloadJob{
+		AppName: "Test", LocationURI: srv.URL + "/c.pkg", Payload: "c.pkg",
+		SizeBytes: int64(len(page)), NeedDownload: true,
+	}
+	if err := downloadOneFile(context.Background(), newTestClient(t), job, opts, discardLogger); err == nil {
+		t.Fatal("expected an error for a non-xar package")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server called %d times, want 1 (structural failures are not retried)", calls.Load())
+	}
+	if _, err := os.Stat(filepath.Join(opts.cacheDir, "c.pkg")); !os.IsNotExist(err) {
+		t.Errorf("invalid package was published: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(opts.quarantineDir, "c.pkg"))
+	if err != nil || string(data) != string(page) {
+		t.Errorf("quarantined file = %q, %v", data, err)
+	}
+}
+
+func TestExecuteDownloadsCountsSetupFailureAsFailed(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Storage.CacheDir = filepath.Join(dir, "cache")
+	cfg.Storage.ScratchDir = filepath.Join(dir, "scratch")
+	cfg.Storage.StateDir = filepath.Join(dir, "state")
+	cfg.Sync.Concurrency = 2
+	cfg.Sync.SignatureRoots = filepath.Join(dir, "missing-roots.pem")
+
+	jobs := []DownloadJob{
+		{AppName: "Word", Payload: "Word.pkg", NeedDownload: true},
+		{AppName: "Excel", Payload: "Excel.pkg", NeedDownload: true},
+		{AppName: "Teams", Payload: "Teams.pkg"},
+	}
+	res := ExecuteDownloads(context.Background(), newTestClient(t), jobs, cfg, discardLogger)
+	if res.Failed != 2 || res.Skipped != 1 || res.Downloaded != 0 {
+		t.Errorf("result = %+v, want every pending download counted as failed", res)
+	}
+}
+
+func TestExecuteDownloadsRecordsLinkedFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Storage.CacheDir = filepath.Join(dir, "cache")
+	cfg.Storage.ScratchDir = filepath.Join(dir, "scratch")
+	cfg.Storage.StateDir = filepath.Join(dir, "state")
+	cfg.Sync.Concurrency = 1
+	os.MkdirAll(cfg.Storage.CacheDir, 0750)
+	os.WriteFile(filepath.Join(cfg.Storage.CacheDir, "Word.pkg"), []byte("word"), 0640)
+
+	jobs := []DownloadJob{{AppName: "Word", Payload: "Word.pkg", linked: &inventoryEntry{App: "Word", Size: 4, TeamID: "UBF8T346G9"}}}
+	if res := ExecuteDownloads(context.Background(), newTestClient(t), jobs, cfg, discardLogger); res.Skipped != 1 || res.Failed != 0 {
+		t.Fatalf("result = %+v", res)
+	}
+	inv := loadInventory(filepath.Join(cfg.Storage.StateDir, inventoryFile), cfg.Storage.CacheDir)
+	if e, ok := inv.Files["Word.pkg"]; !ok || e.TeamID != "UBF8T346G9" {
+		t.Errorf("inventory entry = %+v, %v; want the linked entry", e, ok)
+	}
+}
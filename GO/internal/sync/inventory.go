@@ -0,0 +1,106 @@
+package sync
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"maucache/internal/cdn"
+	"maucache/internal/xar"
+)
+
+// inventoryFile 缓存清单在 StateDir 中的文件名
+const inventoryFile = "inventory.json"
+
+// inventoryEntry 缓存中一个已发布文件的来源和校验结果
+type inventoryEntry struct {
+	App         string    `json:"app"`
+	URL         string    `json:"url"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256,omitempty"`
+	PublishedAt time.Time `json:"published_at"`
+
+	// 以下仅 .pkg：包标识和签名者（未配置签名校验时签名者为空）
+	Identifier    string `json:"identifier,omitempty"`
+	Version       string `json:"version,omitempty"`
+	BundleVersion string `json:"bundle_version,omitempty"`
+	Signer        string `json:"signer,omitempty"`
+	TeamID        string `json:"team_id,omitempty"`
+	Fingerprint   string `json:"signer_sha256,omitempty"`
+}
+
+// inventory 缓存清单：文件名 → 发布记录，持久化为 StateDir/inventory.json
+// 下载并发写入，同步结束时保存
+type inventory struct {
+	mu       gosync.Mutex
+	path     string
+	cacheDir string
+	Files    map[string]inventoryEntry `json:"files"`
+}
+
+// loadInventory 读取缓存清单，不存在或损坏时从空清单开始
+func loadInventory(path, cacheDir string) *inventory {
+	inv := &inventory{path: path, cacheDir: cacheDir}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, inv)
+	}
+	if inv.Files == nil {
+		inv.Files = make(map[string]inventoryEntry)
+	}
+	return inv
+}
+
+// record 记录一个刚发布的文件
+func (inv *inventory) record(job DownloadJob, size int64, sums cdn.Digests, info xar.PackageInfo) {
+	e := inventoryEntry{
+		App:           job.AppName,
+		URL:           job.LocationURI,
+		Size:          size,
+		PublishedAt:   time.Now().UTC(),
+		Identifier:    info.Identifier,
+		Version:       info.Version,
+		BundleVersion: info.BundleVersion,
+		Signer:        info.Signer.CommonName,
+		TeamID:        info.Signer.TeamID,
+		Fingerprint:   info.Signer.Fingerprint,
+	}
+	if len(sums.SHA256) > 0 {
+		e.SHA256 = hex.EncodeToString(sums.SHA256)
+	}
+	inv.mu.Lock()
+	inv.Files[job.Payload] = e
+	inv.mu.Unlock()
+}
+
+// put 记录一个从其他频道硬链接过来的文件，沿用其来源频道的发布记录
+func (inv *inventory) put(name string, e inventoryEntry) {
+	inv.mu.Lock()
+	inv.Files[name] = e
+	inv.mu.Unlock()
+}
+
+// save 写回缓存清单，已不在缓存目录中的文件（被清理或手工删除）一并移除
+func (inv *inventory) save() error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	for name := range inv.Files {
+		if _, err := os.Stat(filepath.Join(inv.cacheDir, name)); os.IsNotExist(err) {
+			delete(inv.Files, name)
+		}
+	}
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(inv.path), 0750); err != nil {
+		return err
+	}
+	tmp := inv.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, inv.path)
+}
@@ -0,0 +1,55 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+	"maucache/internal/xar"
+)
+
+func TestInventoryRecordsSignerAndPrunesMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	path := filepath.Join(dir, "state", inventoryFile)
+	os.MkdirAll(cacheDir, 0750)
+	os.WriteFile(filepath.Join(cacheDir, "Word.pkg"), []byte("pkg"), 0640)
+
+	inv := loadInventory(path, cacheDir)
+	info := xar.PackageInfo{
+		Identifier: "com.microsoft.word.standalone.365",
+		Signer:     xar.Signer{CommonName: "Developer ID Installer: Microsoft Corporation (UBF8T346G9)", TeamID: "UBF8T346G9"},
+	}
+	inv.record(DownloadJob{AppName: "Word", Payload: "Word.pkg"}, 3, cdn.Digests{SHA256: []byte{0xab}}, info)
+	inv.record(DownloadJob{AppName: "Excel", Payload: "Gone.pkg"}, 3, cdn.Digests{}, xar.PackageInfo{})
+	if err := inv.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := loadInventory(path, cacheDir).Files
+	if len(got) != 1 {
+		t.Fatalf("inventory has %d entries, want 1 (files no longer cached are pruned): %v", len(got), got)
+	}
+	e := got["Word.pkg"]
+	if e.TeamID != "UBF8T346G9" || e.Signer != info.Signer.CommonName || e.SHA256 != "ab" || e.Identifier != info.Identifier {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestLoadTrustPolicy(t *testing.T) {
+	cfg := &config.Config{}
+	if trust, err := loadTrustPolicy(cfg); trust != nil || err != nil {
+		t.Errorf("no roots configured: got %v, %v; want nil, nil", trust, err)
+	}
+
+	cfg.Sync.SignatureRoots = filepath.Join(t.TempDir(), "roots.pem")
+	if _, err := loadTrustPolicy(cfg); err == nil {
+		t.Error("missing roots file should be an error")
+	}
+	os.WriteFile(cfg.Sync.SignatureRoots, []byte("not a certificate"), 0640)
+	if _, err := loadTrustPolicy(cfg); err == nil {
+		t.Error("roots file without certificates should be an error")
+	}
+}
@@ -0,0 +1,310 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+// pinsFile 管理接口设置的版本固定在 StateDir 中的文件名
+const pinsFile = "pins.json"
+
+// 版本固定的来源
+const (
+	pinFromConfig = "config" // apps.pins
+	pinFromAPI    = "api"    // 管理接口 POST /apps/{id}/pin
+)
+
+// errPinnedByConfig 固定来自配置文件，不能通过管理接口取消
+var errPinnedByConfig = errors.New("该应用由配置 apps.pins 固定，请修改配置")
+
+// Pin 一个应用的版本固定
+type Pin struct {
+	Version  string    `json:"version"`
+	Source   string    `json:"source"`
+	Reason   string    `json:"reason,omitempty"`
+	By       string    `json:"by,omitempty"` // 通过管理接口固定时为操作人（访问令牌的名称）
+	PinnedAt time.Time `json:"pinned_at,omitempty"`
+}
+
+// pinStatus /sync/status 中一个固定应用的状态
+type pinStatus struct {
+	Pin
+	// Pending 上游已发布、因固定而未对客户端提供的版本（频道 → 版本号）
+	Pending map[string]string `json:"pending,omitempty"`
+}
+
+// pinStore 版本固定：配置中的固定加上管理接口设置的固定，同一应用以接口设置的为准
+// 接口设置的固定持久化为 StateDir/pins.json，重启后仍然有效
+type pinStore struct {
+	mu      gosync.Mutex
+	path    string
+	config  map[string]string
+	API     map[string]Pin               `json:"pins"`
+	pending map[string]map[string]string // AppID → 频道 → 上游最新版本
+}
+
+// loadPins 读取接口设置的固定，不存在或损坏时从空开始
+func loadPins(path string, config map[string]string) *pinStore {
+	s := &pinStore{path: path, config: config, pending: make(map[string]map[string]string)}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, s)
+	}
+	if s.API == nil {
+		s.API = make(map[string]Pin)
+	}
+	return s
+}
+
+// all 返回当前生效的固定（AppID → Pin）
+func (s *pinStore) all() map[string]Pin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pins := make(map[string]Pin, len(s.config)+len(s.API))
+	for id, v := range s.config {
+		pins[id] = Pin{Version: v, Source: pinFromConfig}
+	}
+	for id, p := range s.API {
+		pins[id] = p
+	}
+	return pins
+}
+
+// set 设置接口固定并保存
+func (s *pinStore) set(appID string, p Pin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.API[appID] = p
+	return s.save()
+}
+
+// remove 取消接口固定并保存；只有配置固定时返回 errPinnedByConfig
+func (s *pinStore) remove(appID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.API[appID]; !ok {
+		if _, ok := s.config[appID]; ok {
+			return errPinnedByConfig
+		}
+		return nil
+	}
+	delete(s.API, appID)
+	delete(s.pending, appID)
+	return s.save()
+}
+
+// setPending 记录频道中固定应用的上游最新版本，与固定版本相同时清除
+func (s *pinStore) setPending(appID, channel, version, pinned string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version == pinned {
+		delete(s.pending[appID], channel)
+		return
+	}
+	if s.pending[appID] == nil {
+		s.pending[appID] = make(map[string]string)
+	}
+	s.pending[appID][channel] = version
+}
+
+// status 返回 /sync/status 中的 pins
+func (s *pinStore) status() map[string]pinStatus {
+	pins := s.all()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]pinStatus, len(pins))
+	for id, p := range pins {
+		st := pinStatus{Pin: p}
+		if len(s.pending[id]) > 0 {
+			st.Pending = make(map[string]string, len(s.pending[id]))
+			for ch, v := range s.pending[id] {
+				st.Pending[ch] = v
+			}
+		}
+		out[id] = st
+	}
+	return out
+}
+
+// save 写回接口设置的固定，调用方持有 mu
+func (s *pinStore) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// pinnedFiles 固定时替换的根目录编录
+func pinnedFiles(appID string) []string {
+	return []string{appID + ".xml", appID + "-chk.xml", appID + ".cat"}
+}
+
+// applyPin 用 collateral/{version}/ 中保存的编录替换根目录的 {AppID}.xml / -chk.xml / .cat
+// 文件齐全才替换，避免根目录出现不同版本混在一起的编录组。keep_versions 保留的历史版本没有 -chk.xml
+// （上游不提供），此时删除根目录的 -chk.xml：它属于另一个版本，与固定版本的编录对不上
+func applyPin(cacheDir, appID, version string) error {
+	dir := filepath.Join(cacheDir, "collateral", version)
+	type pinned struct {
+		name    string
+		data    []byte
+		modTime time.Time
+	}
+	chk := appID + "-chk.xml"
+	var files []pinned
+	hasChk := true
+	for _, name := range pinnedFiles(appID) {
+		src := filepath.Join(dir, name)
+		data, err := os.ReadFile(src)
+		if name == chk && errors.Is(err, os.ErrNotExist) {
+			hasChk = false
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("collateral/%s 中没有 %s: %w", version, name, err)
+		}
+		fi, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		files = append(files, pinned{name: name, data: data, modTime: fi.ModTime()})
+	}
+	for _, f := range files {
+		if err := writeFileAtomic(filepath.Join(cacheDir, f.name), f.data, f.modTime); err != nil {
+			return err
+		}
+	}
+	if !hasChk {
+		if err := os.Remove(filepath.Join(cacheDir, chk)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdPinned 从待发布的当前版本编录中去掉固定的应用，记录它们的上游最新版本
+// 返回剩余的编录组和固定应用的 AppID（清理时保留其根目录编录）
+func (e *Engine) holdPinned(sets []collateralSet, channel string, pins map[string]Pin, log *slog.Logger) ([]collateralSet, []string) {
+	var held []string
+	out := sets[:0]
+	for _, set := range sets {
+		pin, ok := pins[set.app.AppID]
+		if !ok {
+			out = append(out, set)
+			continue
+		}
+		held = append(held, set.app.AppID)
+		e.pins.setPending(set.app.AppID, channel, set.app.Version, pin.Version)
+		if set.app.Version != pin.Version {
+			log.Info("应用已固定版本，暂不发布新版本编录", "appID", set.app.AppID, "pinned", pin.Version, "pending", set.app.Version)
+		}
+	}
+	for id := range pins {
+		if !slices.Contains(held, id) {
+			held = append(held, id)
+		}
+	}
+	return out, held
+}
+
+// applyPins 把固定应用的根目录编录换成固定版本；该频道没有固定版本的编录时保留现有文件
+func applyPins(cacheDir string, pins map[string]Pin, log *slog.Logger) {
+	for id, pin := range pins {
+		if err := applyPin(cacheDir, id, pin.Version); err != nil {
+			log.Warn("无法应用版本固定，保留现有编录", "appID", id, "version", pin.Version, "error", err)
+		}
+	}
+}
+
+// pinRequest POST /apps/{id}/pin 的请求体
+type pinRequest struct {
+	Version string `json:"version"`
+	Reason  string `json:"reason"`
+}
+
+// handlePin POST /apps/{id}/pin：固定应用版本，立即替换各频道根目录的编录
+func (e *Engine) handlePin(w http.ResponseWriter, r *http.Request) {
+	appID, ok := e.lookupApp(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("未知应用: %s", r.PathValue("id")))
+		return
+	}
+	var req pinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Version) == "" {
+		writeJSONError(w, http.StatusBadRequest, errors.New(`请求体应为 {"version": "...", "reason": "..."}`))
+		return
+	}
+	pin := Pin{Version: strings.TrimSpace(req.Version), Source: pinFromAPI, Reason: req.Reason, By: adminUser(r), PinnedAt: time.Now().UTC()}
+
+	e.publishMu.Lock()
+	defer e.publishMu.Unlock()
+	// 根目录频道必须已保存该版本的编录；其他频道有则一并替换
+	if err := applyPin(e.cfg.Storage.CacheDir, appID, pin.Version); err != nil {
+		writeJSONError(w, http.StatusConflict, err)
+		return
+	}
+	for _, ch := range e.channels[1:] {
+		if err := applyPin(ch.cfg.Storage.CacheDir, appID, pin.Version); err != nil {
+			e.log.Warn("频道中没有固定版本的编录，保留现有编录", "channel", ch.name, "appID", appID, "version", pin.Version, "error", err)
+		}
+	}
+	if err := e.pins.set(appID, pin); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("保存版本固定失败: %w", err))
+		return
+	}
+	e.log.Warn("应用版本已固定", "appID", appID, "version", pin.Version, "reason", pin.Reason, "by", pin.By)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"app": appID, "pin": pin})
+}
+
+// handleUnpin DELETE /apps/{id}/pin：取消接口设置的固定，下次同步恢复发布最新版本
+func (e *Engine) handleUnpin(w http.ResponseWriter, r *http.Request) {
+	appID, ok := e.lookupApp(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("未知应用: %s", r.PathValue("id")))
+		return
+	}
+	if err := e.pins.remove(appID); errors.Is(err, errPinnedByConfig) {
+		writeJSONError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("保存版本固定失败: %w", err))
+		return
+	}
+	e.log.Warn("应用版本固定已取消，下次同步恢复最新版本", "appID", appID, "by", adminUser(r))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"app": appID, "pinned": false})
+}
+
+// lookupApp 按 AppID（不区分大小写）查找要同步的应用，返回规范的 AppID
+func (e *Engine) lookupApp(id string) (string, bool) {
+	for _, def := range e.client.Apps() {
+		if strings.EqualFold(def.AppID, id) {
+			return def.AppID, true
+		}
+	}
+	return "", false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+)
+
+func writeCollateral(t *testing.T, dir, appID, marker string) {
+	t.Helper()
+	os.MkdirAll(dir, 0750)
+	for _, name := range pinnedFiles(appID) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(marker+":"+name), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPinStoreMergesConfigAndPersistsAPIPins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", pinsFile)
+	s := loadPins(path, map[string]string{"0409OPIM2019": "16.92", "0409MSWD2019": "16.91"})
+	if err := s.set("0409OPIM2019", Pin{Version: "16.90", Source: pinFromAPI}); err != nil {
+		t.Fatal(err)
+	}
+	s.setPending("0409OPIM2019", "Production", "16.93", "16.90")
+
+	st := s.status()
+	if st["0409OPIM2019"].Version != "16.90" || st["0409OPIM2019"].Source != pinFromAPI {
+		t.Errorf("API pin should override config: %+v", st["0409OPIM2019"])
+	}
+	if st["0409OPIM2019"].Pending["Production"] != "16.93" {
+		t.Errorf("pending = %v", st["0409OPIM2019"].Pending)
+	}
+	if st["0409MSWD2019"].Source != pinFromConfig {
+		t.Errorf("config pin = %+v", st["0409MSWD2019"])
+	}
+
+	reloaded := loadPins(path, nil).all()
+	if len(reloaded) != 1 || reloaded["0409OPIM2019"].Version != "16.90" {
+		t.Errorf("reloaded pins = %+v, want only the API pin", reloaded)
+	}
+
+	if err := s.remove("0409MSWD2019"); err != errPinnedByConfig {
+		t.Errorf("removing a config pin: err = %v, want errPinnedByConfig", err)
+	}
+	if err := s.remove("0409OPIM2019"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.all()["0409OPIM2019"]; got.Version != "16.92" || got.Source != pinFromConfig {
+		t.Errorf("after unpinning via API the config pin applies again, got %+v", got)
+	}
+}
+
+func TestHoldPinnedKeepsServedCollaterals(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCollateral(t, filepath.Join(cacheDir, "collateral", "16.92"), "0409OPIM2019", "old")
+	e := &Engine{pins: loadPins(filepath.Join(t.TempDir(), pinsFile), nil)}
+	pins := map[string]Pin{"0409OPIM2019": {Version: "16.92"}}
+	sets := []collateralSet{
+		{app: cdn.AppInfo{AppID: "0409OPIM2019", Version: "16.93"}},
+		{app: cdn.AppInfo{AppID: "0409MSWD2019", Version: "16.93"}},
+	}
+
+	sets, held := e.holdPinned(sets, "Production", pins, discardLogger)
+	if len(sets) != 1 || sets[0].app.AppID != "0409MSWD2019" || len(held) != 1 || held[0] != "0409OPIM2019" {
+		t.Fatalf("sets=%+v held=%v", sets, held)
+	}
+	if p := e.pins.status()["0409OPIM2019"].Pending; p != nil {
+		t.Errorf("status for unknown pin = %v", p)
+	}
+
+	applyPins(cacheDir, pins, discardLogger)
+	data, err := os.ReadFile(filepath.Join(cacheDir, "0409OPIM2019-chk.xml"))
+	if err != nil || string(data) != "old:0409OPIM2019-chk.xml" {
+		t.Errorf("root chk.xml = %q, %v; want the pinned version", data, err)
+	}
+}
+
+func TestPinAPI(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Sync.Channel = "Production"
+	cfg.Storage.CacheDir = t.TempDir()
+	cfg.Storage.StateDir = t.TempDir()
+	client, err := cdn.NewClient(cdn.Options{Apps: []cdn.AppDef{{AppID: "0409OPIM2019", AppName: "Outlook"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Engine{
+		cfg:      cfg,
+		channels: channelTargets(cfg),
+		client:   client,
+		log:      discardLogger,
+		pins:     loadPins(filepath.Join(cfg.Storage.StateDir, pinsFile), nil),
+
+		admin:       http.NewServeMux(),
+		adminTokens: map[string]string{testAdminToken: "alice"},
+	}
+	e.admin.HandleFunc("POST /apps/{id}/pin", e.handlePin)
+	e.admin.HandleFunc("DELETE /apps/{id}/pin", e.handleUnpin)
+	srv := httptest.NewServer(e.requireToken(e.admin))
+	defer srv.Close()
+
+	do := func(method, path, body string) int {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := do("POST", "/apps/0409XXXX01/pin", `{"version":"16.92"}`); code != http.StatusNotFound {
+		t.Errorf("unknown app: status %d, want 404", code)
+	}
+	if code := do("POST", "/apps/0409OPIM2019/pin", `{}`); code != http.StatusBadRequest {
+		t.Errorf("missing version: status %d, want 400", code)
+	}
+	if code := do("POST", "/apps/0409OPIM2019/pin", `{"version":"16.92"}`); code != http.StatusConflict {
+		t.Errorf("version without saved collaterals: status %d, want 409", code)
+	}
+
+	writeCollateral(t, filepath.Join(cfg.Storage.CacheDir, "collateral", "16.92"), "0409OPIM2019", "old")
+	writeCollateral(t, cfg.Storage.CacheDir, "0409OPIM2019", "new")
+	if code := do("POST", "/apps/0409opim2019/pin", `{"version":"16.92","reason":"crash on launch"}`); code != http.StatusOK {
+		t.Fatalf("pin: status %d, want 200", code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(cfg.Storage.CacheDir, "0409OPIM2019.cat")); string(data) != "old:0409OPIM2019.cat" {
+		t.Errorf("root cat = %q, want the pinned version immediately", data)
+	}
+	if p := e.pins.all()["0409OPIM2019"]; p.Version != "16.92" || p.Reason != "crash on launch" || p.By != "alice" {
+		t.Errorf("stored pin = %+v", p)
+	}
+
+	if code := do("DELETE", "/apps/0409OPIM2019/pin", ""); code != http.StatusOK {
+		t.Errorf("unpin: status %d, want 200", code)
+	}
+	if len(e.pins.all()) != 0 {
+		t.Errorf("pins after unpin = %+v", e.pins.all())
+	}
+}
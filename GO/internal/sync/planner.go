@@ -5,7 +5,6 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 
@@ -19,90 +18,144 @@ type DownloadJob struct {
 	Payload      string // 文件名
 	SizeBytes    int64
 	LastMod      time.Time
+	ETag         string // HEAD 返回的 ETag，用于断点续传的 If-Range
 	NeedDownload bool
-}
 
-// delta 包匹配模式：xxx_16.90.24121212_to_16.93.25011212_xxx.pkg
-// 对应 Get-MAUCacheDownloadJobs.ps1 第 52 行: $pattern = '.*?([\d.]+)_to_([\d.]+).*'
-var deltaPattern = regexp.MustCompile(`([\d.]+)_to_([\d.]+)`)
+	// Package 清单中该包的元数据（大小、哈希、类型等）
+	Package cdn.Package
+
+	// linked 从其他频道硬链接过来时该文件的缓存清单记录（见 linkShared），下载阶段写入本频道的清单
+	linked *inventoryEntry
+}
 
 // PlanDownloads 生成下载计划
 // 对应 Get-MAUCacheDownloadJobs.ps1 + Invoke-MAUCacheDownload.ps1 的缓存验证部分
-func PlanDownloads(ctx context.Context, client *cdn.Client, apps []cdn.AppInfo, builds []string, cacheDir string, log *slog.Logger) ([]DownloadJob, error) {
+// keep 为各应用要镜像的历史版本数（AppID → N，见 keepVersions），这些版本的包同样按 builds 过滤增量包
+func PlanDownloads(ctx context.Context, client *cdn.Client, apps []cdn.AppInfo, builds []string, keep map[string]int, cacheDir string, log *slog.Logger) ([]DownloadJob, error) {
 	buildSet := make(map[string]bool)
 	for _, b := range builds {
 		buildSet[b] = true
 	}
 
 	var allJobs []DownloadJob
-
-	for _, app := range apps {
-		// 收集当前版本的包 URI
+	// 不同语言（以及部分不同应用、不同版本）的清单引用同一个安装包，只计划一次
+	planned := make(map[string]bool)
+	plan := func(app cdn.AppInfo, pkgs []cdn.Package) int {
+		// 收集包（按 URL 去重）
 		// 对应 Get-MAUCacheDownloadJobs.ps1 第 34 行
-		uris := uniqueStrings(app.PackageURIs)
-
-		// 用 builds.txt 过滤 delta 包
-		// 对应 Get-MAUCacheDownloadJobs.ps1 第 50-57 行
-		var filtered []string
-		for _, u := range uris {
-			matches := deltaPattern.FindStringSubmatch(u)
-			if matches == nil {
-				// 不是 delta 包，保留
-				filtered = append(filtered, u)
-			} else {
-				// 是 delta 包，只保留 from_version 在 builds.txt 中的
-				fromVer := matches[1]
-				if buildSet[fromVer] {
-					filtered = append(filtered, u)
-				}
+		filtered := filterDeltas(uniquePackages(pkgs), buildSet)
+		for _, pkg := range filtered {
+			if planned[pkg.Location] {
+				log.Debug("安装包已由其他应用计划，跳过", "app", app.AppName, "file", filepath.Base(pkg.Location))
+				continue
+			}
+			planned[pkg.Location] = true
+			if job, ok := planPackage(ctx, client, app, pkg, cacheDir, log); ok {
+				allJobs = append(allJobs, job)
 			}
 		}
+		return len(filtered)
+	}
 
-		// 对每个 URI 发 HEAD 请求 + 比对本地缓存
-		for _, uri := range filtered {
-			payload := filepath.Base(uri)
+	for _, app := range apps {
+		count := plan(app, app.Packages)
+		history := app.RecentHistory(keep[app.AppID])
+		for _, ver := range history {
+			count += plan(app, app.HistoricPackages[ver])
+		}
+		log.Info("计划完成", "app", app.AppName, "version", app.Version, "historic", history, "packages", count)
+	}
 
-			// HEAD 请求获取元信息
-			// 对应 Get-MAUCacheDownloadJobs.ps1 第 68-72 行
-			size, lastMod, err := client.Head(ctx, uri)
-			if err != nil {
-				log.Warn("HEAD 请求失败，跳过此文件", "app", app.AppName, "file", payload, "uri", uri, "error", err)
-				continue
-			}
+	return allJobs, nil
+}
 
-			job := DownloadJob{
-				AppName:     app.AppName,
-				LocationURI: uri,
-				Payload:     payload,
-				SizeBytes:   size,
-				LastMod:     lastMod,
-			}
+// filterDeltas 用 builds.txt 过滤 delta 包
+// 对应 Get-MAUCacheDownloadJobs.ps1 第 50-57 行
+// 不是 delta 包（没有起始版本）保留；delta 包只保留 from_version 在 builds.txt 中的
+func filterDeltas(pkgs []cdn.Package, buildSet map[string]bool) []cdn.Package {
+	var filtered []cdn.Package
+	for _, p := range pkgs {
+		if p.FromVersion == "" || buildSet[p.FromVersion] {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
 
-			// 缓存验证：文件存在 + 大小匹配
-			// 对应 Invoke-MAUCacheDownload.ps1 第 71-86 行
-			localPath := filepath.Join(cacheDir, payload)
-			fi, err := os.Stat(localPath)
-			if err != nil {
-				job.NeedDownload = true
-				log.Debug("本地缓存不存在，需要下载", "file", payload)
-			} else if fi.Size() != size {
-				job.NeedDownload = true
-				log.Debug("本地缓存大小不匹配，需要重新下载",
-					"file", payload,
-					"local_size", fi.Size(),
-					"remote_size", size,
-				)
-			} else {
-				log.Debug("本地缓存有效", "file", payload, "size", size)
-			}
+// planPackage 为单个包生成下载任务，返回 false 表示无法确定远端信息，跳过此文件
+// 清单给出了大小且本地文件大小一致时直接认为缓存有效，不再发 HEAD 请求；
+// HEAD 失败但清单给出了大小时按清单大小下载
+func planPackage(ctx context.Context, client *cdn.Client, app cdn.AppInfo, pkg cdn.Package, cacheDir string, log *slog.Logger) (DownloadJob, bool) {
+	uri := pkg.Location
+	payload := filepath.Base(uri)
+	job := DownloadJob{
+		AppName:     app.AppName,
+		LocationURI: uri,
+		Payload:     payload,
+		SizeBytes:   pkg.Size,
+		Package:     pkg,
+	}
 
-			allJobs = append(allJobs, job)
-		}
+	// 缓存验证：文件存在 + 大小匹配
+	// 对应 Invoke-MAUCacheDownload.ps1 第 71-86 行
+	localPath := filepath.Join(cacheDir, payload)
+	fi, statErr := os.Stat(localPath)
+	if statErr == nil && pkg.Size > 0 && fi.Size() == pkg.Size {
+		log.Debug("本地缓存有效（清单大小）", "file", payload, "size", pkg.Size)
+		return job, true
+	}
 
-		log.Info("计划完成", "app", app.AppName, "version", app.Version, "packages", len(filtered))
+	// HEAD 请求获取元信息
+	// 对应 Get-MAUCacheDownloadJobs.ps1 第 68-72 行
+	remote, err := client.Head(ctx, uri)
+	switch {
+	case err != nil && pkg.Size > 0:
+		log.Warn("HEAD 请求失败，按清单大小计划下载", "app", app.AppName, "file", payload, "uri", uri, "error", err)
+	case err != nil:
+		log.Warn("HEAD 请求失败，跳过此文件", "app", app.AppName, "file", payload, "uri", uri, "error", err)
+		return job, false
+	default:
+		if pkg.Size > 0 && remote.Size != pkg.Size {
+			log.Warn("远端文件大小与清单不一致，以远端为准",
+				"file", payload,
+				"manifest_size", pkg.Size,
+				"remote_size", remote.Size,
+			)
+		}
+		job.SizeBytes = remote.Size
+		job.LastMod = remote.LastMod
+		job.ETag = remote.ETag
 	}
+	size := job.SizeBytes
+
+	if statErr != nil {
+		job.NeedDownload = true
+		log.Debug("本地缓存不存在，需要下载", "file", payload)
+	} else if fi.Size() != size {
+		job.NeedDownload = true
+		log.Debug("本地缓存大小不匹配，需要重新下载",
+			"file", payload,
+			"local_size", fi.Size(),
+			"remote_size", size,
+		)
+	} else {
+		log.Debug("本地缓存有效", "file", payload, "size", size)
+	}
+	return job, true
+}
 
-	return allJobs, nil
+// uniquePackages 按下载 URL 去重，保持清单顺序
+func uniquePackages(pkgs []cdn.Package) []cdn.Package {
+	seen := make(map[string]bool)
+	var out []cdn.Package
+	for _, p := range pkgs {
+		p.Location = strings.TrimSpace(p.Location)
+		if p.Location != "" && !seen[p.Location] {
+			seen[p.Location] = true
+			out = append(out, p)
+		}
+	}
+	return out
 }
 
 // uniqueStrings 返回去重后的字符串切片
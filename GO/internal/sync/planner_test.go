@@ -1,7 +1,18 @@
 package sync
 
 import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
 )
 
 func TestUniqueStrings(t *testing.T) {
@@ -65,7 +76,7 @@ func TestDeltaPatternMatching(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.uri, func(t *testing.T) {
-			matches := deltaPattern.FindStringSubmatch(tt.uri)
+			matches := cdn.DeltaPattern.FindStringSubmatch(tt.uri)
 			if tt.match {
 				if matches == nil {
 					t.Fatalf("expected match for %q", tt.uri)
@@ -100,7 +111,7 @@ func TestDeltaFilteringWithBuilds(t *testing.T) {
 
 	var filtered []string
 	for _, u := range uris {
-		matches := deltaPattern.FindStringSubmatch(u)
+		matches := cdn.DeltaPattern.FindStringSubmatch(u)
 		if matches == nil {
 			filtered = append(filtered, u)
 		} else {
@@ -134,7 +145,7 @@ func TestNonDeltaAlwaysKept(t *testing.T) {
 
 	var filtered []string
 	for _, u := range uris {
-		matches := deltaPattern.FindStringSubmatch(u)
+		matches := cdn.DeltaPattern.FindStringSubmatch(u)
 		if matches == nil {
 			filtered = append(filtered, u)
 		} else {
@@ -149,3 +160,117 @@ func TestNonDeltaAlwaysKept(t *testing.T) {
 		t.Errorf("filtered = %d, want %d: non-delta packages should always be kept", len(filtered), len(uris))
 	}
 }
+
+func TestPlanPackageUsesManifestSize(t *testing.T) {
+	var heads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		heads.Add(1)
+		w.Header().Set("Content-Length", "5")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cached.pkg"), []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t)
+	app := cdn.AppInfo{AppName: "Word"}
+
+	// Local file matches the manifest size: no HEAD request needed.
+	job, ok := planPackage(context.Background(), client, app,
+		cdn.Package{Location: srv.URL + "/cached.pkg", Size: 5}, dir, discardLogger)
+	if !ok || job.NeedDownload || job.SizeBytes != 5 {
+		t.Errorf("cached job = %+v, ok=%v", job, ok)
+	}
+	if heads.Load() != 0 {
+		t.Errorf("HEAD sent %d times for a file matching the manifest size", heads.Load())
+	}
+
+	// Missing file: HEAD supplies the validators, the manifest metadata travels with the job.
+	job, ok = planPackage(context.Background(), client, app,
+		cdn.Package{Location: srv.URL + "/new.pkg", Size: 5, Kind: cdn.PackageFull}, dir, discardLogger)
+	if !ok || !job.NeedDownload || job.Package.Kind != cdn.PackageFull {
+		t.Errorf("new job = %+v, ok=%v", job, ok)
+	}
+	if heads.Load() != 1 {
+		t.Errorf("HEAD sent %d times, want 1", heads.Load())
+	}
+}
+
+func TestPlanDownloadsDedupesPackagesAcrossLocales(t *testing.T) {
+	var heads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		heads.Add(1)
+		w.Header().Set("Content-Length", "5")
+	}))
+	defer srv.Close()
+
+	shared := cdn.Package{Location: srv.URL + "/Word_Installer.pkg"}
+	apps := []cdn.AppInfo{
+		{AppID: "0409MSWD2019", AppName: "Word", Packages: []cdn.Package{shared}},
+		{AppID: "0407MSWD2019", AppName: "Word (0407)", Packages: []cdn.Package{shared, {Location: srv.URL + "/Word_de.pkg"}}},
+	}
+	jobs, err := PlanDownloads(context.Background(), newTestClient(t), apps, nil, nil, t.TempDir(), discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].Payload != "Word_Installer.pkg" || jobs[1].Payload != "Word_de.pkg" {
+		t.Errorf("jobs = %+v, want the shared package planned once", jobs)
+	}
+	if heads.Load() != 2 {
+		t.Errorf("HEAD sent %d times, want 2", heads.Load())
+	}
+}
+
+func TestPlanDownloadsIncludesKeptHistoricVersions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5")
+	}))
+	defer srv.Close()
+
+	pkg := func(name, from string) cdn.Package {
+		return cdn.Package{Location: srv.URL + "/" + name, FromVersion: from}
+	}
+	app := cdn.AppInfo{
+		AppID:    "0409MSWD2019",
+		AppName:  "Word",
+		Version:  "16.93",
+		Packages: []cdn.Package{pkg("Word_16.93.pkg", ""), pkg("Word_16.92_to_16.93.pkg", "16.92")},
+		HistoricPackages: map[string][]cdn.Package{
+			"16.92": {pkg("Word_16.92.pkg", ""), pkg("Word_16.91_to_16.92.pkg", "16.91"), pkg("Word_16.80_to_16.92.pkg", "16.80")},
+			"16.91": {pkg("Word_16.91.pkg", ""), pkg("Word_16.92_to_16.93.pkg", "16.92")},
+			"16.90": {pkg("Word_16.90.pkg", "")},
+		},
+	}
+	builds := []string{"16.91", "16.92"}
+
+	jobs, err := PlanDownloads(context.Background(), newTestClient(t), []cdn.AppInfo{app}, builds, map[string]int{"0409MSWD2019": 2}, t.TempDir(), discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, j := range jobs {
+		got = append(got, j.Payload)
+	}
+	want := []string{"Word_16.93.pkg", "Word_16.92_to_16.93.pkg", "Word_16.92.pkg", "Word_16.91_to_16.92.pkg", "Word_16.91.pkg"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("jobs = %v, want %v (delta filter applied, 16.90 beyond retention)", got, want)
+	}
+
+	jobs, _ = PlanDownloads(context.Background(), newTestClient(t), []cdn.AppInfo{app}, builds, nil, t.TempDir(), discardLogger)
+	if len(jobs) != 2 {
+		t.Errorf("without retention: %d jobs, want only the current version's 2", len(jobs))
+	}
+}
+
+func TestKeepVersions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Sync.KeepVersions = 1
+	cfg.Apps.KeepVersions = map[string]int{"0409MSWD2019": 3, "0407MSWD2019": 0, "0409XCEL2019": 2}
+	apps := []cdn.AppInfo{{AppID: "0409MSWD2019"}, {AppID: "0407MSWD2019"}, {AppID: "040CXCEL2019"}, {AppID: "0409PPT32019"}}
+	got := keepVersions(cfg, apps)
+	want := map[string]int{"0409MSWD2019": 3, "040CXCEL2019": 2, "0409PPT32019": 1}
+	if !maps.Equal(got, want) {
+		t.Errorf("keepVersions = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"maucache/internal/cdn"
+)
+
+// resumeSuffix 断点续传元数据文件后缀，与 scratch 中的部分文件放在一起
+// 例如 .tmp/Microsoft_Word_16.93_Updater.pkg.resume
+const resumeSuffix = ".resume"
+
+// resumeState 记录部分文件开始下载时远端文件的校验器
+// 进程重启后据此判断部分文件是否还能续传：远端文件变了就必须从头下载，
+// 否则会把新文件的后半段拼到旧文件的前半段上
+type resumeState struct {
+	URL     string    `json:"url"`
+	Size    int64     `json:"size"`
+	ETag    string    `json:"etag,omitempty"`
+	LastMod time.Time `json:"last_modified,omitempty"`
+
+	// 分段下载时的区间划分和每段完成情况；单连接下载时为空
+	Segments     []cdn.Segment `json:"segments,omitempty"`
+	SegmentsDone []bool        `json:"segments_done,omitempty"`
+}
+
+// newResumeState 从下载任务构建续传状态
+func newResumeState(job DownloadJob) resumeState {
+	return resumeState{
+		URL:     job.LocationURI,
+		Size:    job.SizeBytes,
+		ETag:    job.ETag,
+		LastMod: job.LastMod,
+	}
+}
+
+// matches 判断两个续传状态是否指向同一个远端文件版本，且下载方式（分段划分）一致
+func (s resumeState) matches(o resumeState) bool {
+	if s.URL != o.URL || s.Size != o.Size || s.ETag != o.ETag || !s.LastMod.Equal(o.LastMod) {
+		return false
+	}
+	if len(s.Segments) != len(o.Segments) {
+		return false
+	}
+	for i := range s.Segments {
+		if s.Segments[i] != o.Segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ifRange 返回 If-Range 头的值：优先强 ETag，其次 Last-Modified
+// 弱 ETag（W/ 开头）不能用于 If-Range；两者都没有时返回 ""，表示无法安全续传
+func (s resumeState) ifRange() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	if !s.LastMod.IsZero() {
+		return s.LastMod.UTC().Format(http.TimeFormat)
+	}
+	return ""
+}
+
+// loadResumeState 读取部分文件对应的续传状态，不存在或损坏时返回 false
+func loadResumeState(scratchPath string) (resumeState, bool) {
+	data, err := os.ReadFile(scratchPath + resumeSuffix)
+	if err != nil {
+		return resumeState{}, false
+	}
+	var s resumeState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return resumeState{}, false
+	}
+	return s, true
+}
+
+// saveResumeState 写入续传状态
+func saveResumeState(scratchPath string, s resumeState) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(scratchPath+resumeSuffix, data, 0640)
+}
+
+// removeResumeState 删除续传状态（下载完成或放弃续传时调用）
+func removeResumeState(scratchPath string) {
+	os.Remove(scratchPath + resumeSuffix)
+}
+
+// resumeOffset 计算部分文件可以续传的起点
+// 只有续传状态与本次任务一致、且存在可用的 If-Range 校验器时才续传，否则返回 0
+func resumeOffset(scratchPath string, want resumeState) int64 {
+	if want.ifRange() == "" {
+		return 0
+	}
+	saved, ok := loadResumeState(scratchPath)
+	if !ok || !saved.matches(want) {
+		return 0
+	}
+	fi, err := os.Stat(scratchPath)
+	if err != nil {
+		return 0
+	}
+	if want.Size > 0 && fi.Size() > want.Size {
+		return 0
+	}
+	return fi.Size()
+}
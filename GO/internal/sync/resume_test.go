@@ -0,0 +1,230 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"maucache/internal/cdn"
+)
+
+func newTestClient(t *testing.T) *cdn.Client {
+	t.Helper()
+	c, err := cdn.NewClient(cdn.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestResumeStateIfRange(t *testing.T) {
+	mod := time.Date(2025, 1, 12, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		state resumeState
+		want  string
+	}{
+		{"strong etag", resumeState{ETag: `"abc"`, LastMod: mod}, `"abc"`},
+		{"weak etag falls back to date", resumeState{ETag: `W/"abc"`, LastMod: mod}, "Sun, 12 Jan 2025 08:00:00 GMT"},
+		{"no validator", resumeState{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.ifRange(); got != tt.want {
+				t.Errorf("ifRange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumeOffset(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.pkg")
+	want := resumeState{URL: "https://cdn/a.pkg", Size: 100, ETag: `"v1"`}
+
+	if got := resumeOffset(path, want); got != 0 {
+		t.Errorf("offset without partial file = %d, want 0", got)
+	}
+
+	if err := os.WriteFile(path, make([]byte, 40), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if got := resumeOffset(path, want); got != 0 {
+		t.Errorf("offset without resume state = %d, want 0", got)
+	}
+
+	if err := saveResumeState(path, want); err != nil {
+		t.Fatal(err)
+	}
+	if got := resumeOffset(path, want); got != 40 {
+		t.Errorf("offset = %d, want 40", got)
+	}
+
+	changed := want
+	changed.ETag = `"v2"`
+	if got := resumeOffset(path, changed); got != 0 {
+		t.Errorf("offset after remote change = %d, want 0", got)
+	}
+}
+
+func TestCleanScratchKeepsPlannedPartials(t *testing.T) {
+	scratch := filepath.Join(t.TempDir(), "scratch")
+	os.MkdirAll(filepath.Join(scratch, "leftover"), 0750)
+
+	files := map[string]bool{
+		"resumable.pkg":        true,
+		"resumable.pkg.resume": true,
+		"finished.pkg":         false, // no longer in the plan
+		"finished.pkg.resume":  false,
+		"orphan.pkg":           false,
+		"stale.pkg.resume":     false,
+	}
+	for name := range files {
+		if err := os.WriteFile(filepath.Join(scratch, name), []byte("x"), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	planned := map[string]bool{"resumable.pkg": true, "orphan.pkg": true, "stale.pkg": true}
+	cleanScratch(scratch, planned, discardLogger)
+
+	for name, keep := range files {
+		_, err := os.Stat(filepath.Join(scratch, name))
+		if keep && err != nil {
+			t.Errorf("%q should have been kept", name)
+		}
+		if !keep && err == nil {
+			t.Errorf("%q should have been removed", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(scratch, "leftover")); !os.IsNotExist(err) {
+		t.Error("leftover directories should be removed")
+	}
+}
+
+func TestCleanupDoesNotTouchScratch(t *testing.T) {
+	dir := t.TempDir()
+	Cleanup(dir, discardLogger)
+	if _, err := os.Stat(filepath.Join(dir, ".tmp")); !os.IsNotExist(err) {
+		t.Error("Cleanup should not create a scratch directory under the cache directory")
+	}
+}
+
+func TestDoDownloadResumesPartialFile(t *testing.T) {
+	payload := bytes.Repeat([]byte("maucache"), 8192)
+	modTime := time.Date(2025, 1, 12, 8, 0, 0, 0, time.UTC)
+	var gotRange string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "a.pkg", modTime, bytes.NewReader(payload))
+	}))
+	defer srv.Close()
+
+	scratch := filepath.Join(t.TempDir(), "a.pkg")
+	job := DownloadJob{
+		AppName:     "Test",
+		LocationURI: srv.URL + "/a.pkg",
+		Payload:     "a.pkg",
+		SizeBytes:   int64(len(payload)),
+		LastMod:     modTime,
+		ETag:        `"v1"`,
+	}
+
+	// Simulate a previous run that stopped half way
+	if err := os.WriteFile(scratch, payload[:20000], 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveResumeState(scratch, newResumeState(job)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := doDownload(context.Background(), newTestClient(t), job, scratch, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+	if gotRange != "bytes=20000-" {
+		t.Errorf("Range = %q, want %q", gotRange, "bytes=20000-")
+	}
+	data, err := os.ReadFile(scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Error("resumed file does not match payload")
+	}
+	if _, err := os.Stat(scratch + resumeSuffix); err == nil {
+		t.Error("resume state should be removed after a completed download")
+	}
+}
+
+func TestSegmentedDownloadSkipsFinishedSegments(t *testing.T) {
+	payload := bytes.Repeat([]byte("segment!"), 16384) // 128KB
+	modTime := time.Date(2025, 1, 12, 8, 0, 0, 0, time.UTC)
+	var ranges []string
+	var mu gosync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "big.pkg", modTime, bytes.NewReader(payload))
+	}))
+	defer srv.Close()
+
+	scratch := filepath.Join(t.TempDir(), "big.pkg")
+	job := DownloadJob{
+		AppName:     "Test",
+		LocationURI: srv.URL + "/big.pkg",
+		Payload:     "big.pkg",
+		SizeBytes:   int64(len(payload)),
+		LastMod:     modTime,
+		ETag:        `"v1"`,
+	}
+
+	// Simulate a previous run that finished the first two of four segments
+	state := newResumeState(job)
+	state.Segments = cdn.SplitSegments(job.SizeBytes, 4)
+	state.SegmentsDone = []bool{true, true, false, false}
+	partial := make([]byte, len(payload))
+	copy(partial, payload[:state.Segments[2].Start])
+	if err := os.WriteFile(scratch, partial, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveResumeState(scratch, state); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := doSegmentedDownload(context.Background(), newTestClient(t), job, scratch, 4, discardLogger); err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges) != 2 {
+		t.Errorf("requested %d segments (%v), want 2", len(ranges), ranges)
+	}
+	data, err := os.ReadFile(scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Error("segmented file does not match payload")
+	}
+}
+
+func TestUseSegments(t *testing.T) {
+	opts := downloadOptions{segments: 4, segmentThreshold: 100}
+	if !opts.useSegments(DownloadJob{SizeBytes: 100}) {
+		t.Error("file at threshold should be segmented")
+	}
+	if opts.useSegments(DownloadJob{SizeBytes: 99}) {
+		t.Error("file below threshold should not be segmented")
+	}
+	opts.segments = 1
+	if opts.useSegments(DownloadJob{SizeBytes: 1000}) {
+		t.Error("segments=1 disables segmented download")
+	}
+}
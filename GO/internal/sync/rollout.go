@@ -0,0 +1,294 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"maucache/internal/config"
+)
+
+// releasesFile 频道发布历史在该频道 StateDir 中的文件名
+const releasesFile = "releases.json"
+
+// release 某个版本的编录在根目录发布的时间
+type release struct {
+	Version     string    `json:"version"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// releaseHistory 一个频道各应用的发布历史，按发布时间排序，分批发布据此计算各环的版本
+// 只记录实际对客户端提供过的版本（固定中或等待审批的版本不记录）
+type releaseHistory struct {
+	mu   gosync.Mutex
+	path string
+	Apps map[string][]release `json:"apps"`
+}
+
+// loadReleases 读取发布历史，不存在或损坏时从空开始
+func loadReleases(path string) *releaseHistory {
+	h := &releaseHistory{path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, h)
+	}
+	if h.Apps == nil {
+		h.Apps = make(map[string][]release)
+	}
+	return h
+}
+
+// record 记录版本发布；已记录过的版本保留首次发布时间
+func (h *releaseHistory) record(appID, version string, at time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if slices.ContainsFunc(h.Apps[appID], func(r release) bool { return r.Version == version }) {
+		return nil
+	}
+	h.Apps[appID] = append(h.Apps[appID], release{Version: version, PublishedAt: at.UTC()})
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0750); err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// versionFor 返回延迟 delay 的环在 now 时刻应得的版本：发布已满 delay 的最新版本；
+// 都未满时为最早记录的版本。latest 是最近发布的版本，没有历史时 ok 为 false
+func (h *releaseHistory) versionFor(appID string, delay time.Duration, now time.Time) (version, latest string, ok bool) {
+	if h == nil {
+		return "", "", false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	releases := h.Apps[appID]
+	if len(releases) == 0 {
+		return "", "", false
+	}
+	version = releases[0].Version
+	for _, r := range releases {
+		if !r.PublishedAt.Add(delay).After(now) {
+			version = r.Version
+		}
+	}
+	return version, releases[len(releases)-1].Version, true
+}
+
+// recordReleases 记录一个频道本次发布到根目录的版本
+func (e *Engine) recordReleases(channel string, sets []collateralSet, at time.Time) {
+	h := e.releases[channel]
+	if h == nil {
+		return
+	}
+	for _, set := range sets {
+		if err := h.record(set.app.AppID, set.app.Version, at); err != nil {
+			e.log.Warn("保存发布历史失败", "channel", channel, "error", err)
+			return
+		}
+	}
+}
+
+// ringVersion 返回环在频道中应得的应用版本；空字符串表示提供根目录的当前编录
+// 全局固定（apps.pins / 管理接口）优先于环的设置；环的固定优先于延迟
+func (e *Engine) ringVersion(channel string, ring *config.RolloutRing, appID string, now time.Time) string {
+	if ring == nil {
+		return ""
+	}
+	if _, pinned := e.pins.all()[appID]; pinned {
+		return ""
+	}
+	if v, ok := ring.Pins[appID]; ok {
+		return v
+	}
+	version, latest, ok := e.releases[channel].versionFor(appID, ring.Delay, now)
+	if !ok || version == latest {
+		return ""
+	}
+	return version
+}
+
+// collateralApp 由文件名识别按环提供的编录：{AppID}.xml / {AppID}-chk.xml / {AppID}.cat
+func (e *Engine) collateralApp(name string) (string, bool) {
+	var id string
+	switch {
+	case strings.HasSuffix(name, "-chk.xml"):
+		id = strings.TrimSuffix(name, "-chk.xml")
+	case strings.HasSuffix(name, ".xml"):
+		id = strings.TrimSuffix(name, ".xml")
+	case strings.HasSuffix(name, ".cat"):
+		id = strings.TrimSuffix(name, ".cat")
+	default:
+		return "", false
+	}
+	for _, def := range e.client.Apps() {
+		if def.AppID == id {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// clientAddr 请求的客户端地址；来自可信反向代理时取 X-Forwarded-For 中最右边的不可信地址
+func (e *Engine) clientAddr(r *http.Request) netip.Addr {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr := ap.Addr().Unmap()
+	if !e.cfg.Rollout.Trusted(addr) {
+		return addr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !e.cfg.Rollout.Trusted(addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// serveRollout 提供缓存目录：编录按客户端所在的发布环取自 collateral/{版本号}/，其他文件原样提供
+// 路径与缓存目录一致，extra_channels 中的频道在 /{频道名}/ 下；以 . 开头的目录（.state / .tmp 等）不提供
+func (e *Engine) serveRollout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	for _, seg := range strings.Split(rel, "/") {
+		if strings.HasPrefix(seg, ".") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	ch := e.channels[0]
+	for _, t := range e.channels[1:] {
+		if rest, ok := strings.CutPrefix(rel, t.name+"/"); ok {
+			ch, rel = t, rest
+			break
+		}
+	}
+
+	file := filepath.Join(ch.cfg.Storage.CacheDir, filepath.FromSlash(rel))
+	if appID, ok := e.collateralApp(rel); ok {
+		addr := e.clientAddr(r)
+		ring := e.cfg.Rollout.Ring(addr)
+		if version := e.ringVersion(ch.name, ring, appID, time.Now()); version != "" {
+			file = filepath.Join(ch.cfg.Storage.CacheDir, "collateral", version, rel)
+			// 环应得的版本没有保存编录时不回退到最新版本，避免该环提前拿到新版本
+			if _, err := os.Stat(file); err != nil {
+				e.log.Warn("发布环应得版本的编录不存在", "ring", ring.Name, "client", addr, "channel", ch.name, "file", rel, "version", version)
+				http.NotFound(w, r)
+				return
+			}
+		}
+	}
+	fi, err := os.Stat(file)
+	if err != nil || !fi.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, file)
+}
+
+// ringStatus 一个发布环的配置和各频道中应用的当前版本
+type ringStatus struct {
+	Name     string                       `json:"name"`
+	CIDRs    []string                     `json:"cidrs"`
+	Delay    string                       `json:"delay"`
+	Pins     map[string]string            `json:"pins,omitempty"`
+	Versions map[string]map[string]string `json:"versions"` // 频道 → AppID → 版本号
+}
+
+// ringStatus 计算环在各频道中提供的应用版本；ring 为 nil 表示不属于任何环的客户端
+func (e *Engine) ringStatus(ring *config.RolloutRing, now time.Time) ringStatus {
+	st := ringStatus{Name: "default", Delay: "0s", Versions: make(map[string]map[string]string)}
+	if ring != nil {
+		st = ringStatus{Name: ring.Name, CIDRs: ring.CIDRs, Delay: ring.Delay.String(), Pins: ring.Pins, Versions: st.Versions}
+	}
+	pins := e.pins.all()
+	for _, ch := range e.channels {
+		versions := make(map[string]string)
+		for _, def := range e.client.Apps() {
+			v := e.ringVersion(ch.name, ring, def.AppID, now)
+			switch {
+			case v != "":
+			case pins[def.AppID].Version != "":
+				v = pins[def.AppID].Version
+			default:
+				_, v, _ = e.releases[ch.name].versionFor(def.AppID, 0, now)
+			}
+			if v != "" {
+				versions[def.AppID] = v
+			}
+		}
+		st.Versions[ch.name] = versions
+	}
+	return st
+}
+
+// rolloutStatus /sync/status 中的 rollout：各发布环（最后是不属于任何环的客户端）
+func (e *Engine) rolloutStatus() []ringStatus {
+	now := time.Now()
+	out := make([]ringStatus, 0, len(e.cfg.Rollout.Rings)+1)
+	for i := range e.cfg.Rollout.Rings {
+		out = append(out, e.ringStatus(&e.cfg.Rollout.Rings[i], now))
+	}
+	return append(out, e.ringStatus(nil, now))
+}
+
+// handleRollout GET /rollout?ip=地址：查询客户端所在的发布环和各应用的版本；不带 ip 时返回所有环
+func (e *Engine) handleRollout(w http.ResponseWriter, r *http.Request) {
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		writeJSON(w, http.StatusOK, e.rolloutStatus())
+		return
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, errors.New("ip 参数不是有效的地址"))
+		return
+	}
+	writeJSON(w, http.StatusOK, e.ringStatus(e.cfg.Rollout.Ring(addr), time.Now()))
+}
+
+// ServeRollout 启动编录服务（rollout.listen），直到 ctx 取消
+func (e *Engine) ServeRollout(ctx context.Context) {
+	srv := &http.Server{
+		Addr:              e.cfg.Rollout.Listen,
+		Handler:           http.HandlerFunc(e.serveRollout),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	e.log.Info("编录服务启动", "addr", e.cfg.Rollout.Listen, "rings", len(e.cfg.Rollout.Rings))
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		e.log.Error("编录服务异常退出", "error", err)
+	}
+}
@@ -0,0 +1,124 @@
+package sync
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+)
+
+func TestReleaseHistoryVersionFor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), releasesFile)
+	h := loadReleases(path)
+	week := 7 * 24 * time.Hour
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+	h.record("0409MSWD2019", "16.92", now.Add(-30*24*time.Hour))
+	h.record("0409MSWD2019", "16.93", now.Add(-2*24*time.Hour))
+	h.record("0409MSWD2019", "16.92", now) // republishing keeps the first publish time
+
+	h = loadReleases(path)
+	if v, latest, _ := h.versionFor("0409MSWD2019", 0, now); v != "16.93" || latest != "16.93" {
+		t.Errorf("no delay: %s (latest %s), want 16.93", v, latest)
+	}
+	if v, _, _ := h.versionFor("0409MSWD2019", week, now); v != "16.92" {
+		t.Errorf("one week delay: %s, want 16.92", v)
+	}
+	if v, _, _ := h.versionFor("0409MSWD2019", week, now.Add(week)); v != "16.93" {
+		t.Errorf("one week later: %s, want 16.93", v)
+	}
+	if v, _, _ := h.versionFor("0409MSWD2019", 365*24*time.Hour, now); v != "16.92" {
+		t.Errorf("nothing old enough: %s, want the earliest known version", v)
+	}
+	if _, _, ok := h.versionFor("0409XCEL2019", 0, now); ok {
+		t.Error("app without history should report ok=false")
+	}
+}
+
+func TestServeRolloutByClientAddress(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Sync.Channel = "Production"
+	cfg.Sync.ExtraChannels = []string{"Preview"}
+	cfg.Storage.CacheDir = t.TempDir()
+	cfg.Storage.StateDir = t.TempDir()
+	cfg.Rollout = config.RolloutConfig{
+		Listen:         ":0",
+		TrustedProxies: []string{"10.0.0.1/32"},
+		Rings: []config.RolloutRing{
+			{Name: "pilot", CIDRs: []string{"10.1.0.0/24"}},
+			{Name: "frozen", CIDRs: []string{"10.3.0.0/24"}, Pins: map[string]string{"0409MSWD2019": "16.91"}},
+			{Name: "broad", CIDRs: []string{"10.0.0.0/8"}, Delay: 7 * 24 * time.Hour},
+		},
+	}
+	client, err := cdn.NewClient(cdn.Options{Apps: []cdn.AppDef{{AppID: "0409MSWD2019", AppName: "Word"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Engine{
+		cfg:      cfg,
+		channels: channelTargets(cfg),
+		client:   client,
+		log:      discardLogger,
+		pins:     loadPins(filepath.Join(cfg.Storage.StateDir, pinsFile), nil),
+		releases: map[string]*releaseHistory{},
+	}
+	for _, ch := range e.channels {
+		e.releases[ch.name] = loadReleases(filepath.Join(ch.cfg.Storage.StateDir, releasesFile))
+	}
+
+	root := cfg.Storage.CacheDir
+	writeCollateral(t, root, "0409MSWD2019", "16.93")
+	writeCollateral(t, filepath.Join(root, "collateral", "16.92"), "0409MSWD2019", "16.92")
+	writeCollateral(t, filepath.Join(root, "Preview"), "0409MSWD2019", "preview")
+	e.recordReleases("Production", []collateralSet{wordSet("16.92")}, time.Now().Add(-30*24*time.Hour))
+	e.recordReleases("Production", []collateralSet{wordSet("16.93")}, time.Now().Add(-time.Hour))
+
+	get := func(path, remote, xff string) (int, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remote
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		rec := httptest.NewRecorder()
+		e.serveRollout(rec, req)
+		body, _ := io.ReadAll(rec.Result().Body)
+		return rec.Code, string(body)
+	}
+
+	cases := []struct {
+		name, path, remote, xff string
+		code                    int
+		body                    string
+	}{
+		{"pilot gets the latest", "/0409MSWD2019-chk.xml", "10.1.0.5:5000", "", 200, "16.93:0409MSWD2019-chk.xml"},
+		{"broad ring waits a week", "/0409MSWD2019-chk.xml", "10.2.0.5:5000", "", 200, "16.92:0409MSWD2019-chk.xml"},
+		{"client outside all rings", "/0409MSWD2019.cat", "192.0.2.10:5000", "", 200, "16.93:0409MSWD2019.cat"},
+		{"address behind trusted proxy", "/0409MSWD2019.xml", "10.0.0.1:5000", "192.0.2.1, 10.2.0.7", 200, "16.92:0409MSWD2019.xml"},
+		{"forwarded header from untrusted peer ignored", "/0409MSWD2019.xml", "10.1.0.9:5000", "10.2.0.7", 200, "16.93:0409MSWD2019.xml"},
+		{"pinned version without saved collaterals", "/0409MSWD2019.xml", "10.3.0.2:5000", "", 404, ""},
+		{"extra channel without history serves its root", "/Preview/0409MSWD2019.xml", "10.2.0.5:5000", "", 200, "preview:0409MSWD2019.xml"},
+		{"state directory is not served", "/.state/pins.json", "10.1.0.5:5000", "", 404, ""},
+	}
+	for _, c := range cases {
+		code, body := get(c.path, c.remote, c.xff)
+		if code != c.code || (c.body != "" && body != c.body) {
+			t.Errorf("%s: %d %q, want %d %q", c.name, code, body, c.code, c.body)
+		}
+	}
+
+	status := e.ringStatus(cfg.Rollout.Ring(netip.MustParseAddr("10.2.0.5")), time.Now())
+	if status.Name != "broad" || status.Versions["Production"]["0409MSWD2019"] != "16.92" {
+		t.Errorf("broad ring status = %+v", status)
+	}
+	req := httptest.NewRequest("POST", "/0409MSWD2019.xml", nil)
+	rec := httptest.NewRecorder()
+	e.serveRollout(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: %d, want 405", rec.Code)
+	}
+}
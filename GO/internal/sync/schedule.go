@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"context"
+	"log/slog"
+	gosync "sync"
+	"time"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+)
+
+// scheduleCheckInterval 同步进行中重新评估时段调度的间隔
+var scheduleCheckInterval = time.Minute
+
+// throttle 上限可动态调整的并发闸门
+// errgroup.SetLimit 在 Go 调用后不能再修改，时段调度需要在同步中途改变并发数：
+// 调小时已在运行的下载不受影响，只是新的下载要等到活跃数降到新上限以下
+type throttle struct {
+	mu      gosync.Mutex
+	limit   int
+	active  int
+	changed chan struct{} // 每次 limit 或 active 变化时 close 并替换，唤醒等待者
+}
+
+// newThrottle 创建并发闸门，limit<1 按 1 处理
+func newThrottle(limit int) *throttle {
+	if limit < 1 {
+		limit = 1
+	}
+	return &throttle{limit: limit, changed: make(chan struct{})}
+}
+
+// acquire 占用一个并发名额，名额不足时阻塞
+func (t *throttle) acquire(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		if t.active < t.limit {
+			t.active++
+			t.mu.Unlock()
+			return nil
+		}
+		ch := t.changed
+		t.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// release 归还一个并发名额
+func (t *throttle) release() {
+	t.mu.Lock()
+	t.active--
+	t.broadcast()
+	t.mu.Unlock()
+}
+
+// setLimit 调整并发上限，limit<1 按 1 处理
+func (t *throttle) setLimit(limit int) {
+	if limit < 1 {
+		limit = 1
+	}
+	t.mu.Lock()
+	t.limit = limit
+	t.broadcast()
+	t.mu.Unlock()
+}
+
+// broadcast 唤醒所有等待者，调用方需持有锁
+func (t *throttle) broadcast() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// applyLimits 把 now 时刻的调度限制应用到限速器和并发闸门（gate 可为 nil）
+// 返回生效的限制，供调用方判断是否发生了切换
+func applyLimits(cfg *config.Config, limiter *cdn.RateLimiter, gate *throttle, now time.Time, log *slog.Logger) config.Limits {
+	limits := cfg.Sync.LimitsAt(now)
+	if limiter != nil {
+		bw, err := config.ParseBandwidth(limits.BandwidthLimit)
+		if err != nil {
+			// 启动时已校验，这里只做防御
+			log.Warn("时段调度带宽无效，忽略", "bandwidth_limit", limits.BandwidthLimit, "error", err)
+		} else {
+			limiter.SetRate(bw)
+		}
+	}
+	if gate != nil {
+		gate.setLimit(limits.Concurrency)
+	}
+	return limits
+}
+
+// watchSchedule 同步进行中定期重新评估时段调度，直到 ctx 结束
+// 未配置 schedule 时直接返回
+func watchSchedule(ctx context.Context, cfg *config.Config, limiter *cdn.RateLimiter, gate *throttle, current config.Limits, log *slog.Logger) {
+	if len(cfg.Sync.Schedule) == 0 {
+		return
+	}
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			next := applyLimits(cfg, limiter, gate, now, log)
+			if next != current {
+				log.Info("时段调度切换",
+					"window", next.Window,
+					"bandwidth_limit", next.BandwidthLimit,
+					"concurrency", next.Concurrency,
+				)
+				current = next
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"maucache/internal/cdn"
+	"maucache/internal/config"
+)
+
+func TestThrottleLimitsConcurrency(t *testing.T) {
+	gate := newThrottle(2)
+	ctx := context.Background()
+
+	if err := gate.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := gate.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var third atomic.Bool
+	go func() {
+		if gate.acquire(ctx) == nil {
+			third.Store(true)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if third.Load() {
+		t.Fatal("third acquire should block at limit 2")
+	}
+
+	gate.release()
+	time.Sleep(50 * time.Millisecond)
+	if !third.Load() {
+		t.Error("third acquire should proceed after release")
+	}
+}
+
+func TestThrottleSetLimitWakesWaiters(t *testing.T) {
+	gate := newThrottle(1)
+	ctx := context.Background()
+	_ = gate.acquire(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		_ = gate.acquire(ctx)
+		close(done)
+	}()
+
+	gate.setLimit(2)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("raising the limit should wake the waiter")
+	}
+}
+
+func TestThrottleAcquireHonoursContext(t *testing.T) {
+	gate := newThrottle(1)
+	_ = gate.acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := gate.acquire(ctx); err == nil {
+		t.Error("acquire should fail when the context expires")
+	}
+}
+
+func TestApplyLimitsSwitchesWindow(t *testing.T) {
+	cfg := &config.Config{Sync: config.SyncConfig{
+		Concurrency: 8,
+		Schedule: []config.ScheduleWindow{
+			{Start: "08:00", End: "18:00", BandwidthLimit: "1MB/s", Concurrency: 1},
+		},
+	}}
+	limiter := cdn.NewRateLimiter(0)
+	gate := newThrottle(8)
+
+	day := time.Date(2025, 1, 6, 9, 0, 0, 0, time.Local)
+	limits := applyLimits(cfg, limiter, gate, day, discardLogger)
+	if limits.Concurrency != 1 || limiter.Limit() != 1<<20 {
+		t.Errorf("daytime: limits=%+v limiter=%d", limits, limiter.Limit())
+	}
+	if gate.limit != 1 {
+		t.Errorf("gate limit = %d, want 1", gate.limit)
+	}
+
+	night := time.Date(2025, 1, 6, 22, 0, 0, 0, time.Local)
+	applyLimits(cfg, limiter, gate, night, discardLogger)
+	if limiter.Limit() != 0 || gate.limit != 8 {
+		t.Errorf("night: limiter=%d gate=%d, want unlimited and 8", limiter.Limit(), gate.limit)
+	}
+}
+
+func TestThrottledDownloadOutlastsClientTimeout(t *testing.T) {
+	payload := bytes.Repeat([]byte("maucache"), 5120) // 40KB
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Storage.CacheDir = filepath.Join(dir, "cache")
+	cfg.Storage.ScratchDir = filepath.Join(dir, "scratch")
+	cfg.Storage.StateDir = filepath.Join(dir, "state")
+	cfg.Sync.Concurrency = 1
+	cfg.Sync.RetryMax = 1
+	cfg.Sync.Schedule = []config.ScheduleWindow{
+		{Start: "00:00", End: "12:00", BandwidthLimit: "32KB/s"},
+		{Start: "12:00", End: "00:00", BandwidthLimit: "32KB/s"},
+	}
+	// 40KB at 32KB/s takes over a second, far longer than the metadata timeout.
+	client, err := cdn.NewClient(cdn.Options{Limiter: cdn.NewRateLimiter(0), MetadataTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Not a .pkg, so the fake body is not subject to xar validation
+	jobs := []DownloadJob{{
+		AppName:      "Test",
+		LocationURI:  srv.URL + "/a.zip",
+		Payload:      "a.zip",
+		SizeBytes:    int64(len(payload)),
+		NeedDownload: true,
+	}}
+	start := time.Now()
+	res := ExecuteDownloads(context.Background(), client, jobs, cfg, discardLogger)
+	if res.Downloaded != 1 || res.Failed != 0 {
+		t.Fatalf("result = %+v, want the throttled download to complete", res)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("download took %s, the schedule's bandwidth limit was not applied", elapsed)
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.Storage.CacheDir, "a.zip"))
+	if err != nil || !bytes.Equal(data, payload) {
+		t.Errorf("cached file does not match payload: %v", err)
+	}
+}
@@ -2,8 +2,14 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	gosync "sync"
 	"time"
 
 	"maucache/internal/cdn"
@@ -14,76 +20,435 @@ import (
 // Engine 同步引擎，编排整个同步流程
 // 对应 PowerShell MacUpdatesOffice.Modify.ps1 主脚本
 type Engine struct {
-	cfg     *config.Config
-	client  *cdn.Client
-	log     *slog.Logger
-	tracker *health.Tracker
+	cfg      *config.Config
+	channels []channelTarget // 要同步的频道，第一个是 sync.channel（缓存在根目录）
+	client   *cdn.Client
+	log      *slog.Logger
+	tracker  *health.Tracker
+
+	pins      *pinStore
+	approvals *approvalStore             // 审批模式（sync.require_approval）时不为 nil
+	releases  map[string]*releaseHistory // 频道 → 发布历史，分批发布据此计算各环的版本
+	publishMu gosync.Mutex               // 清理 / 发布编录与管理接口替换编录互斥
+
+	admin       *http.ServeMux    // 管理接口（admin.listen），修改发布状态的操作只注册在这里
+	adminTokens map[string]string // 访问令牌 → 操作人；未配置 admin.tokens_file 时为 nil
 }
 
 // NewEngine 创建同步引擎
-func NewEngine(cfg *config.Config, log *slog.Logger, tracker *health.Tracker) *Engine {
-	return &Engine{
-		cfg:     cfg,
-		client:  cdn.NewClient(),
-		log:     log,
-		tracker: tracker,
+// 出站 HTTP 配置（代理 / CA / 客户端证书）无效时返回错误
+func NewEngine(cfg *config.Config, log *slog.Logger, tracker *health.Tracker) (*Engine, error) {
+	proxyPassword, err := cfg.HTTP.ProxyPassword()
+	if err != nil {
+		return nil, err
+	}
+	bandwidth, err := config.ParseBandwidth(cfg.Sync.BandwidthLimit)
+	if err != nil {
+		return nil, fmt.Errorf("sync.bandwidth_limit 无效: %w", err)
+	}
+	// 签名根证书在启动时检查一次，每次同步时重新读取（更换证书无需重启）
+	trust, err := loadTrustPolicy(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("sync.signature_roots 无效: %w", err)
+	}
+	if trust == nil {
+		log.Warn("未配置 sync.signature_roots，不校验安装包签名")
+	}
+	if _, err := loadCatalogPolicy(cfg); err != nil {
+		return nil, fmt.Errorf("sync.catalog_roots 无效: %w", err)
+	}
+	if cfg.Sync.CatalogRoots == "" {
+		log.Warn("未配置 sync.catalog_roots，编录校验失败时只记录警告，不阻止发布")
+	}
+	var adminTokens map[string]string
+	if cfg.Admin.TokensFile != "" {
+		if adminTokens, err = cfg.Admin.LoadTokens(); err != nil {
+			return nil, fmt.Errorf("admin.tokens_file 无效: %w", err)
+		}
+	}
+	apps, err := selectApps(cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("同步应用列表", "count", len(apps), "custom", len(cfg.Apps.Custom), "locales", cfg.Sync.Locales)
+	limiter := cdn.NewRateLimiter(bandwidth)
+	mirrors := make([]cdn.Mirror, 0, len(cfg.Sync.Upstreams))
+	for _, m := range cfg.Sync.Upstreams {
+		mirrors = append(mirrors, cdn.Mirror{URL: m.URL, Flat: m.Flat})
 	}
+	client, err := cdn.NewClient(cdn.Options{
+		Upstream: cfg.Sync.Upstream,
+		Channels: cfg.Channels,
+		Apps:     apps,
+		Transport: cdn.TransportOptions{
+			ProxyURL:      cfg.HTTP.Proxy,
+			ProxyUser:     cfg.HTTP.ProxyUser,
+			ProxyPassword: proxyPassword,
+			NoProxy:       cfg.HTTP.NoProxy,
+			CAFiles:       cfg.HTTP.CAFiles,
+			ClientCert:    cfg.HTTP.ClientCert,
+			ClientKey:     cfg.HTTP.ClientKey,
+			TLSMinVersion: cfg.HTTP.TLSMinVersion,
+		},
+		ValidatorDir: filepath.Join(cfg.Storage.StateDir, "validators"),
+		Limiter:      limiter,
+		Retry:        cdn.RetryPolicy{Max: cfg.Sync.RetryMax, Delay: cfg.Sync.RetryDelay},
+
+		Mirrors:        mirrors,
+		MirrorCooldown: cfg.Sync.MirrorCooldown,
+		RootChannel:    cfg.Sync.Channel, // 上级缓存与本机按同样的频道布局部署
+
+		BreakerThreshold: cfg.Sync.BreakerThreshold,
+		BreakerCooldown:  cfg.Sync.BreakerCooldown,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建 CDN 客户端失败: %w", err)
+	}
+
+	// 在 /sync/status 中暴露限速值和实际聚合速率
+	tracker.RegisterStatus("bandwidth", func() interface{} {
+		return map[string]int64{
+			"limit_bytes_per_sec":   limiter.Limit(),
+			"current_bytes_per_sec": limiter.CurrentRate(),
+		}
+	})
+	// 上游限流 / 熔断状态
+	tracker.RegisterStatus("upstream_breaker", func() interface{} {
+		return client.Breaker().Status()
+	})
+	// 各上游镜像的健康状态和成功 / 失败计数
+	tracker.RegisterStatus("upstreams", func() interface{} {
+		return client.UpstreamStatus()
+	})
+	if len(cfg.Sync.Schedule) > 0 {
+		tracker.RegisterStatus("schedule", func() interface{} {
+			return cfg.Sync.LimitsAt(time.Now())
+		})
+	}
+	e := &Engine{
+		cfg:      cfg,
+		channels: channelTargets(cfg),
+		client:   client,
+		log:      log,
+		tracker:  tracker,
+		pins:     loadPins(filepath.Join(cfg.Storage.StateDir, pinsFile), cfg.Apps.Pins),
+		releases: make(map[string]*releaseHistory),
+
+		admin:       http.NewServeMux(),
+		adminTokens: adminTokens,
+	}
+	for _, ch := range e.channels {
+		e.releases[ch.name] = loadReleases(filepath.Join(ch.cfg.Storage.StateDir, releasesFile))
+	}
+	// 版本固定：状态和管理接口
+	tracker.RegisterStatus("pins", func() interface{} {
+		return e.pins.status()
+	})
+	e.admin.HandleFunc("POST /apps/{id}/pin", e.handlePin)
+	e.admin.HandleFunc("DELETE /apps/{id}/pin", e.handleUnpin)
+	// 审批模式：新版本批准后才发布
+	if cfg.Sync.RequireApproval {
+		e.approvals = loadApprovals(cfg.Storage.StateDir)
+		tracker.RegisterStatus("approvals", func() interface{} {
+			return map[string]interface{}{"pending": e.approvals.pending()}
+		})
+		// 查询在 health.listen 和管理接口上都提供；批准 / 拒绝只在管理接口上，审批人取认证的操作人
+		tracker.RegisterHandler("GET /approvals", http.HandlerFunc(e.handleApprovals))
+		tracker.RegisterHandler("GET /approvals/audit", http.HandlerFunc(e.handleAudit))
+		e.admin.HandleFunc("GET /approvals", e.handleApprovals)
+		e.admin.HandleFunc("GET /approvals/audit", e.handleAudit)
+		e.admin.HandleFunc("POST /apps/{id}/approve", e.handleApprove)
+		e.admin.HandleFunc("POST /apps/{id}/reject", e.handleReject)
+		log.Info("审批模式已启用，新版本批准后才对客户端提供")
+	}
+	// 分批发布：各环的版本分配
+	if cfg.Rollout.Listen != "" {
+		tracker.RegisterStatus("rollout", func() interface{} {
+			return e.rolloutStatus()
+		})
+		tracker.RegisterHandler("GET /rollout", http.HandlerFunc(e.handleRollout))
+	}
+	return e, nil
+}
+
+// Validate 检查引擎配置，启动阶段调用
+// 未知频道在此处失败，而不是等到同步中途才报错
+func (e *Engine) Validate() error {
+	if err := e.cfg.Validate(); err != nil {
+		return err
+	}
+	for _, ch := range e.channels {
+		if err := e.client.ValidateChannel(ch.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateApps 到上游确认自定义应用存在，启动阶段调用
+// 上游明确不存在的应用返回错误（多半是 ID 拼错）；上游暂时不可用时只记录警告，不阻止启动
+func (e *Engine) ValidateApps(ctx context.Context) error {
+	if len(e.cfg.Apps.Custom) == 0 {
+		return nil
+	}
+	// 自定义应用按语言展开后 AppID 前 4 位不同，按应用代码比较
+	var custom []cdn.AppDef
+	for _, def := range e.client.Apps() {
+		if slices.ContainsFunc(e.cfg.Apps.Custom, func(a config.CustomApp) bool { return sameAppCode(a.ID, def.AppID) }) {
+			custom = append(custom, def)
+		}
+	}
+	err := e.client.CheckApps(ctx, e.cfg.Sync.Channel, custom)
+	var unknown *cdn.UnknownAppError
+	if err != nil && !errors.As(err, &unknown) {
+		e.log.Warn("无法到上游确认自定义应用，跳过检查", "error", err)
+		return nil
+	}
+	return err
+}
+
+// sameAppCode 两个 AppID 去掉 LCID 后是否是同一个应用
+func sameAppCode(a, b string) bool {
+	return len(a) > 4 && len(b) > 4 && strings.EqualFold(a[4:], b[4:])
+}
+
+// keepVersions 各应用要镜像的历史版本数：apps.keep_versions 中同一 AppID 优先，
+// 其次应用代码相同的条目（对所有语言生效），最后是 sync.keep_versions
+func keepVersions(cfg *config.Config, apps []cdn.AppInfo) map[string]int {
+	keep := make(map[string]int, len(apps))
+	for _, app := range apps {
+		n, ok := cfg.Apps.KeepVersions[app.AppID]
+		if !ok {
+			n = cfg.Sync.KeepVersions
+			for id, v := range cfg.Apps.KeepVersions {
+				if sameAppCode(id, app.AppID) {
+					n = v
+					break
+				}
+			}
+		}
+		if n > 0 {
+			keep[app.AppID] = n
+		}
+	}
+	return keep
+}
+
+// selectApps 按 apps 配置和 sync.locales 生成要同步的应用列表
+func selectApps(cfg *config.Config) ([]cdn.AppDef, error) {
+	filter := cdn.AppFilter{Include: cfg.Apps.Include, Exclude: cfg.Apps.Exclude, Locales: cfg.Sync.Locales}
+	for _, a := range cfg.Apps.Custom {
+		filter.Custom = append(filter.Custom, cdn.AppDef{AppID: a.ID, AppName: a.Name})
+	}
+	apps, err := cdn.SelectApps(cdn.TargetApps, filter)
+	if err != nil {
+		return nil, fmt.Errorf("apps 配置无效: %w", err)
+	}
+	return apps, nil
 }
 
 // RunOnce 执行一次完整同步
 // 对应 MacUpdatesOffice.Modify.ps1 的完整流程
+// 配置了多个频道时依次同步：共用同一个限速器和并发调度，频道之间的下载不会互相争抢；
+// 后同步的频道直接硬链接先同步的频道已有的安装包
 func (e *Engine) RunOnce(ctx context.Context) error {
 	start := time.Now()
 	e.tracker.SetRunning(true)
 	defer e.tracker.SetRunning(false)
 
 	e.log.Info("===== 开始同步 =====",
-		"channel", e.cfg.Sync.Channel,
+		"channels", e.channelNames(),
 		"cache_dir", e.cfg.Storage.CacheDir,
 		"concurrency", e.cfg.Sync.Concurrency,
 	)
 
-	// 步骤1: 清理旧文件
-	// 对应 MacUpdatesOffice.Modify.ps1 第 15-36 行
-	// 修复 P4：不递归删除 collateral 目录下的文件
-	cleanStart := time.Now()
-	cleanCount := Cleanup(e.cfg.Storage.CacheDir, e.log)
-	e.log.Info("步骤1: 清理完成", "deleted", cleanCount, "duration", time.Since(cleanStart).Round(time.Millisecond))
+	// 按时段调度设置编录阶段的限速；下载阶段由 ExecuteDownloads 动态调整
+	applyLimits(e.cfg, e.client.Limiter(), nil, time.Now(), e.log)
+
+	builds := &buildResolver{client: e.client}
+	var (
+		total      DownloadResult
+		linked     int
+		failedApps []string
+		errs       []error
+		planned    = make(map[string]bool)
+	)
+	for _, ch := range e.channels {
+		chStart := time.Now()
+		res, err := e.syncChannel(ctx, ch, builds)
+		status := health.ChannelStatus{
+			CacheDir:   ch.cfg.Storage.CacheDir,
+			LastSync:   time.Now(),
+			Downloaded: res.Downloaded,
+			Linked:     res.linked,
+			Skipped:    res.Skipped,
+			Failed:     res.Failed,
+			FailedApps: res.failedApps,
+			Duration:   time.Since(chStart).Round(time.Millisecond).String(),
 
-	// 步骤2: 获取构建版本
+			BuildsSource: res.buildsSource,
+			Builds:       res.builds,
+		}
+		if err != nil {
+			status.Error = err.Error()
+			errs = append(errs, fmt.Errorf("频道 %s: %w", ch.name, err))
+		}
+		e.tracker.RecordChannel(ch.name, status)
+		total.Downloaded += res.Downloaded
+		total.Skipped += res.Skipped
+		total.Failed += res.Failed
+		linked += res.linked
+		failedApps = uniqueStrings(append(failedApps, res.failedApps...))
+		for _, name := range res.planned {
+			planned[name] = true
+		}
+	}
+	e.tracker.SetFailedApps(failedApps)
+
+	// 清理 scratch 临时目录残留：各频道共用 scratch_dir，按所有频道本次的下载计划保留可续传的部分文件
+	// 有频道没能生成下载计划时不清理，避免删掉它的部分文件
+	if len(errs) == 0 {
+		cleanScratch(e.cfg.Storage.ScratchDir, planned, e.log)
+	}
+
+	elapsed := time.Since(start)
+	e.tracker.RecordSync(total.Downloaded, total.Skipped, total.Failed, elapsed)
+
+	// 判断同步结果状态
+	status := "成功"
+	if total.Failed > 0 || len(failedApps) > 0 || len(errs) > 0 {
+		status = "部分失败"
+	}
+
+	e.log.Info("===== 同步完成 =====",
+		"status", status,
+		"channels", len(e.channels),
+		"downloaded", total.Downloaded,
+		"linked", linked,
+		"skipped", total.Skipped,
+		"failed", total.Failed,
+		"failed_apps", len(failedApps),
+		"total_duration", elapsed.Round(time.Second),
+	)
+
+	if total.Failed > 0 {
+		e.log.Warn("存在下载失败的文件，请检查日志中的错误信息", "failed_count", total.Failed)
+	}
+
+	return errors.Join(errs...)
+}
+
+// channelResult 单个频道的同步结果
+type channelResult struct {
+	DownloadResult
+	linked       int
+	failedApps   []string
+	planned      []string // 本次计划下载（未能硬链接）的文件名，同步结束时据此清理 scratch 目录
+	buildsSource string   // 构建列表来源，见 buildsFromChannel 等
+	builds       int      // 构建列表中的版本数
+}
+
+// syncChannel 同步一个频道：获取构建列表和清单、校验并发布编录、清理、计划并执行下载
+func (e *Engine) syncChannel(ctx context.Context, ch channelTarget, resolver *buildResolver) (channelResult, error) {
+	var res channelResult
+	cfg := ch.cfg
+	log := e.log
+	if len(e.channels) > 1 {
+		log = e.log.With("channel", ch.name)
+		log.Info("开始同步频道", "cache_dir", cfg.Storage.CacheDir)
+	}
+
+	// 步骤1: 获取构建版本
 	// 对应 MacUpdatesOffice.Modify.ps1 第 45 行: $builds = Get-MAUProductionBuilds
+	// 清单获取放在清理之前：上游不可用时直接失败，不会先删掉正在提供服务的编录
+	// 原版总是取 Production 的 builds.txt；这里取频道自己的，没有时在步骤2之后推断
 	buildStart := time.Now()
-	builds, err := e.client.FetchBuilds(ctx)
+	channelBuilds, err := resolver.channelBuilds(ctx, ch.name)
 	if err != nil {
-		return fmt.Errorf("获取 builds.txt 失败: %w", err)
+		return res, fmt.Errorf("获取 builds.txt 失败: %w", err)
 	}
-	e.log.Info("步骤2: 构建版本获取完成", "count", len(builds), "duration", time.Since(buildStart).Round(time.Millisecond))
 
-	// 步骤3: 获取所有应用信息
+	// 步骤2: 获取所有应用信息
 	// 对应 MacUpdatesOffice.Modify.ps1 第 48 行: $apps = Get-MAUApps -Channel Production
+	// 部分应用失败时继续同步其余应用，失败的应用保留旧编录并在状态中报告
 	appStart := time.Now()
-	apps, err := e.client.FetchAllApps(ctx, e.cfg.Sync.Channel, e.log)
+	apps, err := e.client.FetchAllApps(ctx, ch.name, log)
+	var fetchErr *cdn.AppFetchError
+	switch {
+	case errors.As(err, &fetchErr):
+		res.failedApps = fetchErr.AppIDs()
+		log.Error("部分应用清单获取失败，将保留其旧编录", "failed_apps", res.failedApps)
+	case err != nil:
+		return res, fmt.Errorf("获取应用列表失败: %w", err)
+	}
+	log.Info("步骤2: 应用信息获取完成", "count", len(apps), "failed", len(res.failedApps), "duration", time.Since(appStart).Round(time.Millisecond))
+
+	builds, source, err := resolver.resolve(ctx, channelBuilds, apps, log)
 	if err != nil {
-		return fmt.Errorf("获取应用列表失败: %w", err)
+		return res, err
+	}
+	res.buildsSource, res.builds = source, len(builds)
+	log.Info("步骤1: 构建版本确定", "source", source, "count", len(builds), "duration", time.Since(buildStart).Round(time.Millisecond))
+
+	// 步骤4 的前半部分提前执行：先下载并校验编录，校验失败的应用在清理时保留旧编录，
+	// 被篡改或彼此不一致的清单组不会替换正在提供服务的编录
+	collStart := time.Now()
+	policy, err := loadCatalogPolicy(cfg)
+	if err != nil {
+		return res, fmt.Errorf("加载编录校验策略失败: %w", err)
+	}
+	prodSets, rejected, incomplete := FetchCollaterals(ctx, e.client, apps, cfg.Storage.CacheDir, true, policy, log)
+	oldSets, oldRejected, oldIncomplete := FetchCollaterals(ctx, e.client, apps, cfg.Storage.CacheDir, false, policy, log)
+	rejected = uniqueStrings(append(rejected, oldRejected...))
+	if len(rejected) > 0 {
+		apps = excludeApps(apps, rejected)
+	}
+	// 编录下载不完整的应用保留旧编录（记为失败，清理时不删），安装包照常下载
+	res.failedApps = uniqueStrings(slices.Concat(res.failedApps, rejected, incomplete, oldIncomplete))
+	// 保留的历史版本：编录保存到 collateral/{版本号}/，安装包在步骤5-6一起计划
+	keep := keepVersions(cfg, apps)
+	historicSets := FetchHistoricCollaterals(ctx, e.client, apps, keep, cfg.Storage.CacheDir, policy, log)
+	// 固定版本的应用：当前版本编录不发布（历史版本编录照常保存，安装包照常下载）
+	pins := e.pins.all()
+	prodSets, pinned := e.holdPinned(prodSets, ch.name, pins, log)
+	// 审批模式：未批准的版本只暂存到 collateral/{版本号}/，根目录保持上次批准的编录
+	var unapproved []string
+	if e.approvals != nil {
+		prodSets, unapproved = e.holdUnapproved(prodSets, ch.name, log)
 	}
-	e.log.Info("步骤3: 应用信息获取完成", "count", len(apps), "duration", time.Since(appStart).Round(time.Millisecond))
+	keepRoot := uniqueStrings(slices.Concat(res.failedApps, pinned, unapproved))
+
+	e.publishMu.Lock()
+
+	// 步骤3: 清理旧文件
+	// 对应 MacUpdatesOffice.Modify.ps1 第 15-36 行
+	// 修复 P4：不递归删除 collateral 目录下的文件
+	cleanStart := time.Now()
+	cleanCount := CleanupExcept(cfg.Storage.CacheDir, keepRoot, log)
+	log.Info("步骤3: 清理完成", "deleted", cleanCount, "duration", time.Since(cleanStart).Round(time.Millisecond))
 
 	// 步骤4: 保存编录文件
 	// 对应 MacUpdatesOffice.Modify.ps1 第 51-52 行:
 	//   Save-MAUCollaterals -MAUApps $apps -CachePath $maupath -isProd $true
 	//   Save-oldMAUCollaterals -MAUApps $apps -CachePath $maupath
-	collStart := time.Now()
-	SaveCollaterals(ctx, e.client, apps, e.cfg.Storage.CacheDir, true, e.log)
-	SaveCollaterals(ctx, e.client, apps, e.cfg.Storage.CacheDir, false, e.log)
-	e.log.Info("步骤4: 编录文件保存完成", "duration", time.Since(collStart).Round(time.Millisecond))
+	PublishCollaterals(prodSets, log)
+	PublishCollaterals(oldSets, log)
+	PublishCollaterals(historicSets, log)
+	e.recordReleases(ch.name, prodSets, time.Now())
+	applyPins(cfg.Storage.CacheDir, pins, log)
+	e.publishMu.Unlock()
+	log.Info("步骤4: 编录文件保存完成", "rejected", len(rejected), "pinned", len(pins), "awaiting_approval", len(unapproved), "historic", len(historicSets), "duration", time.Since(collStart).Round(time.Millisecond))
 
 	// 步骤5-6: 生成下载计划
 	// 对应 MacUpdatesOffice.Modify.ps1 第 55-56 行:
 	//   $dlJobs = Get-MAUCacheDownloadJobs -MAUApps $_ -DeltaFromBuildLimiter $builds
 	planStart := time.Now()
-	jobs, err := PlanDownloads(ctx, e.client, apps, builds, e.cfg.Storage.CacheDir, e.log)
+	jobs, err := PlanDownloads(ctx, e.client, apps, builds, keep, cfg.Storage.CacheDir, log)
 	if err != nil {
-		return fmt.Errorf("生成下载计划失败: %w", err)
+		return res, fmt.Errorf("生成下载计划失败: %w", err)
+	}
+	if len(e.channels) > 1 {
+		res.linked = linkShared(jobs, cfg.Storage.CacheDir, peerCaches(e.channels, ch.name), log)
 	}
 	needDownload := 0
 	var totalBytes int64
@@ -91,11 +456,13 @@ func (e *Engine) RunOnce(ctx context.Context) error {
 		if j.NeedDownload {
 			needDownload++
 			totalBytes += j.SizeBytes
+			res.planned = append(res.planned, j.Payload)
 		}
 	}
-	e.log.Info("步骤5-6: 下载计划生成完成",
+	log.Info("步骤5-6: 下载计划生成完成",
 		"total_jobs", len(jobs),
 		"need_download", needDownload,
+		"linked", res.linked,
 		"skip", len(jobs)-needDownload,
 		"total_size_mb", fmt.Sprintf("%.2f", float64(totalBytes)/1024/1024),
 		"duration", time.Since(planStart).Round(time.Millisecond),
@@ -105,31 +472,23 @@ func (e *Engine) RunOnce(ctx context.Context) error {
 	// 对应 MacUpdatesOffice.Modify.ps1 第 57 行:
 	//   Invoke-MAUCacheDownload -MAUCacheDownloadJobs $dlJobs -CachePath $maupath -ScratchPath $mautemppath -Force
 	dlStart := time.Now()
-	result := ExecuteDownloads(ctx, e.client, jobs, e.cfg, e.log)
-
-	elapsed := time.Since(start)
-	e.tracker.RecordSync(result.Downloaded, result.Skipped, result.Failed, elapsed)
-
-	// 判断同步结果状态
-	status := "成功"
-	if result.Failed > 0 {
-		status = "部分失败"
-	}
-
-	e.log.Info("===== 同步完成 =====",
-		"status", status,
-		"downloaded", result.Downloaded,
-		"skipped", result.Skipped,
-		"failed", result.Failed,
+	res.DownloadResult = ExecuteDownloads(ctx, e.client, jobs, cfg, log)
+	log.Info("下载完成",
+		"downloaded", res.Downloaded,
+		"skipped", res.Skipped,
+		"failed", res.Failed,
 		"download_duration", time.Since(dlStart).Round(time.Second),
-		"total_duration", elapsed.Round(time.Second),
 	)
+	return res, nil
+}
 
-	if result.Failed > 0 {
-		e.log.Warn("存在下载失败的文件，请检查日志中的错误信息", "failed_count", result.Failed)
+// channelNames 返回所有要同步的频道名
+func (e *Engine) channelNames() []string {
+	names := make([]string, len(e.channels))
+	for i, ch := range e.channels {
+		names[i] = ch.name
 	}
-
-	return nil
+	return names
 }
 
 // RunLoop 定时循环执行同步
@@ -138,7 +497,7 @@ func (e *Engine) RunOnce(ctx context.Context) error {
 func (e *Engine) RunLoop(ctx context.Context) {
 	e.log.Info("同步引擎启动，进入定时循环模式",
 		"interval", e.cfg.Sync.Interval,
-		"channel", e.cfg.Sync.Channel,
+		"channels", e.channelNames(),
 	)
 
 	// 启动时立即执行一次
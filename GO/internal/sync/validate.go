@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"maucache/internal/config"
+	"maucache/internal/xar"
+)
+
+// isInstallerPackage 是否是需要做 xar 结构校验的安装包
+func isInstallerPackage(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".pkg")
+}
+
+// loadTrustPolicy 按配置加载签名信任策略，未配置 sync.signature_roots 时返回 nil（不校验签名）
+func loadTrustPolicy(cfg *config.Config) (*xar.TrustPolicy, error) {
+	if cfg.Sync.SignatureRoots == "" {
+		return nil, nil
+	}
+	roots, err := loadCertPool(cfg.Sync.SignatureRoots)
+	if err != nil {
+		return nil, err
+	}
+	return &xar.TrustPolicy{Roots: roots, TeamIDs: cfg.Sync.SignatureTeams}, nil
+}
+
+// loadCertPool 读取 PEM 根证书文件
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取根证书失败: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("根证书 %s 中没有有效的 PEM 证书", path)
+	}
+	return roots, nil
+}
+
+// validatePackage 发布前检查 scratch 中的 .pkg 是否是完整的 xar 安装包，trust 不为 nil 时还校验签名
+// 大小和哈希一致也可能是垃圾（清单没给哈希时，HTML 错误页、代理拦截页、截断的 xar 都能通过大小比对），
+// 校验失败的文件移到隔离目录，不会进入缓存
+func validatePackage(job DownloadJob, scratchPath, quarantineDir string, trust *xar.TrustPolicy, log *slog.Logger) (xar.PackageInfo, error) {
+	info, err := xar.InspectPackage(scratchPath, trust)
+	if err == nil {
+		log.Debug("安装包校验通过",
+			"file", job.Payload,
+			"identifier", info.Identifier,
+			"version", info.Version,
+			"bundle_id", info.BundleID,
+			"bundle_version", info.BundleVersion,
+			"signer", info.Signer.CommonName,
+		)
+		return info, nil
+	}
+
+	removeResumeState(scratchPath)
+	dest, qerr := quarantineFile(scratchPath, quarantineDir)
+	if qerr != nil {
+		log.Error("隔离文件失败，直接删除", "file", job.Payload, "error", qerr)
+		os.Remove(scratchPath)
+		dest = ""
+	}
+	log.Error("安装包校验失败，已隔离",
+		"app", job.AppName,
+		"file", job.Payload,
+		"url", job.LocationURI,
+		"quarantine", dest,
+		"error", err,
+	)
+	return info, fmt.Errorf("安装包校验失败: %w", err)
+}
+
+// quarantineFile 把文件移到隔离目录，同名文件被覆盖（保留最近一次的样本）
+func quarantineFile(path, quarantineDir string) (string, error) {
+	if err := os.MkdirAll(quarantineDir, 0750); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(quarantineDir, filepath.Base(path))
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
@@ -0,0 +1,132 @@
+package xar
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PackageInfo 安装包的标识信息
+// 产品包（productbuild）取自 Distribution，组件包（pkgbuild）取自 PackageInfo；
+// 应用包信息取自第一个声明了 bundle 的 PackageInfo
+type PackageInfo struct {
+	Identifier string // 包标识，如 com.microsoft.package.Microsoft_Word.app
+	Version    string // 包版本
+
+	BundleID           string // 如 com.microsoft.Word
+	BundleVersion      string // CFBundleVersion，如 16.93.25011212
+	BundleShortVersion string // CFBundleShortVersionString，如 16.93
+
+	// Signer 通过校验的签名者，未做签名校验时为零值
+	Signer Signer
+}
+
+// InspectPackage 打开 .pkg 文件，校验 xar 结构并读取包标识；
+// trust 不为 nil 时还校验签名，并按 TOC 中的校验和核对所有条目的数据（签名只覆盖 TOC）
+// 返回错误说明文件不能作为安装包发布：不是 xar、结构损坏、被截断、缺少 Distribution / PackageInfo，
+// 或未签名、签名无效、签名者不受信任，或数据与签名过的 TOC 不符
+func InspectPackage(path string, trust *TrustPolicy) (PackageInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return PackageInfo{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return PackageInfo{}, err
+	}
+	x, err := NewReader(f, fi.Size())
+	if err != nil {
+		return PackageInfo{}, err
+	}
+	info, err := x.PackageInfo()
+	if err != nil || trust == nil {
+		return info, err
+	}
+	if info.Signer, err = x.VerifySignature(*trust); err != nil {
+		return info, err
+	}
+	return info, x.VerifyData()
+}
+
+// PackageInfo 从 Distribution / PackageInfo 中读取包标识
+func (x *Reader) PackageInfo() (PackageInfo, error) {
+	var info PackageInfo
+
+	if x.File("Distribution") != nil {
+		data, err := x.ReadFile("Distribution")
+		if err != nil {
+			return info, err
+		}
+		var dist xmlDistribution
+		if err := xml.Unmarshal(data, &dist); err != nil {
+			return info, formatErrorf("Distribution 解析失败: %v", err)
+		}
+		info.Identifier, info.Version = dist.Product.ID, dist.Product.Version
+		if info.Identifier == "" {
+			for _, ref := range dist.PkgRefs {
+				if ref.ID != "" && ref.Version != "" {
+					info.Identifier, info.Version = ref.ID, ref.Version
+					break
+				}
+			}
+		}
+	}
+
+	// 根目录的 PackageInfo（组件包）优先，其次是产品包内各组件的 PackageInfo
+	var components []*File
+	if f := x.File("PackageInfo"); f != nil {
+		components = append(components, f)
+	}
+	for _, f := range x.Files {
+		if dir, ok := strings.CutSuffix(f.Name, "/PackageInfo"); ok && !strings.Contains(dir, "/") {
+			components = append(components, f)
+		}
+	}
+	for _, f := range components {
+		data, err := x.ReadFile(f.Name)
+		if err != nil {
+			return info, err
+		}
+		var pi xmlPackageInfo
+		if err := xml.Unmarshal(data, &pi); err != nil {
+			return info, formatErrorf("%s 解析失败: %v", f.Name, err)
+		}
+		if info.Identifier == "" {
+			info.Identifier, info.Version = pi.Identifier, pi.Version
+		}
+		if info.BundleID == "" && len(pi.Bundles) > 0 {
+			b := pi.Bundles[0]
+			info.BundleID, info.BundleVersion, info.BundleShortVersion = b.ID, b.Version, b.ShortVersion
+		}
+	}
+
+	if info.Identifier == "" {
+		return info, fmt.Errorf("xar: 归档中没有 Distribution 或 PackageInfo，不是安装包")
+	}
+	return info, nil
+}
+
+// Distribution（installer-gui-script）中用到的部分
+type xmlDistribution struct {
+	Product struct {
+		ID      string `xml:"id,attr"`
+		Version string `xml:"version,attr"`
+	} `xml:"product"`
+	PkgRefs []struct {
+		ID      string `xml:"id,attr"`
+		Version string `xml:"version,attr"`
+	} `xml:"pkg-ref"`
+}
+
+// PackageInfo（pkg-info）中用到的部分
+type xmlPackageInfo struct {
+	Identifier string `xml:"identifier,attr"`
+	Version    string `xml:"version,attr"`
+	Bundles    []struct {
+		ID           string `xml:"id,attr"`
+		Version      string `xml:"CFBundleVersion,attr"`
+		ShortVersion string `xml:"CFBundleShortVersionString,attr"`
+	} `xml:"bundle"`
+}
@@ -0,0 +1,177 @@
+package xar
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// xar 的 RSA 签名：用叶证书私钥对 TOC 校验和做 PKCS#1 v1.5 签名（DigestInfo 的算法即 TOC 校验算法），
+// 签名字节存放在堆中，证书链（叶证书在前）以 base64 DER 写在 TOC 的 signature/KeyInfo 中
+
+// ErrUnsigned 安装包没有签名
+var ErrUnsigned = errors.New("xar: 安装包未签名")
+
+// SignatureError 签名无效或签名者不受信任
+type SignatureError struct {
+	Msg string
+}
+
+func (e *SignatureError) Error() string {
+	return "xar: 签名校验失败: " + e.Msg
+}
+
+func signatureErrorf(format string, args ...interface{}) error {
+	return &SignatureError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Apple 证书扩展
+var (
+	// oidDeveloperIDInstaller 叶证书：Developer ID Installer
+	oidDeveloperIDInstaller = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 1, 14}
+	// oidApplePrefix Apple 私有扩展的前缀，链校验时视为已处理
+	oidApplePrefix = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6}
+)
+
+// Signature TOC 中的签名
+type Signature struct {
+	Style        string              // 目前只支持 RSA
+	Value        []byte              // 堆中的签名字节
+	Certificates []*x509.Certificate // 叶证书在前，随后是中间证书
+}
+
+// Signer 通过校验的签名者
+type Signer struct {
+	CommonName  string // 如 "Developer ID Installer: Microsoft Corporation (UBF8T346G9)"
+	TeamID      string // 叶证书的 OU，如 UBF8T346G9
+	Fingerprint string // 叶证书 DER 的 SHA-256（十六进制）
+}
+
+// TrustPolicy 签名信任策略
+type TrustPolicy struct {
+	Roots   *x509.CertPool // Apple 根证书
+	TeamIDs []string       // 允许的 Developer ID Team ID
+	// CurrentTime 校验证书有效期的时刻，零值表示当前时间
+	CurrentTime time.Time
+}
+
+// VerifySignature 校验签名：签名覆盖 TOC 校验和、证书链可追溯到 Roots、
+// 叶证书是 Developer ID Installer 且 Team ID 在允许列表中
+func (x *Reader) VerifySignature(p TrustPolicy) (Signer, error) {
+	sig := x.Signature
+	if sig == nil {
+		return Signer{}, ErrUnsigned
+	}
+	if !strings.EqualFold(sig.Style, "RSA") {
+		return Signer{}, signatureErrorf("不支持的签名类型 %q", sig.Style)
+	}
+	if len(sig.Certificates) == 0 {
+		return Signer{}, signatureErrorf("签名没有附带证书")
+	}
+	leaf := sig.Certificates[0]
+
+	var digest crypto.Hash
+	switch x.TOCChecksum.Algorithm {
+	case "sha1":
+		digest = crypto.SHA1
+	case "sha256":
+		digest = crypto.SHA256
+	case "sha512":
+		digest = crypto.SHA512
+	default:
+		return Signer{}, signatureErrorf("TOC 校验算法 %q 不能用于签名", x.TOCChecksum.Algorithm)
+	}
+	pub, ok := leaf.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return Signer{}, signatureErrorf("叶证书不是 RSA 公钥")
+	}
+	if err := rsa.VerifyPKCS1v15(pub, digest, x.TOCChecksum.Sum, sig.Value); err != nil {
+		return Signer{}, signatureErrorf("签名与 TOC 不符: %v", err)
+	}
+
+	// Apple 证书把私有扩展标为 critical，x509 默认拒绝；这些扩展由下面的 Developer ID 检查处理
+	for _, c := range sig.Certificates {
+		c.UnhandledCriticalExtensions = slices.DeleteFunc(c.UnhandledCriticalExtensions, isAppleExtension)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range sig.Certificates[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         p.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   p.CurrentTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return Signer{}, signatureErrorf("证书链不受信任: %v", err)
+	}
+
+	if !hasExtension(leaf, oidDeveloperIDInstaller) {
+		return Signer{}, signatureErrorf("%q 不是 Developer ID Installer 证书", leaf.Subject.CommonName)
+	}
+	signer := Signer{
+		CommonName:  leaf.Subject.CommonName,
+		Fingerprint: fmt.Sprintf("%x", sha256.Sum256(leaf.Raw)),
+	}
+	for _, ou := range leaf.Subject.OrganizationalUnit {
+		if slices.Contains(p.TeamIDs, ou) {
+			signer.TeamID = ou
+			return signer, nil
+		}
+	}
+	return Signer{}, signatureErrorf("签名者 %q（Team ID %v）不在允许列表 %v 中",
+		leaf.Subject.CommonName, leaf.Subject.OrganizationalUnit, p.TeamIDs)
+}
+
+// parseSignature 读取 TOC 中的 signature 元素：签名字节和证书链
+func (x *Reader) parseSignature(s *xmlSignature) error {
+	if s == nil {
+		return nil
+	}
+	value, err := x.readHeap(s.Offset, s.Size)
+	if err != nil {
+		return fmt.Errorf("读取签名: %w", err)
+	}
+	sig := &Signature{Style: s.Style, Value: value}
+	for i, b64 := range s.Certificates {
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(b64), ""))
+		if err != nil {
+			return formatErrorf("签名证书 %d 无法解码: %v", i, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return formatErrorf("签名证书 %d 无效: %v", i, err)
+		}
+		sig.Certificates = append(sig.Certificates, cert)
+	}
+	x.Signature = sig
+	return nil
+}
+
+func isAppleExtension(oid asn1.ObjectIdentifier) bool {
+	return len(oid) > len(oidApplePrefix) && oid[:len(oidApplePrefix)].Equal(oidApplePrefix)
+}
+
+func hasExtension(c *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range c.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+type xmlSignature struct {
+	Style        string   `xml:"style,attr"`
+	Offset       int64    `xml:"offset"`
+	Size         int64    `xml:"size"`
+	Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+}
@@ -0,0 +1,229 @@
+package xar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+// identity is a signing key plus its certificate chain, leaf first.
+type identity struct {
+	key   *rsa.PrivateKey
+	chain [][]byte
+}
+
+// testPKI mimics Apple's hierarchy: root → Developer ID CA → installer leaf.
+type testPKI struct {
+	roots     *x509.CertPool
+	microsoft *identity // Developer ID Installer, team UBF8T346G9
+	otherTeam *identity // Developer ID Installer, another team
+	notDevID  *identity // same CA, but without the Developer ID Installer marker
+}
+
+var (
+	pkiOnce sync.Once
+	pki     testPKI
+)
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	pkiOnce.Do(func() {
+		now := time.Now()
+		rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		root := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "Test Apple Root CA"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		rootDER, _ := x509.CreateCertificate(rand.Reader, root, root, &rootKey.PublicKey, rootKey)
+		root, _ = x509.ParseCertificate(rootDER)
+
+		caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		ca := &x509.Certificate{
+			SerialNumber:          big.NewInt(2),
+			Subject:               pkix.Name{CommonName: "Test Developer ID Certification Authority"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		caDER, _ := x509.CreateCertificate(rand.Reader, ca, root, &caKey.PublicKey, rootKey)
+		ca, _ = x509.ParseCertificate(caDER)
+
+		leaf := func(serial int64, cn, team string, devID bool) *identity {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(serial),
+				Subject:      pkix.Name{CommonName: cn, OrganizationalUnit: []string{team}},
+				NotBefore:    now.Add(-time.Hour),
+				NotAfter:     now.Add(24 * time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+			}
+			if devID {
+				// Apple marks this extension critical, which x509 would reject by default.
+				tmpl.ExtraExtensions = []pkix.Extension{{Id: oidDeveloperIDInstaller, Critical: true, Value: []byte{0x05, 0x00}}}
+			}
+			der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+			if err != nil {
+				panic(err)
+			}
+			return &identity{key: key, chain: [][]byte{der, caDER}}
+		}
+
+		pki.roots = x509.NewCertPool()
+		pki.roots.AddCert(root)
+		pki.microsoft = leaf(10, "Developer ID Installer: Microsoft Corporation (UBF8T346G9)", "UBF8T346G9", true)
+		pki.otherTeam = leaf(11, "Developer ID Installer: Example Ltd (ABCDE12345)", "ABCDE12345", true)
+		pki.notDevID = leaf(12, "Mac Developer: Microsoft Corporation (UBF8T346G9)", "UBF8T346G9", false)
+	})
+	return pki
+}
+
+func signedArchive(t *testing.T, alg string, id *identity) []byte {
+	return buildSignedXar(t, alg, []member{
+		{name: "Distribution", data: []byte(testDistribution)},
+		{name: "Microsoft_Word.pkg/PackageInfo", data: []byte(testPackageInfo)},
+	}, id)
+}
+
+func TestInspectPackageVerifiesSignature(t *testing.T) {
+	p := newTestPKI(t)
+	trust := &TrustPolicy{Roots: p.roots, TeamIDs: []string{"UBF8T346G9"}}
+
+	for _, alg := range []string{"sha1", "sha256"} {
+		t.Run(alg, func(t *testing.T) {
+			info, err := InspectPackage(writeTemp(t, signedArchive(t, alg, p.microsoft)), trust)
+			if err != nil {
+				t.Fatalf("InspectPackage: %v", err)
+			}
+			if info.Signer.TeamID != "UBF8T346G9" ||
+				info.Signer.CommonName != "Developer ID Installer: Microsoft Corporation (UBF8T346G9)" ||
+				len(info.Signer.Fingerprint) != 64 {
+				t.Errorf("Signer = %+v", info.Signer)
+			}
+			if info.Identifier != "com.microsoft.word.standalone.365" {
+				t.Errorf("Identifier = %q", info.Identifier)
+			}
+		})
+	}
+}
+
+func TestInspectPackageRejectsBadSignatures(t *testing.T) {
+	p := newTestPKI(t)
+	trust := &TrustPolicy{Roots: p.roots, TeamIDs: []string{"UBF8T346G9"}}
+
+	tampered := signedArchive(t, "sha1", p.microsoft)
+	x, err := NewReader(bytes.NewReader(tampered), int64(len(tampered)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Signature.Value[0] ^= 0xff
+
+	tests := []struct {
+		name  string
+		data  []byte
+		trust *TrustPolicy
+	}{
+		{"wrong team", signedArchive(t, "sha1", p.otherTeam), trust},
+		{"not developer id", signedArchive(t, "sha1", p.notDevID), trust},
+		{"untrusted root", signedArchive(t, "sha1", p.microsoft), &TrustPolicy{Roots: x509.NewCertPool(), TeamIDs: trust.TeamIDs}},
+		{"expired", signedArchive(t, "sha1", p.microsoft), &TrustPolicy{Roots: p.roots, TeamIDs: trust.TeamIDs, CurrentTime: time.Now().Add(48 * time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := InspectPackage(writeTemp(t, tt.data), tt.trust)
+			var se *SignatureError
+			if !errors.As(err, &se) {
+				t.Errorf("err = %v, want SignatureError", err)
+			}
+		})
+	}
+
+	t.Run("tampered signature", func(t *testing.T) {
+		_, err := x.VerifySignature(*trust)
+		var se *SignatureError
+		if !errors.As(err, &se) {
+			t.Errorf("err = %v, want SignatureError", err)
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		_, err := InspectPackage(writeTemp(t, productArchive(t, "sha1")), trust)
+		if !errors.Is(err, ErrUnsigned) {
+			t.Errorf("err = %v, want ErrUnsigned", err)
+		}
+	})
+}
+
+// The signature covers the TOC checksum, so the digest must match the TOC algorithm.
+func TestSignatureDigestFollowsTOCChecksum(t *testing.T) {
+	p := newTestPKI(t)
+	data := signedArchive(t, "sha256", p.microsoft)
+	x, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPKCS1v15(&p.microsoft.key.PublicKey, crypto.SHA256, x.TOCChecksum.Sum, x.Signature.Value); err != nil {
+		t.Errorf("signature is not a SHA-256 PKCS#1 v1.5 signature of the TOC checksum: %v", err)
+	}
+	if len(x.Signature.Certificates) != 2 {
+		t.Errorf("got %d certificates, want leaf + intermediate", len(x.Signature.Certificates))
+	}
+}
+
+// The signature only covers the TOC, so payload bytes are trusted through the
+// archived checksums listed in it.
+func TestInspectPackageVerifiesPayloadChecksums(t *testing.T) {
+	p := newTestPKI(t)
+	trust := &TrustPolicy{Roots: p.roots, TeamIDs: []string{"UBF8T346G9"}}
+	payload := bytes.Repeat([]byte("payload!"), 64<<10) // 512KB, read in several chunks
+	data := buildSignedXar(t, "sha256", []member{
+		{name: "Distribution", data: []byte(testDistribution)},
+		{name: "Microsoft_Word.pkg/PackageInfo", data: []byte(testPackageInfo)},
+		{name: "Microsoft_Word.pkg/Payload", data: payload, raw: true},
+	}, p.microsoft)
+
+	if _, err := InspectPackage(writeTemp(t, data), trust); err != nil {
+		t.Fatalf("InspectPackage: %v", err)
+	}
+
+	at := bytes.Index(data, payload) + len(payload) - 1
+	data[at] ^= 0xff
+	path := writeTemp(t, data)
+	var fe *FormatError
+	if _, err := InspectPackage(path, trust); !errors.As(err, &fe) {
+		t.Errorf("flipped payload byte: err = %v, want FormatError", err)
+	}
+	// Without a trust policy only the metadata files are read.
+	if _, err := InspectPackage(path, nil); err != nil {
+		t.Errorf("InspectPackage without trust: %v", err)
+	}
+
+	data[at] ^= 0xff
+	x, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.File("Microsoft_Word.pkg/Payload").ArchivedChecksum = Checksum{}
+	if err := x.VerifyData(); !errors.As(err, &fe) {
+		t.Errorf("missing checksum: err = %v, want FormatError", err)
+	}
+}
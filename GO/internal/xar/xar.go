@@ -0,0 +1,451 @@
+// Package xar 读取 xar 归档（macOS .pkg 安装包的容器格式）并校验其结构
+//
+// 文件结构：
+//
+//	头部（大端序，至少 28 字节）：magic "xar!"、头部长度、版本、TOC 压缩 / 解压长度、校验算法
+//	TOC：zlib 压缩的 XML，描述每个文件在堆中的位置、编码和校验和
+//	堆：TOC 校验和（通常位于偏移 0）、签名、各文件的数据
+//
+// 只解码 TOC 和少量元数据文件（Distribution / PackageInfo），不解压 Payload；
+// VerifyData 按存档校验和逐块核对所有条目在堆中的数据
+package xar
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	magic         = 0x78617221 // "xar!"
+	minHeaderSize = 28
+	// maxTOCSize 解压后 TOC 的上限，防止构造的压缩炸弹耗尽内存
+	maxTOCSize = 64 << 20
+	// maxMetadataSize ReadFile 读取的单个文件上限（Distribution / PackageInfo 通常只有几 KB）
+	maxMetadataSize = 16 << 20
+)
+
+// 头部中的 TOC 校验算法
+const (
+	checksumNone  = 0
+	checksumSHA1  = 1
+	checksumMD5   = 2
+	checksumOther = 3 // 算法名写在头部第 28 字节起，如 "sha256"
+)
+
+// ErrNotXar 文件头不是 xar 归档（常见于 HTML 错误页、代理拦截页）
+var ErrNotXar = errors.New("xar: 文件头不是 xar 归档")
+
+// FormatError 归档结构损坏：TOC 无法解压或解析、校验和不符、数据超出文件范围等
+type FormatError struct {
+	Msg string
+}
+
+func (e *FormatError) Error() string {
+	return "xar: " + e.Msg
+}
+
+func formatErrorf(format string, args ...interface{}) error {
+	return &FormatError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Header xar 文件头
+type Header struct {
+	Size            uint16 // 头部长度，堆从 Size + TOCCompressed 处开始
+	Version         uint16
+	TOCCompressed   uint64
+	TOCUncompressed uint64
+	Checksum        string // TOC 校验算法：none / sha1 / md5 / 头部给出的算法名
+}
+
+// Checksum 一个校验和
+type Checksum struct {
+	Algorithm string // sha1 / sha256 / md5 ...，小写
+	Sum       []byte
+}
+
+// File 归档中的一个条目
+type File struct {
+	Name     string // 归档内的完整路径，如 "Microsoft_Word.pkg/PackageInfo"
+	Type     string // file / directory / symlink ...
+	Offset   int64  // 数据在堆中的偏移
+	Length   int64  // 堆中（编码后）的长度
+	Size     int64  // 解码后的长度
+	Encoding string // application/x-gzip / application/x-bzip2 / application/octet-stream ...
+
+	ArchivedChecksum  Checksum // 堆中数据的校验和
+	ExtractedChecksum Checksum // 解码后数据的校验和
+}
+
+// Reader 已通过结构校验的 xar 归档
+type Reader struct {
+	Header Header
+	Files  []*File
+
+	// TOCChecksum 存储在堆中的 TOC 校验和，已与实际计算值比对一致
+	TOCChecksum Checksum
+	// Signature TOC 中的签名，未签名时为 nil；是否可信由 VerifySignature 判断
+	Signature *Signature
+
+	r    io.ReaderAt
+	size int64
+	heap int64 // 堆在文件中的起始偏移
+}
+
+// NewReader 读取并校验 xar 归档：
+// 检查文件头、解压 TOC、核对 TOC 校验和，并确认签名和所有条目的数据都落在文件范围内（截断的文件会在这里失败）
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	var hdr [minHeaderSize]byte
+	if size < minHeaderSize {
+		return nil, ErrNotXar
+	}
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(hdr[0:]) != magic {
+		return nil, ErrNotXar
+	}
+
+	x := &Reader{r: r, size: size}
+	h := &x.Header
+	h.Size = binary.BigEndian.Uint16(hdr[4:])
+	h.Version = binary.BigEndian.Uint16(hdr[6:])
+	h.TOCCompressed = binary.BigEndian.Uint64(hdr[8:])
+	h.TOCUncompressed = binary.BigEndian.Uint64(hdr[16:])
+	alg := binary.BigEndian.Uint32(hdr[24:])
+
+	if h.Size < minHeaderSize || int64(h.Size) > size {
+		return nil, formatErrorf("头部长度无效: %d", h.Size)
+	}
+	if h.Version != 1 {
+		return nil, formatErrorf("不支持的版本 %d", h.Version)
+	}
+	switch alg {
+	case checksumNone:
+		h.Checksum = "none"
+	case checksumSHA1:
+		h.Checksum = "sha1"
+	case checksumMD5:
+		h.Checksum = "md5"
+	case checksumOther:
+		name := make([]byte, int(h.Size)-minHeaderSize)
+		if _, err := r.ReadAt(name, minHeaderSize); err != nil {
+			return nil, err
+		}
+		h.Checksum = strings.ToLower(string(bytes.TrimRight(name, "\x00")))
+	default:
+		return nil, formatErrorf("未知的 TOC 校验算法 %d", alg)
+	}
+
+	if h.TOCCompressed == 0 || h.TOCCompressed > uint64(size-int64(h.Size)) {
+		return nil, formatErrorf("TOC 长度 %d 超出文件范围（文件 %d 字节）", h.TOCCompressed, size)
+	}
+	if h.TOCUncompressed > maxTOCSize {
+		return nil, formatErrorf("TOC 过大: %d 字节", h.TOCUncompressed)
+	}
+	x.heap = int64(h.Size) + int64(h.TOCCompressed)
+
+	compressed := make([]byte, h.TOCCompressed)
+	if _, err := r.ReadAt(compressed, int64(h.Size)); err != nil {
+		return nil, err
+	}
+	tocXML, err := inflateTOC(compressed, h.TOCUncompressed)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc xmlDoc
+	if err := xml.Unmarshal(tocXML, &doc); err != nil {
+		return nil, formatErrorf("TOC 解析失败: %v", err)
+	}
+	if err := x.verifyTOC(compressed, doc.TOC.Checksum); err != nil {
+		return nil, err
+	}
+	if err := x.parseSignature(doc.TOC.Signature); err != nil {
+		return nil, err
+	}
+	if err := x.collect(doc.TOC.Files, ""); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// inflateTOC 解压 TOC 并核对解压后的长度
+func inflateTOC(compressed []byte, want uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, formatErrorf("TOC 解压失败: %v", err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, int64(want)+1))
+	if err != nil {
+		return nil, formatErrorf("TOC 解压失败: %v", err)
+	}
+	if uint64(len(out)) != want {
+		return nil, formatErrorf("TOC 解压后长度 %d 与头部 %d 不符", len(out), want)
+	}
+	return out, nil
+}
+
+// verifyTOC 用堆中存储的校验和核对压缩的 TOC
+func (x *Reader) verifyTOC(compressed []byte, c *xmlTOCChecksum) error {
+	if x.Header.Checksum == "none" {
+		return nil
+	}
+	if c == nil {
+		return formatErrorf("TOC 缺少 checksum 元素")
+	}
+	if style := strings.ToLower(c.Style); style != x.Header.Checksum {
+		return formatErrorf("TOC 校验算法 %q 与头部 %q 不一致", style, x.Header.Checksum)
+	}
+	h := newHash(x.Header.Checksum)
+	if h == nil {
+		return formatErrorf("不支持的 TOC 校验算法 %q", x.Header.Checksum)
+	}
+	if c.Size != int64(h.Size()) {
+		return formatErrorf("TOC 校验和长度 %d 与算法 %s 不符", c.Size, x.Header.Checksum)
+	}
+	stored, err := x.readHeap(c.Offset, c.Size)
+	if err != nil {
+		return fmt.Errorf("读取 TOC 校验和: %w", err)
+	}
+	h.Write(compressed)
+	if sum := h.Sum(nil); !bytes.Equal(sum, stored) {
+		return formatErrorf("TOC 校验和不符: 存储 %x，实际 %x", stored, sum)
+	}
+	x.TOCChecksum = Checksum{Algorithm: x.Header.Checksum, Sum: stored}
+	return nil
+}
+
+// collect 展开嵌套的 file 元素，并检查每个条目的数据范围
+func (x *Reader) collect(files []xmlFile, dir string) error {
+	for _, xf := range files {
+		name := xf.Name
+		if dir != "" {
+			name = dir + "/" + xf.Name
+		}
+		f := &File{Name: name, Type: xf.Type}
+		if d := xf.Data; d != nil {
+			f.Offset, f.Length, f.Size = d.Offset, d.Length, d.Size
+			f.Encoding = d.Encoding.Style
+			var err error
+			if f.ArchivedChecksum, err = d.Archived.parse(); err != nil {
+				return formatErrorf("%s: archived-checksum 无效: %v", name, err)
+			}
+			if f.ExtractedChecksum, err = d.Extracted.parse(); err != nil {
+				return formatErrorf("%s: extracted-checksum 无效: %v", name, err)
+			}
+			if err := x.checkBounds(f.Offset, f.Length); err != nil {
+				return formatErrorf("%s: %v", name, err)
+			}
+			if f.Size < 0 {
+				return formatErrorf("%s: 解码后长度无效: %d", name, f.Size)
+			}
+		}
+		x.Files = append(x.Files, f)
+		if err := x.collect(xf.Files, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBounds 确认堆中 [offset, offset+length) 位于文件范围内
+func (x *Reader) checkBounds(offset, length int64) error {
+	heapSize := x.size - x.heap
+	if offset < 0 || length < 0 || offset > heapSize || length > heapSize-offset {
+		return fmt.Errorf("数据 [%d, +%d) 超出堆范围（%d 字节），文件可能被截断", offset, length, heapSize)
+	}
+	return nil
+}
+
+// readHeap 读取堆中的一段数据
+func (x *Reader) readHeap(offset, length int64) ([]byte, error) {
+	if err := x.checkBounds(offset, length); err != nil {
+		return nil, &FormatError{Msg: err.Error()}
+	}
+	buf := make([]byte, length)
+	if _, err := x.r.ReadAt(buf, x.heap+offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// File 按归档内路径查找条目，不存在时返回 nil
+func (x *Reader) File(name string) *File {
+	name = path.Clean(name)
+	for _, f := range x.Files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// ReadFile 读取并解码一个条目，核对存档和解码后的校验和
+// 只用于元数据文件：超过 16 MB 的条目返回错误
+func (x *Reader) ReadFile(name string) ([]byte, error) {
+	f := x.File(name)
+	if f == nil {
+		return nil, fmt.Errorf("xar: 归档中没有 %s", name)
+	}
+	if f.Length > maxMetadataSize || f.Size > maxMetadataSize {
+		return nil, fmt.Errorf("xar: %s 过大（%d 字节）", name, f.Size)
+	}
+	raw, err := x.readHeap(f.Offset, f.Length)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.ArchivedChecksum.verify(raw); err != nil {
+		return nil, formatErrorf("%s: 存档数据%v", name, err)
+	}
+
+	var rd io.Reader
+	switch f.Encoding {
+	case "", "application/octet-stream":
+		rd = bytes.NewReader(raw)
+	case "application/x-gzip":
+		// 名为 gzip，实际是 zlib 流
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, formatErrorf("%s: 解压失败: %v", name, err)
+		}
+		defer zr.Close()
+		rd = zr
+	case "application/x-bzip2":
+		rd = bzip2.NewReader(bytes.NewReader(raw))
+	default:
+		return nil, fmt.Errorf("xar: %s: 不支持的编码 %s", name, f.Encoding)
+	}
+	data, err := io.ReadAll(io.LimitReader(rd, f.Size+1))
+	if err != nil {
+		return nil, formatErrorf("%s: 解压失败: %v", name, err)
+	}
+	if int64(len(data)) != f.Size {
+		return nil, formatErrorf("%s: 解码后长度 %d 与 TOC 中的 %d 不符", name, len(data), f.Size)
+	}
+	if err := f.ExtractedChecksum.verify(data); err != nil {
+		return nil, formatErrorf("%s: 解码数据%v", name, err)
+	}
+	return data, nil
+}
+
+// VerifyData 按 TOC 中的 archived-checksum 核对每个有数据的条目（含 Payload）
+// 签名只覆盖 TOC 校验和，各文件的数据要靠 TOC 中的这些校验和才能与签名关联起来：
+// 条目缺少校验和、算法不受支持或数据不符都返回 FormatError。逐块读取，不受 maxMetadataSize 限制
+func (x *Reader) VerifyData() error {
+	buf := make([]byte, 256<<10)
+	for _, f := range x.Files {
+		if f.Length == 0 {
+			continue
+		}
+		if len(f.ArchivedChecksum.Sum) == 0 {
+			return formatErrorf("%s: 缺少 archived-checksum", f.Name)
+		}
+		h := newHash(f.ArchivedChecksum.Algorithm)
+		if h == nil {
+			return formatErrorf("%s: 不支持的校验算法 %q", f.Name, f.ArchivedChecksum.Algorithm)
+		}
+		if _, err := io.CopyBuffer(h, io.NewSectionReader(x.r, x.heap+f.Offset, f.Length), buf); err != nil {
+			return fmt.Errorf("xar: 读取 %s: %w", f.Name, err)
+		}
+		if sum := h.Sum(nil); !bytes.Equal(sum, f.ArchivedChecksum.Sum) {
+			return formatErrorf("%s: 存档数据校验和不符: 期望 %x，实际 %x", f.Name, f.ArchivedChecksum.Sum, sum)
+		}
+	}
+	return nil
+}
+
+// verify 核对数据的校验和；没有校验和或算法未知时跳过
+func (c Checksum) verify(data []byte) error {
+	if len(c.Sum) == 0 {
+		return nil
+	}
+	h := newHash(c.Algorithm)
+	if h == nil {
+		return nil
+	}
+	h.Write(data)
+	if sum := h.Sum(nil); !bytes.Equal(sum, c.Sum) {
+		return fmt.Errorf("校验和不符: 期望 %x，实际 %x", c.Sum, sum)
+	}
+	return nil
+}
+
+// newHash 按算法名创建哈希，不支持时返回 nil
+func newHash(alg string) hash.Hash {
+	switch alg {
+	case "sha1":
+		return sha1.New()
+	case "md5":
+		return md5.New()
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// TOC 的 XML 结构
+type xmlDoc struct {
+	TOC struct {
+		Checksum  *xmlTOCChecksum `xml:"checksum"`
+		Signature *xmlSignature   `xml:"signature"`
+		Files     []xmlFile       `xml:"file"`
+	} `xml:"toc"`
+}
+
+type xmlTOCChecksum struct {
+	Style  string `xml:"style,attr"`
+	Offset int64  `xml:"offset"`
+	Size   int64  `xml:"size"`
+}
+
+type xmlFile struct {
+	Name  string    `xml:"name"`
+	Type  string    `xml:"type"`
+	Data  *xmlData  `xml:"data"`
+	Files []xmlFile `xml:"file"`
+}
+
+type xmlData struct {
+	Offset   int64 `xml:"offset"`
+	Length   int64 `xml:"length"`
+	Size     int64 `xml:"size"`
+	Encoding struct {
+		Style string `xml:"style,attr"`
+	} `xml:"encoding"`
+	Archived  xmlHash `xml:"archived-checksum"`
+	Extracted xmlHash `xml:"extracted-checksum"`
+}
+
+type xmlHash struct {
+	Style string `xml:"style,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (h xmlHash) parse() (Checksum, error) {
+	v := strings.TrimSpace(h.Value)
+	if v == "" {
+		return Checksum{}, nil
+	}
+	sum, err := hex.DecodeString(v)
+	if err != nil {
+		return Checksum{}, err
+	}
+	return Checksum{Algorithm: strings.ToLower(h.Style), Sum: sum}, nil
+}
@@ -0,0 +1,275 @@
+package xar
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// member is one file placed into a test archive.
+type member struct {
+	name string // may contain one directory level, e.g. "Word.pkg/PackageInfo"
+	data []byte
+	raw  bool // store as octet-stream instead of zlib
+}
+
+// buildXar writes a xar archive the way xar(1) lays it out: the TOC checksum
+// at heap offset 0 followed by the file data. alg is "sha1" or "sha256".
+func buildXar(t *testing.T, alg string, members []member) []byte {
+	t.Helper()
+	return buildSignedXar(t, alg, members, nil)
+}
+
+// buildSignedXar is buildXar with an RSA signature over the TOC checksum
+// stored right after it, as productsign does. A nil id leaves it unsigned.
+func buildSignedXar(t *testing.T, alg string, members []member, id *identity) []byte {
+	t.Helper()
+	newHash := func() hash.Hash {
+		if alg == "sha256" {
+			return sha256.New()
+		}
+		return sha1.New()
+	}
+	sumSize := newHash().Size()
+
+	var heap bytes.Buffer
+	heap.Write(make([]byte, sumSize)) // filled in once the TOC is known
+	sigOffset := heap.Len()
+	if id != nil {
+		heap.Write(make([]byte, id.key.Size()))
+	}
+	entries := make(map[string][]string)
+	for i, m := range members {
+		stored, encoding := m.data, "application/octet-stream"
+		if !m.raw {
+			stored, encoding = deflate(t, m.data), "application/x-gzip"
+		}
+		archived, extracted := newHash(), newHash()
+		archived.Write(stored)
+		extracted.Write(m.data)
+		dir, base := "", m.name
+		if i := strings.LastIndex(m.name, "/"); i >= 0 {
+			dir, base = m.name[:i], m.name[i+1:]
+		}
+		entries[dir] = append(entries[dir], fmt.Sprintf(
+			`<file id="%d"><name>%s</name><type>file</type><data>`+
+				`<length>%d</length><offset>%d</offset><size>%d</size>`+
+				`<encoding style="%s"/>`+
+				`<archived-checksum style="%s">%x</archived-checksum>`+
+				`<extracted-checksum style="%s">%x</extracted-checksum>`+
+				`</data></file>`,
+			i+100, base, len(stored), heap.Len(), len(m.data), encoding,
+			alg, archived.Sum(nil), alg, extracted.Sum(nil)))
+		heap.Write(stored)
+	}
+
+	var toc strings.Builder
+	fmt.Fprintf(&toc, `<?xml version="1.0" encoding="UTF-8"?><xar><toc>`+
+		`<checksum style="%s"><offset>0</offset><size>%d</size></checksum>`, alg, sumSize)
+	if id != nil {
+		fmt.Fprintf(&toc, `<signature style="RSA"><offset>%d</offset><size>%d</size>`+
+			`<KeyInfo xmlns="http://www.w3.org/2000/09/xmldsig#"><X509Data>`, sigOffset, id.key.Size())
+		for _, der := range id.chain {
+			fmt.Fprintf(&toc, "<X509Certificate>%s</X509Certificate>", base64.StdEncoding.EncodeToString(der))
+		}
+		toc.WriteString(`</X509Data></KeyInfo></signature>`)
+	}
+	toc.WriteString(strings.Join(entries[""], ""))
+	var dirs []string
+	for dir := range entries {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	for i, dir := range dirs {
+		fmt.Fprintf(&toc, `<file id="%d"><name>%s</name><type>directory</type>%s</file>`,
+			i+1, dir, strings.Join(entries[dir], ""))
+	}
+	toc.WriteString(`</toc></xar>`)
+
+	tocZ := deflate(t, []byte(toc.String()))
+	h := newHash()
+	h.Write(tocZ)
+	heapBytes := heap.Bytes()
+	copy(heapBytes, h.Sum(nil))
+	if id != nil {
+		digest := crypto.SHA1
+		if alg == "sha256" {
+			digest = crypto.SHA256
+		}
+		sig, err := rsa.SignPKCS1v15(rand.Reader, id.key, digest, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(heapBytes[sigOffset:], sig)
+	}
+
+	headerSize := minHeaderSize
+	algID := uint32(checksumSHA1)
+	if alg != "sha1" {
+		headerSize, algID = 64, checksumOther
+	}
+	hdr := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(hdr[0:], magic)
+	binary.BigEndian.PutUint16(hdr[4:], uint16(headerSize))
+	binary.BigEndian.PutUint16(hdr[6:], 1)
+	binary.BigEndian.PutUint64(hdr[8:], uint64(len(tocZ)))
+	binary.BigEndian.PutUint64(hdr[16:], uint64(toc.Len()))
+	binary.BigEndian.PutUint32(hdr[24:], algID)
+	if algID == checksumOther {
+		copy(hdr[minHeaderSize:], alg)
+	}
+	return append(append(hdr, tocZ...), heapBytes...)
+}
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const testDistribution = `<?xml version="1.0" encoding="utf-8"?>
+<installer-gui-script minSpecVersion="2">
+    <title>Microsoft Word</title>
+    <product id="com.microsoft.word.standalone.365" version="16.93.25011212"/>
+    <choices-outline><line choice="word"/></choices-outline>
+    <pkg-ref id="com.microsoft.package.Microsoft_Word.app" version="16.93.25011212" installKBytes="2411000">#Microsoft_Word.pkg</pkg-ref>
+</installer-gui-script>`
+
+const testPackageInfo = `<?xml version="1.0" encoding="utf-8"?>
+<pkg-info format-version="2" identifier="com.microsoft.package.Microsoft_Word.app" version="16.93.25011212" install-location="/Applications" auth="root">
+    <payload numberOfFiles="9000" installKBytes="2411000"/>
+    <bundle path="./Microsoft Word.app" id="com.microsoft.Word" CFBundleShortVersionString="16.93" CFBundleVersion="16.93.25011212"/>
+    <bundle-version><bundle id="com.microsoft.Word"/></bundle-version>
+</pkg-info>`
+
+func productArchive(t *testing.T, alg string) []byte {
+	return buildXar(t, alg, []member{
+		{name: "Distribution", data: []byte(testDistribution)},
+		{name: "Resources/en.lproj/License.rtf", data: []byte("{\\rtf1}"), raw: true},
+		{name: "Microsoft_Word.pkg/PackageInfo", data: []byte(testPackageInfo)},
+		{name: "Microsoft_Word.pkg/Payload", data: bytes.Repeat([]byte{0x1f, 0x8b}, 4096), raw: true},
+	})
+}
+
+func writeTemp(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.pkg")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInspectProductArchive(t *testing.T) {
+	for _, alg := range []string{"sha1", "sha256"} {
+		t.Run(alg, func(t *testing.T) {
+			info, err := InspectPackage(writeTemp(t, productArchive(t, alg)), nil)
+			if err != nil {
+				t.Fatalf("InspectPackage: %v", err)
+			}
+			want := PackageInfo{
+				Identifier:         "com.microsoft.word.standalone.365",
+				Version:            "16.93.25011212",
+				BundleID:           "com.microsoft.Word",
+				BundleVersion:      "16.93.25011212",
+				BundleShortVersion: "16.93",
+			}
+			if info != want {
+				t.Errorf("info = %+v, want %+v", info, want)
+			}
+		})
+	}
+}
+
+func TestInspectComponentPackage(t *testing.T) {
+	data := buildXar(t, "sha1", []member{
+		{name: "PackageInfo", data: []byte(testPackageInfo)},
+		{name: "Payload", data: []byte("payload"), raw: true},
+	})
+	info, err := InspectPackage(writeTemp(t, data), nil)
+	if err != nil {
+		t.Fatalf("InspectPackage: %v", err)
+	}
+	if info.Identifier != "com.microsoft.package.Microsoft_Word.app" || info.BundleVersion != "16.93.25011212" {
+		t.Errorf("info = %+v", info)
+	}
+}
+
+func TestNewReaderListsNestedFiles(t *testing.T) {
+	data := productArchive(t, "sha1")
+	x, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Distribution", "Microsoft_Word.pkg", "Microsoft_Word.pkg/Payload", "Resources/en.lproj/License.rtf"} {
+		if x.File(name) == nil {
+			t.Errorf("missing %s", name)
+		}
+	}
+	if x.TOCChecksum.Algorithm != "sha1" || len(x.TOCChecksum.Sum) != sha1.Size {
+		t.Errorf("TOCChecksum = %+v", x.TOCChecksum)
+	}
+	got, err := x.ReadFile("Resources/en.lproj/License.rtf")
+	if err != nil || string(got) != "{\\rtf1}" {
+		t.Errorf("ReadFile = %q, %v", got, err)
+	}
+}
+
+func TestInspectRejectsBrokenPackages(t *testing.T) {
+	good := productArchive(t, "sha1")
+	tocEnd := int(binary.BigEndian.Uint16(good[4:])) + int(binary.BigEndian.Uint64(good[8:]))
+
+	corrupt := func(i int) []byte {
+		b := bytes.Clone(good)
+		b[i] ^= 0xff
+		return b
+	}
+	noMeta := buildXar(t, "sha1", []member{{name: "Payload", data: []byte("x")}})
+
+	tests := []struct {
+		name   string
+		data   []byte
+		notXar bool
+	}{
+		{"html error page", []byte("<!DOCTYPE html><html><body>Access denied by proxy</body></html>"), true},
+		{"empty", nil, true},
+		{"truncated payload", good[:len(good)-100], false},
+		{"truncated toc", good[:tocEnd-10], false},
+		{"toc checksum", corrupt(tocEnd), false},
+		{"toc bytes", corrupt(tocEnd - 20), false},
+		{"metadata bytes", corrupt(tocEnd + sha1.Size + 5), false},
+		{"no metadata", noMeta, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := InspectPackage(writeTemp(t, tt.data), nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := errors.Is(err, ErrNotXar); got != tt.notXar {
+				t.Errorf("errors.Is(err, ErrNotXar) = %v, err = %v", got, err)
+			}
+		})
+	}
+}